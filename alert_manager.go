@@ -11,7 +11,9 @@ import (
 	"github.com/mayuresh82/alert_manager/api"
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/reporting"
 	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
@@ -31,6 +33,13 @@ func Run(config *Config) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// start exporting traces
+	if config.Tracing != nil {
+		glog.Infof("Will export traces to %s", config.Tracing.Url)
+		tracing.SetExporter(config.Tracing)
+		go config.Tracing.Start(ctx)
+	}
+
 	// start the config loader
 	reloadConfig := make(chan struct{})
 	ah.Config = ah.NewConfigHandler(*alertConfig)
@@ -51,7 +60,7 @@ func Run(config *Config) {
 
 	//Initialize all the plugins
 	// Listener, transforms
-	plugins.Init(ctx, db, plugins.WebUrl(config.Agent.WebUrl))
+	plugins.Init(ctx, db, plugins.WebUrl(config.Agent.WebUrl), plugins.Actioner(handler))
 
 	// start the API server
 	glog.Infof("Starting API server on %s", config.Api.ApiAddr)
@@ -74,13 +83,19 @@ func Run(config *Config) {
 	if config.Api.AdminUsername != "" {
 		admin = &api.User{Username: config.Api.AdminUsername, Password: config.Api.AdminPassword}
 	}
-	server := api.NewServer(config.Api.ApiAddr, config.Api.ApiKey, admin, auth, handler)
+	server := api.NewServer(
+		config.Api.ApiAddr, config.Api.ApiKey, admin, auth, handler,
+		api.WebUrl(config.Agent.WebUrl),
+		api.SlackSigningSecret(config.Api.SlackSigningSecret),
+	)
 	go server.Start(ctx, config.Api.ServerTimeout)
 
 	// start the reporting agent
-	glog.Infof("Will send stats to %s", config.Reporter.Url)
+	for _, r := range config.Reporters {
+		glog.Infof("Will send stats to reporter %s", r.Name())
+	}
 	go stats.StartExport(ctx, config.Agent.StatsExportInterval)
-	go config.Reporter.Start(ctx)
+	go reporting.Start(ctx, config.Reporters...)
 
 	// wait for sig
 	signalChan := make(chan os.Signal, 1)
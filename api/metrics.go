@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+)
+
+// activeAlerts returns the gauge of active alerts per team and severity
+func (s *Server) activeAlerts(ctx context.Context) (*stats.Family, error) {
+	var counts []*models.AlertCount
+	tx := s.handler.Db.NewTx()
+	err := models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
+		var er error
+		counts, er = models.ActiveAlertCounts(tx)
+		return er
+	})
+	if err != nil {
+		return nil, err
+	}
+	f := &stats.Family{
+		Name: stats.MetricName("alerts_active"),
+		Help: "Number of active alerts per team and severity",
+		Type: "gauge",
+	}
+	for _, c := range counts {
+		f.Samples = append(f.Samples, &stats.Sample{
+			Labels: map[string]string{"team": c.Team, "severity": c.Severity.String()},
+			Value:  float64(c.Count),
+		})
+	}
+	return f, nil
+}
+
+// Metrics exports all stats in the prometheus text format
+func (s *Server) Metrics(w http.ResponseWriter, req *http.Request) {
+	var extra []*stats.Family
+	active, err := s.activeAlerts(req.Context())
+	if err != nil {
+		glog.Errorf("Api: Unable to get active alert counts: %v", err)
+		s.statError.Add(1)
+	} else {
+		extra = append(extra, active)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := stats.WritePrometheus(w, extra...); err != nil {
+		glog.Errorf("Api: Unable to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerMetrics(t *testing.T) {
+	s := NewMockServer()
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.Metrics).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	body, _ := ioutil.ReadAll(rr.Body)
+	for _, line := range []string{
+		"# TYPE test_alerts_active gauge",
+		`test_alerts_active{severity="CRITICAL",team="neteng"} 2`,
+		`test_alerts_active{severity="WARN",team="neteng"} 5`,
+		"# TYPE test_db_transaction_duration_seconds histogram",
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
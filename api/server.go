@@ -92,6 +92,9 @@ type Server struct {
 	authProvider AuthProvider
 	apiKey       string
 	admin        *User
+	webUrl       string
+	// slackSigningSecret verifies slack interaction requests, actions are disabled if empty
+	slackSigningSecret string
 
 	statGets          stats.Stat
 	statPosts         stats.Stat
@@ -100,8 +103,24 @@ type Server struct {
 	statsAuthFailures stats.Stat
 }
 
-func NewServer(addr, apiKey string, admin *User, authProvider AuthProvider, handler *ah.AlertHandler) *Server {
-	return &Server{
+type ServerOption func(*Server)
+
+// WebUrl sets the base url of the web UI used in links to alerts
+func WebUrl(url string) ServerOption {
+	return func(s *Server) {
+		s.webUrl = url
+	}
+}
+
+// SlackSigningSecret enables the slack interaction endpoint
+func SlackSigningSecret(secret string) ServerOption {
+	return func(s *Server) {
+		s.slackSigningSecret = secret
+	}
+}
+
+func NewServer(addr, apiKey string, admin *User, authProvider AuthProvider, handler *ah.AlertHandler, opts ...ServerOption) *Server {
+	s := &Server{
 		addr:              addr,
 		apiKey:            apiKey,
 		admin:             admin,
@@ -112,7 +131,12 @@ func NewServer(addr, apiKey string, admin *User, authProvider AuthProvider, hand
 		statPatches:       stats.NewCounter("api.patches"),
 		statError:         stats.NewCounter("api.errors"),
 		statsAuthFailures: stats.NewCounter("api.auth_failures"),
+		webUrl:            "http://localhost",
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Server) Start(ctx context.Context, timeout time.Duration) {
@@ -122,6 +146,9 @@ func (s *Server) Start(ctx context.Context, timeout time.Duration) {
 	router.HandleFunc("/api/auth/refresh", s.Validate(s.RefreshToken)).Methods("GET")
 	router.HandleFunc("/api/plugins", s.GetPluginsList).Methods("GET")
 	router.HandleFunc("/api/field/{field}", s.GetField).Methods("GET")
+	router.HandleFunc("/api/webhook_tokens", s.Validate(s.GetWebhookTokens)).Methods("GET")
+	router.HandleFunc("/api/webhook_tokens", s.Validate(s.CreateWebhookToken)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/webhook_tokens/{id}", s.Validate(s.DeleteWebhookToken)).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/api/{category}", s.GetItems).Methods("GET")
 	router.HandleFunc("/api/{category}/{id}", s.Validate(s.Update)).Methods("PATCH", "OPTIONS")
 	router.HandleFunc("/api/alerts/{id}", s.GetAlert).Methods("GET")
@@ -131,6 +158,8 @@ func (s *Server) Start(ctx context.Context, timeout time.Duration) {
 	router.HandleFunc("/api/suppression_rules/{id}/clear", s.Validate(s.ClearSuppRule)).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/api/users", s.Validate(s.CreateUser)).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/users/{name}/delete", s.Validate(s.DeleteUser)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/slack/actions", s.SlackAction).Methods("POST")
+	router.HandleFunc("/metrics", s.Metrics).Methods("GET")
 
 	// CORS specific headers
 	allowedHeaders := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
@@ -579,3 +608,152 @@ func (s *Server) DeleteUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 }
+
+func (s *Server) GetWebhookTokens(w http.ResponseWriter, req *http.Request) {
+	tx := s.handler.Db.NewTx()
+	var tokens models.WebhookTokens
+	err := models.WithTx(req.Context(), tx, func(ctx context.Context, tx models.Txn) error {
+		var err error
+		tokens, err = tx.SelectWebhookTokens(models.QuerySelectWebhookTokens)
+		return err
+	})
+	if err != nil {
+		glog.Errorf("Api: Unable to fetch webhook tokens: %v", err)
+		http.Error(w, fmt.Sprintf("Unable to fetch webhook tokens: %v", err), http.StatusInternalServerError)
+		s.statError.Add(1)
+		return
+	}
+	s.statGets.Add(1)
+	if tokens == nil {
+		tokens = models.WebhookTokens{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// callerTeam returns the team of the authenticated user, or an empty team for the admin
+// who manages the tokens of all teams
+func (s *Server) callerTeam(req *http.Request) (team string, isAdmin bool, err error) {
+	claims, ok := req.Context().Value("decoded").(*Claims)
+	if !ok {
+		return "", false, fmt.Errorf("No authenticated user")
+	}
+	if s.admin != nil && claims.Username == s.admin.Username {
+		return "", true, nil
+	}
+	tx := s.handler.Db.NewTx()
+	var user models.User
+	err = models.WithTx(req.Context(), tx, func(ctx context.Context, tx models.Txn) error {
+		user, err = tx.GetUser(claims.Username)
+		return err
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("Unable to find user in database: %v", err)
+	}
+	if user.Team == nil || user.Team.Name == "" {
+		return "", false, fmt.Errorf("User %s has no team", claims.Username)
+	}
+	return user.Team.Name, false, nil
+}
+
+// CreateWebhookToken creates a webhook token for the source and team in the request. The
+// plain token is only returned in the response, the DB stores its hash. Users other than
+// the admin can only create tokens for their own team.
+func (s *Server) CreateWebhookToken(w http.ResponseWriter, req *http.Request) {
+	params := struct {
+		Name   string `json:"name"`
+		Source string `json:"source"`
+		Team   string `json:"team"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid parameters for query: %v", err), http.StatusBadRequest)
+		return
+	}
+	if params.Name == "" {
+		http.Error(w, "Failed to create webhook token: Name is required", http.StatusBadRequest)
+		return
+	}
+	team, isAdmin, err := s.callerTeam(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create webhook token: %v", err), http.StatusUnauthorized)
+		s.statsAuthFailures.Add(1)
+		return
+	}
+	if !isAdmin {
+		if params.Team == "" {
+			params.Team = team
+		}
+		if params.Team != team {
+			http.Error(w, fmt.Sprintf("Failed to create webhook token: Not allowed for team %s", params.Team), http.StatusForbidden)
+			s.statsAuthFailures.Add(1)
+			return
+		}
+	}
+	creator := req.Context().Value("decoded").(*Claims).Username
+	token, err := models.NewWebhookToken(params.Name, params.Source, params.Team, creator)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create webhook token: %v", err), http.StatusInternalServerError)
+		s.statError.Add(1)
+		return
+	}
+	tx := s.handler.Db.NewTx()
+	err = models.WithTx(req.Context(), tx, func(ctx context.Context, tx models.Txn) error {
+		id, err := tx.NewInsert(models.QueryInsertWebhookToken, token)
+		if err != nil {
+			return err
+		}
+		token.Id = id
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create webhook token: %v", err), http.StatusInternalServerError)
+		s.statError.Add(1)
+		return
+	}
+	s.statPosts.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// DeleteWebhookToken deletes a webhook token. Users other than the admin can only delete
+// the tokens of their own team.
+func (s *Server) DeleteWebhookToken(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid webhook token id: %v", vars["id"]), http.StatusBadRequest)
+		return
+	}
+	team, isAdmin, err := s.callerTeam(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to delete webhook token: %v", err), http.StatusUnauthorized)
+		s.statsAuthFailures.Add(1)
+		return
+	}
+	var found, allowed bool
+	tx := s.handler.Db.NewTx()
+	err = models.WithTx(req.Context(), tx, func(ctx context.Context, tx models.Txn) error {
+		tokens, err := tx.SelectWebhookTokens(models.QuerySelectWebhookTokenById, id)
+		if err != nil || len(tokens) == 0 {
+			return err
+		}
+		found = true
+		if allowed = isAdmin || tokens[0].Team == team; !allowed {
+			return nil
+		}
+		return tx.Exec(models.QueryDeleteWebhookToken, id)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to delete webhook token: %v", err), http.StatusInternalServerError)
+		s.statError.Add(1)
+		return
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("Webhook token %d not found", id), http.StatusNotFound)
+		return
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("Unable to delete webhook token: Token %d does not belong to team %s", id, team), http.StatusForbidden)
+		s.statsAuthFailures.Add(1)
+	}
+}
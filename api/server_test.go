@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -46,6 +47,12 @@ func (tx *MockTx) InQuery(query string, arg ...interface{}) error {
 }
 
 func (tx *MockTx) InSelect(query string, to interface{}, arg ...interface{}) error {
+	if query == models.QueryActiveCounts {
+		*(to.(*[]*models.AlertCount)) = []*models.AlertCount{
+			{Team: "neteng", Severity: models.Sev_CRITICAL, Count: 2},
+			{Team: "neteng", Severity: models.Sev_WARN, Count: 5},
+		}
+	}
 	return nil
 }
 
@@ -106,6 +113,22 @@ func (t *MockTx) GetUser(username string) (models.User, error) {
 	}, nil
 }
 
+func (tx *MockTx) SelectWebhookTokens(query string, args ...interface{}) (models.WebhookTokens, error) {
+	tokens := models.WebhookTokens{
+		&models.WebhookToken{Id: 1, Name: "grafana", Source: "grafana", TokenHash: models.HashToken("foo"), Creator: "foo"},
+		&models.WebhookToken{Id: 2, Name: "neteng", Team: "neteng", TokenHash: models.HashToken("bar"), Creator: "foo"},
+	}
+	if query == models.QuerySelectWebhookTokenById {
+		for _, token := range tokens {
+			if token.Id == args[0].(int64) {
+				return models.WebhookTokens{token}, nil
+			}
+		}
+		return nil, nil
+	}
+	return tokens[:1], nil
+}
+
 func (t *MockTx) NewInsert(query string, item interface{}) (int64, error) {
 	return 1, nil
 }
@@ -402,6 +425,78 @@ func TestSuppRule(t *testing.T) {
 	assert.Equal(t, c["dont_expire"].(bool), true)
 }
 
+func TestWebhookTokens(t *testing.T) {
+	s := NewMockServer()
+	s.admin = &User{Username: "admin"}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/webhook_tokens", s.GetWebhookTokens).Methods("GET")
+	router.HandleFunc("/api/webhook_tokens", s.CreateWebhookToken).Methods("POST")
+	router.HandleFunc("/api/webhook_tokens/{id}", s.DeleteWebhookToken).Methods("DELETE")
+	// serve sends the request as the user, foo is in team neteng
+	serve := func(method, url, body, user string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), "decoded", &Claims{Username: user}))
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a name is required
+	rr := serve("POST", "/api/webhook_tokens", `{"source": "grafana"}`, "foo")
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+
+	// the plain token is only returned on create
+	rr = serve("POST", "/api/webhook_tokens", `{"name": "grafana", "source": "grafana", "team": "neteng"}`, "foo")
+	a := map[string]interface{}{}
+	if err := json.NewDecoder(rr.Result().Body).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a["id"].(float64), float64(1))
+	assert.Equal(t, a["source"].(string), "grafana")
+	assert.Equal(t, a["team"].(string), "neteng")
+	assert.Equal(t, a["creator"].(string), "foo")
+	assert.Len(t, a["token"].(string), 64)
+	_, ok := a["TokenHash"]
+	assert.False(t, ok)
+
+	// users create tokens for their own team only, the admin for any or all teams
+	rr = serve("POST", "/api/webhook_tokens", `{"name": "grafana"}`, "foo")
+	a = map[string]interface{}{}
+	if err := json.NewDecoder(rr.Result().Body).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a["team"].(string), "neteng")
+	rr = serve("POST", "/api/webhook_tokens", `{"name": "grafana", "team": "infra"}`, "foo")
+	assert.Equal(t, rr.Code, http.StatusForbidden)
+	rr = serve("POST", "/api/webhook_tokens", `{"name": "grafana"}`, "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	rr = serve("POST", "/api/webhook_tokens", `{"name": "grafana"}`, "admin")
+	a = map[string]interface{}{}
+	if err := json.NewDecoder(rr.Result().Body).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, a["team"].(string), "")
+
+	rr = serve("GET", "/api/webhook_tokens", "", "foo")
+	b := []map[string]interface{}{}
+	if err := json.NewDecoder(rr.Result().Body).Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(b), 1)
+	assert.Equal(t, b[0]["name"].(string), "grafana")
+	_, ok = b[0]["token"]
+	assert.False(t, ok)
+
+	// users delete the tokens of their own team only
+	assert.Equal(t, serve("DELETE", "/api/webhook_tokens/2", "", "foo").Code, http.StatusOK)
+	assert.Equal(t, serve("DELETE", "/api/webhook_tokens/1", "", "foo").Code, http.StatusForbidden)
+	assert.Equal(t, serve("DELETE", "/api/webhook_tokens/1", "", "admin").Code, http.StatusOK)
+	assert.Equal(t, serve("DELETE", "/api/webhook_tokens/3", "", "admin").Code, http.StatusNotFound)
+	assert.Equal(t, serve("DELETE", "/api/webhook_tokens/abc", "", "admin").Code, http.StatusBadRequest)
+}
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 	ah.Config = ah.NewConfigHandler("../testutil/testdata/test_config.yaml")
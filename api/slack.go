@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/slack"
+)
+
+const (
+	// requests older than this are rejected to prevent replays
+	slackMaxRequestAge   = 5 * time.Minute
+	slackResponseTimeout = 5 * time.Second
+)
+
+type slackAction struct {
+	ActionId string `json:"action_id"`
+	Value    string `json:"value"`
+}
+
+type slackBlock struct {
+	Type     string        `json:"type"`
+	Elements []slackAction `json:"elements"`
+}
+
+// slackInteraction is the part of the slack block_actions payload used to action alerts
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		Id       string `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"user"`
+	ResponseUrl string        `json:"response_url"`
+	Actions     []slackAction `json:"actions"`
+	Message     struct {
+		Attachments []struct {
+			Blocks []slackBlock `json:"blocks"`
+		} `json:"attachments"`
+	} `json:"message"`
+}
+
+// actions returns the action ids of the buttons present in the original message
+func (i *slackInteraction) actions() []string {
+	var actions []string
+	for _, a := range i.Message.Attachments {
+		for _, b := range a.Blocks {
+			if b.Type != "actions" {
+				continue
+			}
+			for _, e := range b.Elements {
+				actions = append(actions, e.ActionId)
+			}
+		}
+	}
+	return actions
+}
+
+// verifySlackSignature verifies the request signature as per
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid request timestamp")
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return fmt.Errorf("Request timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("Invalid request signature")
+	}
+	return nil
+}
+
+// slackRespond updates the original message using the response url of the interaction
+func (s *Server) slackRespond(responseUrl string, msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		glog.Errorf("Api: Slack: Unable to encode response: %v", err)
+		return
+	}
+	c := &http.Client{Timeout: slackResponseTimeout}
+	resp, err := c.Post(responseUrl, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		glog.Errorf("Api: Slack: Unable to post response: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		glog.Errorf("Api: Slack: Unable to post response: Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+}
+
+func (s *Server) slackError(responseUrl, text string) {
+	go s.slackRespond(responseUrl, map[string]interface{}{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+}
+
+// slackUser maps the slack user to a user in the database by username or name
+func (s *Server) slackUser(ctx context.Context, i *slackInteraction) (models.User, error) {
+	var (
+		user models.User
+		err  error
+	)
+	tx := s.handler.Db.NewTx()
+	err = models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
+		for _, name := range []string{i.User.Username, i.User.Name} {
+			if name == "" {
+				continue
+			}
+			if user, err = tx.GetUser(name); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("Slack user %s not found", i.User.Id)
+	})
+	return user, err
+}
+
+// SlackAction handles interaction payloads from the buttons in slack messages
+func (s *Server) SlackAction(w http.ResponseWriter, req *http.Request) {
+	if s.slackSigningSecret == "" {
+		http.Error(w, "Slack actions are not enabled", http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, "Unable to read request", http.StatusBadRequest)
+		return
+	}
+	err = verifySlackSignature(
+		s.slackSigningSecret,
+		req.Header.Get("X-Slack-Request-Timestamp"),
+		req.Header.Get("X-Slack-Signature"),
+		body,
+		time.Now(),
+	)
+	if err != nil {
+		s.statsAuthFailures.Add(1)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	i := &slackInteraction{}
+	if err := json.Unmarshal([]byte(form.Get("payload")), i); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
+		return
+	}
+	// slack only needs a 200 to acknowledge the interaction, results are posted to the response url
+	if i.Type != "block_actions" || len(i.Actions) == 0 {
+		return
+	}
+	action := i.Actions[0]
+	id, err := strconv.ParseInt(action.Value, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid alert id", http.StatusBadRequest)
+		return
+	}
+	ctx := req.Context()
+	user, err := s.slackUser(ctx, i)
+	if err != nil {
+		s.slackError(i.ResponseUrl, fmt.Sprintf("Unable to action alert %d: %v", id, err))
+		return
+	}
+	tx := s.handler.Db.NewTx()
+	alert, err := s.handler.GetExisting(tx, &models.Alert{Id: id})
+	if err != nil {
+		s.slackError(i.ResponseUrl, fmt.Sprintf("Alert %d not found", id))
+		return
+	}
+	var note string
+	err = models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
+		switch action.ActionId {
+		case slack.ActionAck:
+			note = fmt.Sprintf("Acknowledged by %s", user.Name)
+			return s.handler.SetOwner(ctx, tx, alert, user.Name, "", true)
+		case slack.ActionSuppress1h, slack.ActionSuppress4h:
+			if alert.Status != models.Status_ACTIVE {
+				return fmt.Errorf("Alert %d is not ACTIVE", id)
+			}
+			duration := time.Hour
+			if action.ActionId == slack.ActionSuppress4h {
+				duration = 4 * time.Hour
+			}
+			note = fmt.Sprintf("Suppressed by %s for %v", user.Name, duration)
+			return s.handler.Suppress(ctx, tx, alert, user.Name, "alert suppressed via Slack", duration, true)
+		case slack.ActionClear:
+			note = fmt.Sprintf("Cleared by %s", user.Name)
+			return s.handler.Clear(ctx, tx, alert, true)
+		}
+		return fmt.Errorf("Unknown action %s", action.ActionId)
+	})
+	if err != nil {
+		glog.Errorf("Api: Slack: Unable to action alert %d: %v", id, err)
+		s.statError.Add(1)
+		s.slackError(i.ResponseUrl, fmt.Sprintf("Unable to action alert %d: %v", id, err))
+		return
+	}
+	s.statPatches.Add(1)
+	msg := slack.Message(alert, s.webUrl, alert.Description, note, i.actions())
+	msg["replace_original"] = true
+	go s.slackRespond(i.ResponseUrl, msg)
+}
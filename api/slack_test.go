@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const slackPayloadTmpl = `{
+  "type": "block_actions",
+  "user": {"id": "U123", "username": "foo", "name": "foo"},
+  "response_url": "%s",
+  "actions": [{"action_id": "%s", "value": "1"}],
+  "message": {"attachments": [{"blocks": [
+    {"type": "section"},
+    {"type": "actions", "elements": [
+      {"action_id": "am_ack"}, {"action_id": "am_suppress_1h"}, {"action_id": "am_suppress_4h"}, {"action_id": "am_clear"}
+    ]}
+  ]}]}
+}`
+
+func slackRequest(secret, responseUrl, actionId string, ts time.Time) *http.Request {
+	body := url.Values{"payload": {fmt.Sprintf(slackPayloadTmpl, responseUrl, actionId)}}.Encode()
+	timestamp := fmt.Sprintf("%d", ts.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	req, _ := http.NewRequest("POST", "/api/slack/actions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestServerSlackAction(t *testing.T) {
+	responses := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg := make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&msg)
+		responses <- msg
+	}))
+	defer ts.Close()
+	s := NewMockServer()
+	s.webUrl = "http://am"
+
+	// disabled without a signing secret
+	rr := httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_ack", time.Now()))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// invalid signature and stale requests are rejected
+	s.slackSigningSecret = "secret"
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("wrong", ts.URL, "am_ack", time.Now()))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_ack", time.Now().Add(-10*time.Minute)))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	buttons := func(msg map[string]interface{}) []string {
+		var actions []string
+		blocks := msg["attachments"].([]interface{})[0].(map[string]interface{})["blocks"].([]interface{})
+		for _, b := range blocks {
+			block := b.(map[string]interface{})
+			if block["type"] != "actions" {
+				continue
+			}
+			for _, e := range block["elements"].([]interface{}) {
+				actions = append(actions, e.(map[string]interface{})["action_id"].(string))
+			}
+		}
+		return actions
+	}
+
+	// ack keeps the suppress and clear buttons
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_ack", time.Now()))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	msg := <-responses
+	assert.Equal(t, true, msg["replace_original"])
+	assert.Equal(t, []string{"am_suppress_1h", "am_suppress_4h", "am_clear"}, buttons(msg))
+	data, _ := json.Marshal(msg)
+	assert.Contains(t, string(data), "Acknowledged by foo")
+	assert.Contains(t, string(data), "*Owner*\\nfoo")
+
+	// suppress removes all buttons
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_suppress_4h", time.Now()))
+	msg = <-responses
+	assert.Equal(t, "[INFO][SUPPRESSED] ", msg["text"])
+	assert.Empty(t, buttons(msg))
+	data, _ = json.Marshal(msg)
+	assert.Contains(t, string(data), "Suppressed by foo for 4h0m0s")
+
+	// clear
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_clear", time.Now()))
+	msg = <-responses
+	assert.Equal(t, "[INFO][CLEARED] ", msg["text"])
+	assert.Equal(t, "good", msg["attachments"].([]interface{})[0].(map[string]interface{})["color"])
+
+	// unknown actions are reported back to the user
+	rr = httptest.NewRecorder()
+	s.SlackAction(rr, slackRequest("secret", ts.URL, "am_foo", time.Now()))
+	msg = <-responses
+	assert.Equal(t, "ephemeral", msg["response_type"])
+	assert.Equal(t, false, msg["replace_original"])
+}
@@ -1,12 +1,16 @@
 package alert_manager
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/golang/glog"
 	"github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/reporting"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
+	"github.com/mayuresh82/alert_manager/listener"
+	"github.com/mayuresh82/alert_manager/listener/parsers"
 	"github.com/mayuresh82/alert_manager/plugins"
 	"github.com/mitchellh/mapstructure"
 )
@@ -28,6 +32,8 @@ type ApiConfig struct {
 	LdapBinduser  string        `mapstructure:"ldap_binduser"`
 	LdapBindpass  string        `mapstructure:"ldap_bindpass"`
 	ServerTimeout time.Duration `mapstructure:"server_timeout"`
+	// SlackSigningSecret enables interactive slack actions on /api/slack/actions
+	SlackSigningSecret string `mapstructure:"slack_signing_secret"`
 }
 
 type DbConfig struct {
@@ -37,10 +43,13 @@ type DbConfig struct {
 }
 
 type Config struct {
-	Agent    *AgentConfig
-	Api      *ApiConfig
-	Db       *DbConfig
-	Reporter *reporting.InfluxReporter
+	Agent *AgentConfig
+	Api   *ApiConfig
+	Db    *DbConfig
+	// Reporters are the configured stats reporters
+	Reporters []reporting.Reporter
+	// Tracing exports traces of alerts if configured
+	Tracing *tracing.OtlpExporter
 }
 
 func (c *Config) UnmarshalTOML(data interface{}) error {
@@ -74,13 +83,36 @@ func (c *Config) UnmarshalTOML(data interface{}) error {
 			}
 			c.Db = d
 		case "reporter":
-			r := &reporting.InfluxReporter{}
+			// the single [reporter] section configures the influx reporter
+			r := reporting.Reporters["influx"]
 			decoderConfig.Result = r
 			decoder, _ := mapstructure.NewDecoder(decoderConfig)
 			if err := decoder.Decode(v); err != nil {
 				return err
 			}
-			c.Reporter = r
+			c.addReporter(r)
+		case "reporters":
+			for rKey, rValue := range v {
+				rv, _ := rValue.(map[string]interface{})
+				r, ok := reporting.Reporters[rKey]
+				if !ok {
+					return fmt.Errorf("Unknown reporter %s", rKey)
+				}
+				decoderConfig.Result = r
+				decoder, _ := mapstructure.NewDecoder(decoderConfig)
+				if err := decoder.Decode(rv); err != nil {
+					return err
+				}
+				c.addReporter(r)
+			}
+		case "tracing":
+			t := &tracing.OtlpExporter{}
+			decoderConfig.Result = t
+			decoder, _ := mapstructure.NewDecoder(decoderConfig)
+			if err := decoder.Decode(v); err != nil {
+				return err
+			}
+			c.Tracing = t
 		case "listeners":
 			for lisKey, lisValue := range v {
 				lv, _ := lisValue.(map[string]interface{})
@@ -90,7 +122,35 @@ func (c *Config) UnmarshalTOML(data interface{}) error {
 					if err := decoder.Decode(lv); err != nil {
 						return err
 					}
+					if c, ok := listener.(plugins.Configurable); ok {
+						if err := c.Init(); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		case "parsers":
+			for pKey, pValue := range v {
+				pv, _ := pValue.(map[string]interface{})
+				if parser := listener.GetParser(pKey); parser != nil {
+					decoderConfig.Result = parser
+					decoder, _ := mapstructure.NewDecoder(decoderConfig)
+					if err := decoder.Decode(pv); err != nil {
+						return err
+					}
+					continue
 				}
+				// sections that do not configure a built-in parser define a new one
+				parser := parsers.NewConfigParser(pKey)
+				decoderConfig.Result = parser
+				decoder, _ := mapstructure.NewDecoder(decoderConfig)
+				if err := decoder.Decode(pv); err != nil {
+					return err
+				}
+				if err := parser.Init(); err != nil {
+					return err
+				}
+				listener.AddParser(parser)
 			}
 		case "outputs":
 			for rKey, rValue := range v {
@@ -101,6 +161,11 @@ func (c *Config) UnmarshalTOML(data interface{}) error {
 					if err := decoder.Decode(rv); err != nil {
 						return err
 					}
+					if c, ok := receiver.(plugins.Configurable); ok {
+						if err := c.Init(); err != nil {
+							return err
+						}
+					}
 				}
 			}
 		case "processors":
@@ -132,6 +197,15 @@ func (c *Config) UnmarshalTOML(data interface{}) error {
 	return nil
 }
 
+func (c *Config) addReporter(r reporting.Reporter) {
+	for _, existing := range c.Reporters {
+		if existing == r {
+			return
+		}
+	}
+	c.Reporters = append(c.Reporters, r)
+}
+
 func NewConfig(configFile string) *Config {
 	config := &Config{}
 	if _, err := toml.DecodeFile(configFile, config); err != nil {
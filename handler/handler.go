@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/mayuresh82/alert_manager/internal/models"
 	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
@@ -93,8 +95,12 @@ func (h *AlertHandler) Start(ctx context.Context) {
 	for {
 		select {
 		case alertEvent := <-ListenChan:
+			// continue the trace started by the listener
+			span := tracing.StartSpan(alertEvent.Alert.Trace, "handler."+strings.ToLower(alertEvent.Type.String()))
+			span.SetAttribute("alert_name", alertEvent.Alert.Name)
+			tctx := tracing.ContextWithSpanContext(ctx, span.Context)
 			tx := h.Db.NewTx()
-			err := models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
+			err := models.WithTx(tctx, tx, func(ctx context.Context, tx models.Txn) error {
 				alert := alertEvent.Alert
 
 				switch alertEvent.Type {
@@ -107,7 +113,9 @@ func (h *AlertHandler) Start(ctx context.Context) {
 			})
 			if err != nil {
 				glog.Errorf("Unable to Handle Alert: %v", err)
+				span.SetError(err)
 			}
+			span.End()
 
 		case <-ctx.Done():
 			glog.V(4).Infof("Closing handler listen loop")
@@ -124,11 +132,11 @@ func (h *AlertHandler) handleActive(ctx context.Context, tx models.Txn, alert *m
 		glog.V(2).Infof("No existing alert found for %s:%s:%s", alert.Name, alert.Device.String, alert.Entity)
 		// add transforms
 		alert.ExtendLabels()
-		h.applyTransforms(alert)
+		h.applyTransforms(ctx, alert)
 		labels = alert.Labels
 	} else {
 		existingAlert.ExtendLabels()
-		h.applyTransforms(existingAlert)
+		h.applyTransforms(ctx, existingAlert)
 		labels = existingAlert.Labels
 	}
 	// check if alert matches an existing suppression rule based on alert labels
@@ -137,7 +145,8 @@ func (h *AlertHandler) handleActive(ctx context.Context, tx models.Txn, alert *m
 		return nil
 	}
 	if existingAlert != nil {
-		return h.reactivateAlert(tx, existingAlert)
+		existingAlert.ReceivedAt = alert.ReceivedAt
+		return h.reactivateAlert(ctx, tx, existingAlert)
 	}
 	// new alert
 	if !h.Teams.Contains(alert.Team) {
@@ -160,10 +169,10 @@ func (h *AlertHandler) handleActive(ctx context.Context, tx models.Txn, alert *m
 	}
 	alert.Id = newId
 	glog.V(2).Infof("Received alert with ID: %v", alert.Id)
-	tx.NewRecord(newId, fmt.Sprintf("Alert created from source %s with severity %s",
+	models.AddRecord(ctx, tx, newId, fmt.Sprintf("Alert created from source %s with severity %s",
 		alert.Source, alert.Severity.String()))
 	// Send to interested parties
-	h.notifyReceivers(alert, models.EventType_ACTIVE)
+	h.notifyReceivers(ctx, alert, models.EventType_ACTIVE)
 	return nil
 }
 
@@ -178,6 +187,7 @@ func (h *AlertHandler) handleClear(ctx context.Context, tx models.Txn, alert *mo
 		// already cleared
 		return nil
 	}
+	existingAlert.ReceivedAt = alert.ReceivedAt
 	if !existingAlert.AutoClear {
 		glog.V(2).Infof("Not auto-clearing alert %d ", existingAlert.Id)
 		return nil
@@ -226,7 +236,7 @@ func (h *AlertHandler) GetExisting(tx models.Txn, alert *models.Alert) (*models.
 	return existing, nil
 }
 
-func (h *AlertHandler) reactivateAlert(tx models.Txn, existingAlert *models.Alert) error {
+func (h *AlertHandler) reactivateAlert(ctx context.Context, tx models.Txn, existingAlert *models.Alert) error {
 	// reactivate the alert and the agg alert if applicable and extend the expiry time if alert already exists
 	toUpdate := models.Alerts{existingAlert}
 	toNotify := existingAlert
@@ -235,6 +245,7 @@ func (h *AlertHandler) reactivateAlert(tx models.Txn, existingAlert *models.Aler
 		if err != nil {
 			return fmt.Errorf("Failed to get alert %d: %v", existingAlert.AggregatorId, err)
 		}
+		agg.ReceivedAt = existingAlert.ReceivedAt
 		toNotify = agg
 		toUpdate = append(toUpdate, agg)
 	}
@@ -255,16 +266,16 @@ func (h *AlertHandler) reactivateAlert(tx models.Txn, existingAlert *models.Aler
 	if alreadyActive {
 		return nil
 	}
-	tx.NewRecord(existingAlert.Id, "Alert re-activated")
+	models.AddRecord(ctx, tx, existingAlert.Id, "Alert re-activated")
 	if existingAlert.AggregatorId != 0 {
-		tx.NewRecord(existingAlert.AggregatorId, fmt.Sprintf("Alert re-activated due to component alert %d", existingAlert.Id))
+		models.AddRecord(ctx, tx, existingAlert.AggregatorId, fmt.Sprintf("Alert re-activated due to component alert %d", existingAlert.Id))
 	}
 	toNotify.Status = models.Status_ACTIVE
-	h.notifyReceivers(toNotify, models.EventType_ACTIVE)
+	h.notifyReceivers(ctx, toNotify, models.EventType_ACTIVE)
 	return nil
 }
 
-func (h *AlertHandler) applyTransforms(alert *models.Alert) {
+func (h *AlertHandler) applyTransforms(ctx context.Context, alert *models.Alert) {
 	// apply transforms in order of priority. Lower == first
 	var toApply []Transform
 	for _, transform := range Transforms {
@@ -291,24 +302,33 @@ func (h *AlertHandler) applyTransforms(alert *models.Alert) {
 		}
 	}()
 	for _, xform := range toApply {
-		glog.V(2).Infof("Applying Transform: %s to alert %s", xform.Name(), alert.Name)
+		h.applyTransform(ctx, xform, alert)
+	}
+}
+
+func (h *AlertHandler) applyTransform(ctx context.Context, xform Transform, alert *models.Alert) {
+	_, span := tracing.Start(ctx, "transform."+xform.Name())
+	defer span.End()
+	glog.V(2).Infof("Applying Transform: %s to alert %s", xform.Name(), alert.Name)
+	if err := xform.Apply(alert); err != nil {
+		glog.Errorf("Failed to apply transform %s to alert %s: %v, retrying..", xform.Name(), alert.Name, err)
 		if err := xform.Apply(alert); err != nil {
-			glog.Errorf("Failed to apply transform %s to alert %s: %v, retrying..", xform.Name(), alert.Name, err)
-			if err := xform.Apply(alert); err != nil {
-				glog.Errorf("Failed to apply transform %s to alert %s: %v", xform.Name(), alert.Name, err)
-				h.statTransformError.Add(1)
-			}
+			glog.Errorf("Failed to apply transform %s to alert %s: %v", xform.Name(), alert.Name, err)
+			h.statTransformError.Add(1)
+			span.SetError(err)
 		}
 	}
 }
 
-func (h *AlertHandler) notifyReceivers(alert *models.Alert, eventType models.EventType) {
+func (h *AlertHandler) notifyReceivers(ctx context.Context, alert *models.Alert, eventType models.EventType) {
+	// processors continue the trace of the handler
+	alert.Trace = tracing.SpanContextFromContext(ctx)
 	event := &models.AlertEvent{Alert: alert, Type: eventType}
 	// send the alert down the processor pipeline
 	if len(plugins.Processors) > 0 {
 		h.procChan <- event
 	}
-	plugins.Send("influx", event)
+	plugins.Send(ctx, "influx", event)
 }
 
 func (h *AlertHandler) handleExpiry(ctx context.Context) {
@@ -328,9 +348,9 @@ func (h *AlertHandler) handleExpiry(ctx context.Context) {
 			if err := tx.UpdateAlert(ex); err != nil {
 				return err
 			}
-			tx.NewRecord(ex.Id, "Alert expired")
+			models.AddRecord(ctx, tx, ex.Id, "Alert expired")
 			toSend := ex // this copy needed to avoid overwriting
-			h.notifyReceivers(toSend, models.EventType_EXPIRED)
+			h.notifyReceivers(ctx, toSend, models.EventType_EXPIRED)
 		}
 		return nil
 	})
@@ -367,14 +387,14 @@ func (h *AlertHandler) handleEscalation(ctx context.Context) {
 					if err := tx.UpdateAlert(alert); err != nil {
 						return err
 					}
-					tx.NewRecord(alert.Id, fmt.Sprintf(
+					models.AddRecord(ctx, tx, alert.Id, fmt.Sprintf(
 						"Alert severity escalated to %s", newSev.String()))
 					break
 				}
 			}
 			if changed {
 				toSend := alert // this copy needed to avoid overwriting
-				h.notifyReceivers(toSend, models.EventType_ESCALATED)
+				h.notifyReceivers(ctx, toSend, models.EventType_ESCALATED)
 			}
 		}
 		return nil
@@ -405,8 +425,8 @@ func (h *AlertHandler) Suppress(
 				return fmt.Errorf("Unable to suppress alert %d: %v", a.Id, err)
 			}
 		}
-		tx.NewRecord(alert.Id, fmt.Sprintf("Alert Suppressed by %s for %v : %s", creator, duration, reason))
-		h.notifyReceivers(alert, models.EventType_SUPPRESSED)
+		models.AddRecord(ctx, tx, alert.Id, fmt.Sprintf("Alert Suppressed by %s for %v : %s", creator, duration, reason))
+		h.notifyReceivers(ctx, alert, models.EventType_SUPPRESSED)
 		return h.Suppressor.SuppressAlert(ctx, tx, alert, duration)
 	}
 	if err := h.Suppressor.SuppressAlert(ctx, tx, alert, duration); err != nil {
@@ -421,9 +441,9 @@ func (h *AlertHandler) Suppress(
 	if _, err := h.AddSuppRule(ctx, tx, r); err != nil {
 		return fmt.Errorf("Failed to suppress alert: %v", err)
 	}
-	tx.NewRecord(alert.Id, fmt.Sprintf("Alert Suppressed by %s for %v : %s", creator, duration, reason))
+	models.AddRecord(ctx, tx, alert.Id, fmt.Sprintf("Alert Suppressed by %s for %v : %s", creator, duration, reason))
 	if notify {
-		h.notifyReceivers(alert, models.EventType_SUPPRESSED)
+		h.notifyReceivers(ctx, alert, models.EventType_SUPPRESSED)
 	}
 	return nil
 }
@@ -434,9 +454,9 @@ func (h *AlertHandler) Clear(ctx context.Context, tx models.Txn, alert *models.A
 		h.statDbError.Add(1)
 		return err
 	}
-	tx.NewRecord(alert.Id, "Alert cleared")
+	models.AddRecord(ctx, tx, alert.Id, "Alert cleared")
 	if notify {
-		h.notifyReceivers(alert, models.EventType_CLEARED)
+		h.notifyReceivers(ctx, alert, models.EventType_CLEARED)
 	}
 	return nil
 }
@@ -451,10 +471,10 @@ func (h *AlertHandler) SetOwner(ctx context.Context, tx models.Txn, alert *model
 		h.statDbError.Add(1)
 		return err
 	}
-	tx.NewRecord(alert.Id, fmt.Sprintf("Alert owner set to %s, team set to %s", name, teamName))
+	models.AddRecord(ctx, tx, alert.Id, fmt.Sprintf("Alert owner set to %s, team set to %s", name, teamName))
 	// Notify all the receivers
 	if notify {
-		h.notifyReceivers(alert, models.EventType_ACKD)
+		h.notifyReceivers(ctx, alert, models.EventType_ACKD)
 	}
 	return nil
 }
@@ -472,9 +492,9 @@ func (h *AlertHandler) DeleteSuppRule(ctx context.Context, tx models.Txn, id int
 // Escalate bumps up alert severity
 func (h *AlertHandler) Escalate(ctx context.Context, tx models.Txn, alert *models.Alert, newSev models.AlertSeverity, notify bool) error {
 	alert.Severity = newSev
-	tx.NewRecord(alert.Id, fmt.Sprintf("Alert severity escalated to %s", newSev.String()))
+	models.AddRecord(ctx, tx, alert.Id, fmt.Sprintf("Alert severity escalated to %s", newSev.String()))
 	if notify {
-		h.notifyReceivers(alert, models.EventType_ESCALATED)
+		h.notifyReceivers(ctx, alert, models.EventType_ESCALATED)
 	}
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 	tu "github.com/mayuresh82/alert_manager/testutil"
 	"github.com/stretchr/testify/assert"
@@ -193,6 +194,38 @@ func TestHandlerAlertActiveNew(t *testing.T) {
 	assert.Equal(t, h.Teams.Contains("t2"), true)
 }
 
+func TestHandlerTracing(t *testing.T) {
+	exp := &tracing.InMemoryExporter{}
+	tracing.SetExporter(exp)
+	defer tracing.SetExporter(nil)
+	h := NewTestHandler(1)
+	tx := h.Db.NewTx()
+	var records []*models.Record
+	tx.(*MockTx).newInsert = func(query string, item interface{}) (int64, error) {
+		if r, ok := item.(*models.Record); ok {
+			records = append(records, r)
+		}
+		return 999, nil
+	}
+	ctx, span := tracing.Start(context.Background(), "handler.active")
+	new := tu.MockAlert(0, "New Alert 8", "", "d8", "e8", "src8", "scp8", "t1", "8", "WARN", []string{}, nil)
+	err := h.handleActive(ctx, tx, new)
+	assert.Nil(t, err)
+	span.End()
+
+	// transforms are children of the handler span
+	xforms := exp.Find("transform.mock")
+	assert.Equal(t, len(xforms), 1)
+	assert.Equal(t, xforms[0].Context.TraceId, span.Context.TraceId)
+	assert.Equal(t, xforms[0].ParentId, span.Context.SpanId)
+	// the trace id is stored in the alert history
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].TraceId, span.Context.TraceId.String())
+	// processors continue the trace of the handler
+	event := <-h.procChan
+	assert.Equal(t, event.Alert.Trace, span.Context)
+}
+
 func TestHandlerAlertActiveExisting(t *testing.T) {
 	h := NewTestHandler(1)
 	tx := h.Db.NewTx()
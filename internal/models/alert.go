@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/lib/pq"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 )
 
 var (
@@ -54,6 +55,7 @@ var (
     creator = 'alert_manager' AND
     (cast(extract(epoch from now()) as integer) - created_at) < duration
   )`
+	QueryActiveCounts = "SELECT team, severity, count(*) AS count FROM alerts WHERE status=1 GROUP BY team, severity"
 )
 
 type AlertSeverity int
@@ -119,6 +121,10 @@ type Alert struct {
 	Status       AlertStatus
 	Labels       Labels // json encoded k-v labels
 	History      []*Record
+	// ReceivedAt is when the alert was received by a listener, it is not stored
+	ReceivedAt time.Time `db:"-"`
+	// Trace is the span of the last stage that handled the alert, it is not stored
+	Trace tracing.SpanContext `db:"-"`
 }
 
 // custom Marshaler interface for Alert
@@ -354,3 +360,17 @@ func (tx *Tx) SelectAlertsWithHistory(query string, args ...interface{}) (Alerts
 	}
 	return alerts, nil
 }
+
+// AlertCount is the number of alerts of a team with a severity
+type AlertCount struct {
+	Team     string
+	Severity AlertSeverity
+	Count    int64
+}
+
+// ActiveAlertCounts returns the number of active alerts per team and severity
+func ActiveAlertCounts(tx Txn) ([]*AlertCount, error) {
+	var counts []*AlertCount
+	err := tx.InSelect(QueryActiveCounts, &counts)
+	return counts, err
+}
@@ -1,13 +1,16 @@
 package models
 
 import (
+	"context"
 	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 )
 
 var (
 	QueryInsertNewRecord = `INSERT INTO alert_history (
-		alert_id, timestamp, event
-	) VALUES (:alert_id, :timestamp, :event) RETURNING id`
+		alert_id, timestamp, event, trace_id
+	) VALUES (:alert_id, :timestamp, :event, :trace_id) RETURNING id`
 
 	QueryAlertHistory = "SELECT * from alert_history WHERE alert_id IN (?) ORDER BY alert_id, id"
 )
@@ -17,6 +20,8 @@ type Record struct {
 	AlertId   int64 `db:"alert_id"`
 	Timestamp MyTime
 	Event     string
+	// TraceId is the id of the trace of the alert when the record was added, if any
+	TraceId string `db:"trace_id"`
 }
 
 func NewRecord(alertId int64, event string) *Record {
@@ -29,6 +34,15 @@ func (tx *Tx) NewRecord(alertId int64, event string) (int64, error) {
 	return tx.NewInsert(QueryInsertNewRecord, NewRecord(alertId, event))
 }
 
+// AddRecord adds a history record for the alert that references the trace in ctx, if any
+func AddRecord(ctx context.Context, tx Txn, alertId int64, event string) (int64, error) {
+	record := NewRecord(alertId, event)
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		record.TraceId = sc.TraceId.String()
+	}
+	return tx.NewInsert(QueryInsertNewRecord, record)
+}
+
 func (tx *Tx) AddAlertHistory(alerts Alerts) error {
 	var allRecords []*Record
 	var ids []int64
@@ -0,0 +1,50 @@
+package models
+
+var (
+	QueryUpsertOutputMessage = `INSERT INTO output_messages (
+		alert_id, output, channel, message_id
+	) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (alert_id, output) DO UPDATE SET channel=EXCLUDED.channel, message_id=EXCLUDED.message_id`
+
+	QuerySelectOutputMessage = "SELECT * FROM output_messages WHERE alert_id=? AND output=?"
+
+	QuerySelectOutputMessageById = "SELECT * FROM output_messages WHERE output=? AND message_id=? ORDER BY alert_id DESC LIMIT 1"
+)
+
+// OutputMessage references a message posted by an output for an alert, so that later
+// events for the alert can update or reply to it.
+type OutputMessage struct {
+	AlertId   int64 `db:"alert_id"`
+	Output    string
+	Channel   string
+	MessageId string `db:"message_id"`
+}
+
+// GetOutputMessage returns the message posted by the output for the alert, or nil if none
+func GetOutputMessage(tx Txn, alertId int64, output string) (*OutputMessage, error) {
+	var msgs []*OutputMessage
+	if err := tx.InSelect(QuerySelectOutputMessage, &msgs, alertId, output); err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return msgs[0], nil
+}
+
+// FindOutputMessage returns the latest message posted by the output with the message id, or nil if none
+func FindOutputMessage(tx Txn, output, messageId string) (*OutputMessage, error) {
+	var msgs []*OutputMessage
+	if err := tx.InSelect(QuerySelectOutputMessageById, &msgs, output, messageId); err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return msgs[0], nil
+}
+
+// SaveOutputMessage stores the message posted by an output, replacing any existing one
+func SaveOutputMessage(tx Txn, msg *OutputMessage) error {
+	return tx.Exec(QueryUpsertOutputMessage, msg.AlertId, msg.Output, msg.Channel, msg.MessageId)
+}
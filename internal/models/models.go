@@ -10,6 +10,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/jmoiron/sqlx"
+	"github.com/mayuresh82/alert_manager/internal/stats"
 	tpl "github.com/mayuresh82/alert_manager/template"
 )
 
@@ -66,6 +67,7 @@ type Txn interface {
 	SelectTeams(query string, args ...interface{}) (Teams, error)
 	SelectUsers(query string, args ...interface{}) (Users, error)
 	GetUser(username string) (User, error)
+	SelectWebhookTokens(query string, args ...interface{}) (WebhookTokens, error)
 	SelectFieldDistinctFromDb(query string, args ...interface{}) ([]string, error)
 	Rollback() error
 	Commit() error
@@ -99,8 +101,11 @@ func (tx *Tx) Exec(query string, args ...interface{}) error {
 	return err
 }
 
+var statTxDuration = stats.NewHistogram("db.transaction_duration_seconds", nil)
+
 // WithTx wraps a transaction around a function call.
 func WithTx(ctx context.Context, tx Txn, cb func(ctx context.Context, tx Txn) error) error {
+	defer statTxDuration.ObserveSince(time.Now())
 	err := cb(ctx, tx)
 	if err != nil {
 		tx.Rollback()
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+var (
+	QueryInsertWebhookToken = `INSERT INTO
+    webhook_tokens (
+      name, source, team, token_hash, created_at, creator
+    ) VALUES (
+    :name, :source, :team, :token_hash, :created_at, :creator
+    ) RETURNING id`
+
+	QuerySelectWebhookTokens      = "SELECT * FROM webhook_tokens ORDER BY id"
+	QuerySelectWebhookTokenByHash = "SELECT * FROM webhook_tokens WHERE token_hash=$1"
+	QuerySelectWebhookTokenById   = "SELECT * FROM webhook_tokens WHERE id=$1"
+	QueryDeleteWebhookToken       = "DELETE FROM webhook_tokens WHERE id=$1"
+)
+
+// WebhookToken is a bearer token accepted by the webhook listener. Only the hash of the
+// token is stored. A token with a source or team only authorizes alerts of that source or
+// team.
+type WebhookToken struct {
+	Id        int64  `json:"id"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	Team      string `json:"team"`
+	TokenHash string `db:"token_hash" json:"-"`
+	CreatedAt MyTime `db:"created_at" json:"created_at"`
+	Creator   string `json:"creator"`
+	// Token is the plain token, only set when the token is created
+	Token string `db:"-" json:"token,omitempty"`
+}
+
+// HashToken returns the hex sha256 hash of a token as stored in the DB
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewWebhookToken generates a new random token for the source and team
+func NewWebhookToken(name, source, team, creator string) (*WebhookToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	return &WebhookToken{
+		Name:      name,
+		Source:    source,
+		Team:      team,
+		TokenHash: HashToken(token),
+		CreatedAt: MyTime{time.Now()},
+		Creator:   creator,
+		Token:     token,
+	}, nil
+}
+
+// Authorizes returns true if the token is valid for alerts of the source and team
+func (t *WebhookToken) Authorizes(source, team string) bool {
+	return (t.Source == "" || t.Source == source) && (t.Team == "" || t.Team == team)
+}
+
+type WebhookTokens []*WebhookToken
+
+func (tx *Tx) SelectWebhookTokens(query string, args ...interface{}) (WebhookTokens, error) {
+	var tokens WebhookTokens
+	err := tx.Select(&tokens, query, args...)
+	return tokens, err
+}
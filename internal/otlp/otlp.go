@@ -0,0 +1,88 @@
+// Package otlp holds the types and the transport shared by the OpenTelemetry trace and metric
+// exporters, which send OTLP/HTTP requests with json encoding.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultServiceName = "alert_manager"
+	DefaultTimeout     = 5 * time.Second
+)
+
+type Value struct {
+	StringValue string `json:"stringValue"`
+}
+
+type Attribute struct {
+	Key   string `json:"key"`
+	Value Value  `json:"value"`
+}
+
+type Scope struct {
+	Name string `json:"name"`
+}
+
+type Resource struct {
+	Attributes []Attribute `json:"attributes"`
+}
+
+// Attributes converts the map to string attributes sorted by key
+func Attributes(attrs map[string]string) []Attribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var converted []Attribute
+	for _, k := range keys {
+		converted = append(converted, Attribute{Key: k, Value: Value{StringValue: attrs[k]}})
+	}
+	return converted
+}
+
+// ServiceResource returns the resource of the named service, DefaultServiceName if empty
+func ServiceResource(serviceName string) Resource {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	return Resource{Attributes: Attributes(map[string]string{"service.name": serviceName})}
+}
+
+// Post sends the json encoded request to the collector url with the headers added. The
+// DefaultTimeout is used if timeout is 0.
+func Post(url string, headers map[string]string, timeout time.Duration, req interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	c := &http.Client{Timeout: timeout}
+	resp, err := c.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("Unable to post to otlp collector: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unable to post to otlp collector: Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -2,13 +2,12 @@ package reporting
 
 import (
 	"bytes"
-	"context"
 	"fmt"
-	"github.com/golang/glog"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/golang/glog"
 )
 
 type Datapoint struct {
@@ -16,6 +15,7 @@ type Datapoint struct {
 	Tags        map[string]string
 	Fields      map[string]interface{}
 	TimeStamp   time.Time
+	Kind        Kind
 }
 
 var DataChan = make(chan *Datapoint)
@@ -51,69 +51,47 @@ func (d *Datapoint) formatLineProtocol() (string, error) {
 }
 
 type InfluxReporter struct {
-	Url           string
-	FlushInterval time.Duration `mapstructure:"flush_interval"`
-
-	buffer []string
-	sync.Mutex
+	ReporterConfig `mapstructure:",squash"`
+	// Url is the influxdb write url, "stdout" prints to screen
+	Url string
 }
 
-func (n *InfluxReporter) addToBuffer(data string) {
-	n.Lock()
-	defer n.Unlock()
-	n.buffer = append(n.buffer, data)
+func (n *InfluxReporter) Name() string {
+	return "influx"
 }
 
-func (n *InfluxReporter) flush() {
-	n.Lock()
-	defer n.Unlock()
-	if len(n.buffer) == 0 {
-		return
+func (n *InfluxReporter) Write(points []*Datapoint) error {
+	var lines []string
+	for _, d := range points {
+		line, err := d.formatLineProtocol()
+		if err != nil {
+			glog.Errorf("%v", err)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil
 	}
-	data := strings.Join(n.buffer, "\n")
+	data := strings.Join(lines, "\n")
 	if n.Url == "stdout" {
 		fmt.Println(data)
-		n.buffer = n.buffer[:0]
-		return
+		return nil
 	}
 	c := &http.Client{
 		Timeout: 2 * time.Second,
 	}
 	resp, err := c.Post(n.Url, "binary/octet-stream", bytes.NewBuffer([]byte(data)))
 	if err != nil {
-		//n.statsPostError.Add(1)
-		glog.Errorf("Output: Unable to post to influx: %v", err)
-		return
+		return fmt.Errorf("Unable to post to influx: %v", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		//n.statsPostError.Add(1)
-		glog.Errorf("Output: Unable to post to influx: Got HTTP %d", resp.StatusCode)
+		return fmt.Errorf("Unable to post to influx: Got HTTP %d", resp.StatusCode)
 	}
-	//n.statPostsSent.Add(1)
-	n.buffer = n.buffer[:0]
+	return nil
 }
 
-func (n *InfluxReporter) handleFlush() {
-	t := time.NewTicker(n.FlushInterval)
-	for {
-		<-t.C
-		n.flush()
-	}
-}
-
-func (n *InfluxReporter) Start(ctx context.Context) {
-	go n.handleFlush()
-	for {
-		select {
-		case datapoint := <-DataChan:
-			data, err := datapoint.formatLineProtocol()
-			if err != nil {
-				glog.Errorf("%v", err)
-				break
-			}
-			n.addToBuffer(data)
-		case <-ctx.Done():
-			return
-		}
-	}
+func init() {
+	AddReporter(&InfluxReporter{})
 }
@@ -58,13 +58,17 @@ func TestInfluxReporter(t *testing.T) {
 
 	r := &InfluxReporter{Url: ts.URL}
 
-	var out []string
+	var (
+		out    []string
+		points []*Datapoint
+	)
 	for dp, str := range testDatas {
 		out = append(out, str)
-		data, _ := dp.formatLineProtocol()
-		r.addToBuffer(data)
+		points = append(points, dp)
 	}
 	expected := strings.Join(out, "\n")
-	r.flush()
+	if err := r.Write(points); err != nil {
+		t.Fatal(err)
+	}
 	assert.Equal(t, string(body), expected)
 }
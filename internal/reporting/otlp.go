@@ -0,0 +1,144 @@
+package reporting
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/otlp"
+)
+
+const (
+	otlpDefaultUrl = "http://localhost:4318/v1/metrics"
+
+	// aggregation temporalities of otlp sums
+	otlpDelta      = 1
+	otlpCumulative = 2
+)
+
+type otlpDatapoint struct {
+	Attributes   []otlp.Attribute `json:"attributes,omitempty"`
+	TimeUnixNano string           `json:"timeUnixNano"`
+	AsInt        string           `json:"asInt,omitempty"`
+	AsDouble     *float64         `json:"asDouble,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []*otlpDatapoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []*otlpDatapoint `json:"dataPoints"`
+	AggregationTemporality int              `json:"aggregationTemporality"`
+	IsMonotonic            bool             `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlp.Scope    `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlp.Resource       `json:"resource"`
+	ScopeMetrics []*otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []*otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// OtlpReporter sends datapoints as OpenTelemetry metrics using OTLP/HTTP with json encoding
+type OtlpReporter struct {
+	ReporterConfig `mapstructure:",squash"`
+	Url            string
+	// Headers are added to each request, e.g. for authentication
+	Headers     map[string]string
+	ServiceName string `mapstructure:"service_name"`
+	Timeout     time.Duration
+}
+
+func (o *OtlpReporter) Name() string {
+	return "otlp"
+}
+
+// metrics converts the datapoints to otlp metrics named <measurement>.<field>
+func (o *OtlpReporter) metrics(points []*Datapoint) ([]*otlpMetric, error) {
+	byName := make(map[string]*otlpMetric)
+	var names []string
+	for _, d := range points {
+		for field, value := range d.Fields {
+			dp := &otlpDatapoint{
+				Attributes:   otlp.Attributes(d.Tags),
+				TimeUnixNano: strconv.FormatInt(d.TimeStamp.UnixNano(), 10),
+			}
+			switch v := value.(type) {
+			case int:
+				dp.AsInt = strconv.Itoa(v)
+			case int64:
+				dp.AsInt = strconv.FormatInt(v, 10)
+			case float64:
+				dp.AsDouble = &v
+			default:
+				return nil, fmt.Errorf("Cant format field %s: Need numeric value", field)
+			}
+			name := d.Measurement + "." + field
+			m, ok := byName[name]
+			if !ok {
+				m = &otlpMetric{Name: name}
+				switch d.Kind {
+				case Gauge:
+					m.Gauge = &otlpGauge{}
+				case Cumulative:
+					m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+				case Delta:
+					m.Sum = &otlpSum{AggregationTemporality: otlpDelta, IsMonotonic: true}
+				}
+				byName[name] = m
+				names = append(names, name)
+			}
+			if m.Gauge != nil {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+			} else {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+			}
+		}
+	}
+	sort.Strings(names)
+	metrics := make([]*otlpMetric, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, byName[name])
+	}
+	return metrics, nil
+}
+
+func (o *OtlpReporter) Write(points []*Datapoint) error {
+	metrics, err := o.metrics(points)
+	if err != nil {
+		return err
+	}
+	req := &otlpRequest{
+		ResourceMetrics: []*otlpResourceMetrics{{
+			Resource: otlp.ServiceResource(o.ServiceName),
+			ScopeMetrics: []*otlpScopeMetrics{{
+				Scope:   otlp.Scope{Name: otlp.DefaultServiceName},
+				Metrics: metrics,
+			}},
+		}},
+	}
+	url := o.Url
+	if url == "" {
+		url = otlpDefaultUrl
+	}
+	return otlp.Post(url, o.Headers, o.Timeout, req)
+}
+
+func init() {
+	AddReporter(&OtlpReporter{})
+}
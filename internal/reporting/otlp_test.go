@@ -0,0 +1,63 @@
+package reporting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/otlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOtlpReporter(t *testing.T) {
+	var (
+		req    otlpRequest
+		header http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer ts.Close()
+	r := &OtlpReporter{Url: ts.URL, Headers: map[string]string{"Authorization": "Bearer xyz"}}
+	now := time.Unix(1136239445, 0)
+	points := []*Datapoint{
+		{Measurement: "am_stats", Fields: map[string]interface{}{"api.gets": int64(10)}, TimeStamp: now, Kind: Cumulative},
+		{Measurement: "am_stats", Fields: map[string]interface{}{"internal.num_goroutines": 12}, TimeStamp: now},
+		{Measurement: "am_stats", Fields: map[string]interface{}{"db.transaction_duration_seconds.sum": 0.5}, TimeStamp: now},
+		{Measurement: "alerts", Tags: map[string]string{"team": "neteng"}, Fields: map[string]interface{}{"num_active": 1}, TimeStamp: now, Kind: Delta},
+	}
+	if err := r.Write(points); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.Equal(t, header.Get("Authorization"), "Bearer xyz")
+	rm := req.ResourceMetrics[0]
+	assert.Equal(t, rm.Resource.Attributes[0], otlp.Attribute{Key: "service.name", Value: otlp.Value{StringValue: "alert_manager"}})
+	metrics := rm.ScopeMetrics[0].Metrics
+	assert.Equal(t, len(metrics), 4)
+
+	assert.Equal(t, metrics[0].Name, "alerts.num_active")
+	assert.Equal(t, metrics[0].Sum.AggregationTemporality, otlpDelta)
+	assert.Equal(t, metrics[0].Sum.DataPoints[0].AsInt, "1")
+	assert.Equal(t, metrics[0].Sum.DataPoints[0].Attributes[0].Key, "team")
+	assert.Equal(t, metrics[0].Sum.DataPoints[0].TimeUnixNano, "1136239445000000000")
+
+	assert.Equal(t, metrics[1].Name, "am_stats.api.gets")
+	assert.Equal(t, metrics[1].Sum.AggregationTemporality, otlpCumulative)
+	assert.True(t, metrics[1].Sum.IsMonotonic)
+
+	assert.Equal(t, metrics[2].Name, "am_stats.db.transaction_duration_seconds.sum")
+	assert.Equal(t, *metrics[2].Gauge.DataPoints[0].AsDouble, 0.5)
+
+	assert.Equal(t, metrics[3].Name, "am_stats.internal.num_goroutines")
+	assert.Equal(t, metrics[3].Gauge.DataPoints[0].AsInt, "12")
+
+	// errors are returned so that the datapoints are kept
+	ts.Close()
+	assert.NotNil(t, r.Write(points))
+}
@@ -0,0 +1,171 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	defaultBufferSize    = 10000
+)
+
+// Kind is the type of value of a datapoint
+type Kind int
+
+const (
+	// Gauge is a point in time value
+	Gauge Kind = iota
+	// Cumulative is a counter value since start
+	Cumulative
+	// Delta is a counter increment
+	Delta
+)
+
+// ReporterConfig is the config common to all reporters
+type ReporterConfig struct {
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// BufferSize is the max number of datapoints kept between flushes or while the backend
+	// is unreachable, the oldest are dropped first
+	BufferSize int `mapstructure:"buffer_size"`
+	// Tags are added to all datapoints, tags of the datapoint take precedence
+	Tags map[string]string
+}
+
+func (c *ReporterConfig) Common() *ReporterConfig {
+	return c
+}
+
+// Reporter sends stats datapoints to a backend
+type Reporter interface {
+	Name() string
+	Common() *ReporterConfig
+	// Write sends a batch of datapoints. On error the datapoints are kept and sent on the next flush,
+	// a PartialWriteError keeps only its unsent datapoints.
+	Write(points []*Datapoint) error
+}
+
+// PartialWriteError is returned by Write when only part of the batch was sent
+type PartialWriteError struct {
+	Err    error
+	Unsent []*Datapoint
+}
+
+func (e *PartialWriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+var Reporters = make(map[string]Reporter)
+
+func AddReporter(r Reporter) {
+	Reporters[r.Name()] = r
+}
+
+// buffered buffers datapoints for a reporter and flushes them periodically
+type buffered struct {
+	Reporter
+	points []*Datapoint
+
+	sync.Mutex
+}
+
+func (b *buffered) size() int {
+	if size := b.Common().BufferSize; size > 0 {
+		return size
+	}
+	return defaultBufferSize
+}
+
+// add adds the configured tags to a copy of the datapoint and buffers it
+func (b *buffered) add(d *Datapoint) {
+	tags := b.Common().Tags
+	if len(tags) > 0 {
+		cp := *d
+		cp.Tags = make(map[string]string)
+		for k, v := range tags {
+			cp.Tags[k] = v
+		}
+		for k, v := range d.Tags {
+			cp.Tags[k] = v
+		}
+		d = &cp
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.points = append(b.points, d)
+	if drop := len(b.points) - b.size(); drop > 0 {
+		glog.Errorf("Reporter %s: Buffer full, dropping %d datapoints", b.Name(), drop)
+		b.points = b.points[drop:]
+	}
+}
+
+func (b *buffered) flush() {
+	b.Lock()
+	points := b.points
+	b.points = nil
+	b.Unlock()
+	if len(points) == 0 {
+		return
+	}
+	if err := b.Write(points); err != nil {
+		var partial *PartialWriteError
+		if errors.As(err, &partial) {
+			points = partial.Unsent
+		}
+		glog.Errorf("Reporter %s: Unable to send %d datapoints: %v", b.Name(), len(points), err)
+		// keep the failed datapoints ahead of newer ones
+		b.Lock()
+		b.points = append(points, b.points...)
+		if drop := len(b.points) - b.size(); drop > 0 {
+			b.points = b.points[drop:]
+		}
+		b.Unlock()
+	}
+}
+
+func (b *buffered) handleFlush(ctx context.Context) {
+	interval := b.Common().FlushInterval
+	if interval == 0 {
+		interval = defaultFlushInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.flush()
+		case <-ctx.Done():
+			b.flush()
+			return
+		}
+	}
+}
+
+// Start sends all datapoints from the DataChan to the reporters. Datapoints are
+// discarded if no reporters are given.
+func Start(ctx context.Context, reporters ...Reporter) {
+	var all []*buffered
+	for _, r := range reporters {
+		b := &buffered{Reporter: r}
+		all = append(all, b)
+		go b.handleFlush(ctx)
+	}
+	for {
+		select {
+		case datapoint := <-DataChan:
+			for _, b := range all {
+				b.add(datapoint)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockReporter struct {
+	ReporterConfig
+	fail    bool
+	written chan []*Datapoint
+}
+
+func (m *mockReporter) Name() string {
+	return "mock"
+}
+
+func (m *mockReporter) Write(points []*Datapoint) error {
+	if m.fail {
+		return fmt.Errorf("backend down")
+	}
+	m.written <- points
+	return nil
+}
+
+func TestBufferedReporter(t *testing.T) {
+	r := &mockReporter{
+		ReporterConfig: ReporterConfig{BufferSize: 2, Tags: map[string]string{"host": "am1", "env": "prod"}},
+		fail:           true,
+		written:        make(chan []*Datapoint, 1),
+	}
+	b := &buffered{Reporter: r}
+	d := &Datapoint{Measurement: "m", Tags: map[string]string{"env": "dev"}, Fields: map[string]interface{}{"f": 1}}
+	b.add(d)
+	assert.Equal(t, b.points[0].Tags, map[string]string{"host": "am1", "env": "dev"})
+	// the original datapoint is shared by all reporters and is not modified
+	assert.Equal(t, d.Tags, map[string]string{"env": "dev"})
+
+	// failed writes are kept, oldest dropped when full
+	b.flush()
+	b.add(&Datapoint{Measurement: "m", Fields: map[string]interface{}{"f": 2}})
+	b.add(&Datapoint{Measurement: "m", Fields: map[string]interface{}{"f": 3}})
+	assert.Equal(t, len(b.points), 2)
+	assert.Equal(t, b.points[0].Fields["f"], 2)
+
+	r.fail = false
+	b.flush()
+	written := <-r.written
+	assert.Equal(t, len(written), 2)
+	assert.Equal(t, written[1].Fields["f"], 3)
+	assert.Equal(t, len(b.points), 0)
+}
+
+func TestStartReporters(t *testing.T) {
+	r1 := &mockReporter{ReporterConfig: ReporterConfig{FlushInterval: 10 * time.Millisecond}, written: make(chan []*Datapoint, 1)}
+	r2 := &mockReporter{ReporterConfig: ReporterConfig{FlushInterval: 10 * time.Millisecond}, written: make(chan []*Datapoint, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Start(ctx, r1, r2)
+	DataChan <- &Datapoint{Measurement: "m", Fields: map[string]interface{}{"f": 1}}
+	assert.Equal(t, (<-r1.written)[0].Measurement, "m")
+	assert.Equal(t, (<-r2.written)[0].Measurement, "m")
+}
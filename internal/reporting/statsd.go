@@ -0,0 +1,149 @@
+package reporting
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	statsdDefaultAddr          = "localhost:8125"
+	statsdDefaultMaxPacketSize = 1432
+)
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_", ",", "_", "#", "_", "=", "_")
+
+// StatsdReporter sends datapoints as statsd metrics over udp. Counters of the
+// stats package are sent as gauges of their cumulative value.
+type StatsdReporter struct {
+	ReporterConfig `mapstructure:",squash"`
+	Addr           string
+	// TagFormat is datadog (|#tag:value, the default) or influx (metric,tag=value)
+	TagFormat string `mapstructure:"tag_format"`
+	// MaxPacketSize is the max size of a udp packet, metrics are batched up to it
+	MaxPacketSize int `mapstructure:"max_packet_size"`
+
+	conn net.Conn
+}
+
+func (s *StatsdReporter) Name() string {
+	return "statsd"
+}
+
+// lines formats the fields of the datapoint as statsd metrics named <measurement>.<field>
+func (s *StatsdReporter) lines(d *Datapoint) []string {
+	typ := "g"
+	if d.Kind == Delta {
+		typ = "c"
+	}
+	tagKeys := make([]string, 0, len(d.Tags))
+	for k := range d.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	var tags []string
+	for _, k := range tagKeys {
+		sep := ":"
+		if s.TagFormat == "influx" {
+			sep = "="
+		}
+		tags = append(tags, statsdReplacer.Replace(k)+sep+statsdReplacer.Replace(d.Tags[k]))
+	}
+	var lines []string
+	for _, k := range sortedFields(d) {
+		name := statsdReplacer.Replace(d.Measurement + "." + k)
+		if s.TagFormat == "influx" && len(tags) > 0 {
+			name += "," + strings.Join(tags, ",")
+		}
+		line := fmt.Sprintf("%s:%v|%s", name, d.Fields[k], typ)
+		if s.TagFormat != "influx" && len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// sortedFields returns the field keys of the datapoint in the order their lines are sent
+func sortedFields(d *Datapoint) []string {
+	keys := make([]string, 0, len(d.Fields))
+	for k := range d.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unsent returns the datapoints from the line at index line of points[point] on
+func unsent(points []*Datapoint, point, line int) []*Datapoint {
+	rest := append([]*Datapoint{}, points[point:]...)
+	if line > 0 {
+		cp := *rest[0]
+		cp.Fields = make(map[string]interface{})
+		for _, k := range sortedFields(rest[0])[line:] {
+			cp.Fields[k] = rest[0].Fields[k]
+		}
+		rest[0] = &cp
+	}
+	return rest
+}
+
+func (s *StatsdReporter) send(packet []byte) error {
+	if s.conn == nil {
+		addr := s.Addr
+		if addr == "" {
+			addr = statsdDefaultAddr
+		}
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write(packet); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Write sends the datapoints in as few packets as possible. If a packet fails, only
+// the lines not sent yet are returned in a PartialWriteError so that counters
+// already sent are not counted twice.
+func (s *StatsdReporter) Write(points []*Datapoint) error {
+	size := s.MaxPacketSize
+	if size <= 0 {
+		size = statsdDefaultMaxPacketSize
+	}
+	var packet []byte
+	// start of the lines in the current packet
+	var startPoint, startLine int
+	for i, d := range points {
+		for j, line := range s.lines(d) {
+			if len(packet) > 0 && len(packet)+len(line)+1 > size {
+				if err := s.send(packet); err != nil {
+					return &PartialWriteError{Err: err, Unsent: unsent(points, startPoint, startLine)}
+				}
+				packet = packet[:0]
+				startPoint, startLine = i, j
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	}
+	if len(packet) == 0 {
+		return nil
+	}
+	if err := s.send(packet); err != nil {
+		return &PartialWriteError{Err: err, Unsent: unsent(points, startPoint, startLine)}
+	}
+	return nil
+}
+
+func init() {
+	AddReporter(&StatsdReporter{})
+}
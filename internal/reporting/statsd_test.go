@@ -0,0 +1,90 @@
+package reporting
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsdReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := &StatsdReporter{Addr: conn.LocalAddr().String(), MaxPacketSize: 80}
+	points := []*Datapoint{
+		{
+			Measurement: "am_stats",
+			Fields:      map[string]interface{}{"api.gets": int64(10), "api.errors": int64(1)},
+			Kind:        Cumulative,
+		},
+		{
+			Measurement: "alerts",
+			Tags:        map[string]string{"team": "neteng", "name": "BGP Down"},
+			Fields:      map[string]interface{}{"num_active": 1},
+			Kind:        Delta,
+		},
+	}
+	if err := r.Write(points); err != nil {
+		t.Fatal(err)
+	}
+	read := func() string {
+		buf := make([]byte, 1500)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	// metrics are batched up to the max packet size
+	assert.Equal(t, read(), "am_stats.api.errors:1|g\nam_stats.api.gets:10|g")
+	assert.Equal(t, read(), "alerts.num_active:1|c|#name:BGP_Down,team:neteng")
+
+	r.TagFormat = "influx"
+	lines := r.lines(points[1])
+	assert.Equal(t, strings.Join(lines, "\n"), "alerts.num_active,name=BGP_Down,team=neteng:1|c")
+}
+
+// failingConn records the packets written and fails after the first ok writes
+type failingConn struct {
+	net.Conn
+	ok      int
+	packets []string
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if len(c.packets) >= c.ok {
+		return 0, fmt.Errorf("network down")
+	}
+	c.packets = append(c.packets, string(b))
+	return len(b), nil
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+func TestStatsdReporterPartialWrite(t *testing.T) {
+	conn := &failingConn{ok: 1}
+	r := &StatsdReporter{MaxPacketSize: 40, conn: conn}
+	b := &buffered{Reporter: r}
+	b.add(&Datapoint{Measurement: "alerts", Fields: map[string]interface{}{"new": 1, "cleared": 2, "expired": 3}, Kind: Delta})
+	b.add(&Datapoint{Measurement: "api", Fields: map[string]interface{}{"gets": 4}, Kind: Delta})
+	b.flush()
+	assert.Equal(t, conn.packets, []string{"alerts.cleared:2|c\nalerts.expired:3|c"})
+	// only the counters not sent are kept
+	assert.Equal(t, len(b.points), 2)
+	assert.Equal(t, b.points[0].Fields, map[string]interface{}{"new": 1})
+
+	conn = &failingConn{ok: 10}
+	r.conn = conn
+	b.flush()
+	assert.Equal(t, conn.packets, []string{"alerts.new:1|c\napi.gets:4|c"})
+	assert.Equal(t, len(b.points), 0)
+}
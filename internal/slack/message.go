@@ -0,0 +1,106 @@
+// Package slack builds the interactive Block Kit messages sent by the slack output and
+// updated by the api when the buttons in them are used.
+package slack
+
+import (
+	"fmt"
+
+	"github.com/mayuresh82/alert_manager/internal/models"
+)
+
+const (
+	// action ids of the interactive buttons added to messages posted with a token
+	ActionAck        = "am_ack"
+	ActionSuppress1h = "am_suppress_1h"
+	ActionSuppress4h = "am_suppress_4h"
+	ActionClear      = "am_clear"
+)
+
+var colorMap = map[models.AlertSeverity]string{
+	models.Sev_CRITICAL: "danger",
+	models.Sev_MAJOR:    "danger",
+	models.Sev_WARN:     "warning",
+	models.Sev_INFO:     "#439FE0",
+}
+
+func button(text, actionId, value, style string) map[string]interface{} {
+	b := map[string]interface{}{
+		"type":      "button",
+		"text":      map[string]interface{}{"type": "plain_text", "text": text},
+		"action_id": actionId,
+		"value":     value,
+	}
+	if style != "" {
+		b["style"] = style
+	}
+	return b
+}
+
+// Message returns a Block Kit message for the alert. The buttons for the given actions
+// are only added while the alert is active, and the ack button only until it has an owner.
+// A non empty note is shown below the alert details.
+func Message(alert *models.Alert, weburl, text, note string, actions []string) map[string]interface{} {
+	title := fmt.Sprintf("[%s][%s] %s", alert.Severity.String(), alert.Status.String(), alert.Name)
+	device := "None"
+	if alert.Device.Valid {
+		device = alert.Device.String
+	}
+	fields := []map[string]interface{}{
+		{"type": "mrkdwn", "text": fmt.Sprintf("*AlertID*\n%d", alert.Id)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Device*\n%s", device)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Entity*\n%s", alert.Entity)},
+	}
+	if alert.Owner.Valid && alert.Owner.String != "" {
+		fields = append(fields, map[string]interface{}{"type": "mrkdwn", "text": fmt.Sprintf("*Owner*\n%s", alert.Owner.String)})
+	}
+	blocks := []map[string]interface{}{
+		{
+			"type": "section",
+			"text": map[string]interface{}{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*<%s/%d|%s>*\n%s", weburl, alert.Id, title, text),
+			},
+		},
+		{"type": "section", "fields": fields},
+	}
+	if note != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"block_id": "am_note",
+			"elements": []map[string]interface{}{{"type": "mrkdwn", "text": note}},
+		})
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]interface{}{{"type": "mrkdwn", "text": fmt.Sprintf("%s via Alert Manager", alert.Source)}},
+	})
+	var buttons []map[string]interface{}
+	if alert.Status == models.Status_ACTIVE {
+		id := fmt.Sprintf("%d", alert.Id)
+		for _, a := range actions {
+			switch a {
+			case ActionAck:
+				if !alert.Owner.Valid || alert.Owner.String == "" {
+					buttons = append(buttons, button("Acknowledge", a, id, "primary"))
+				}
+			case ActionSuppress1h:
+				buttons = append(buttons, button("Suppress 1h", a, id, ""))
+			case ActionSuppress4h:
+				buttons = append(buttons, button("Suppress 4h", a, id, ""))
+			case ActionClear:
+				buttons = append(buttons, button("Clear", a, id, "danger"))
+			}
+		}
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "block_id": "am_actions", "elements": buttons})
+	}
+	color, ok := colorMap[alert.Severity]
+	if !ok || alert.Status == models.Status_CLEARED || alert.Status == models.Status_EXPIRED {
+		color = "good"
+	}
+	return map[string]interface{}{
+		"text":        title,
+		"attachments": []map[string]interface{}{{"color": color, "blocks": blocks}},
+	}
+}
@@ -0,0 +1,189 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// promLabels maps the first part of a stat name to the label that holds the second part,
+// e.g. processors.aggregator.errors becomes processor_errors_total{processor="aggregator"}
+var promLabels = map[string]string{
+	"listener":   "listener",
+	"listeners":  "listener",
+	"processors": "processor",
+	"transforms": "transform",
+	"outputs":    "output",
+}
+
+// Sample is a single value of a metric family
+type Sample struct {
+	// Suffix is appended to the family name, e.g. _bucket for histograms
+	Suffix string
+	Labels map[string]string
+	Value  float64
+}
+
+// Family is a set of samples with the same metric name and type
+type Family struct {
+	Name, Help, Type string
+	Samples          []*Sample
+}
+
+func (f *Family) labelString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (f *Family) write(w io.Writer) {
+	if f.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.Name, f.Help)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+	for _, s := range f.Samples {
+		fmt.Fprintf(w, "%s%s%s %s\n", f.Name, s.Suffix, f.labelString(s.Labels), formatFloat(s.Value))
+	}
+}
+
+// MetricName sanitizes the name to a valid prometheus metric name prefixed with the app name
+func MetricName(name string) string {
+	app := app.name
+	if app == "" {
+		app = defaultAppName
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, app+"_"+name)
+}
+
+// promName returns the metric name and labels of a stat
+func promName(name string) (string, map[string]string) {
+	parts := strings.Split(name, ".")
+	labels := make(map[string]string)
+	if label, ok := promLabels[parts[0]]; ok && len(parts) > 2 {
+		labels[label] = parts[1]
+		parts = append([]string{label}, parts[2:]...)
+	}
+	return MetricName(strings.Join(parts, "_")), labels
+}
+
+type families map[string]*Family
+
+func (fs families) add(name, typ string, samples ...*Sample) {
+	f, ok := fs[name]
+	if !ok {
+		f = &Family{Name: name, Type: typ}
+		fs[name] = f
+	}
+	f.Samples = append(f.Samples, samples...)
+}
+
+func (c *Counter) toSample() (string, *Sample) {
+	c.Lock()
+	defer c.Unlock()
+	name, labels := promName(c.name)
+	for k, v := range c.labels {
+		labels[k] = v
+	}
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	return name, &Sample{Labels: labels, Value: float64(c.value)}
+}
+
+func (g *Gauge) toSample() (string, *Sample) {
+	g.Lock()
+	defer g.Unlock()
+	name, labels := promName(g.name)
+	return name, &Sample{Labels: labels, Value: float64(g.lastVal)}
+}
+
+func (h *Histogram) toSamples() (string, []*Sample) {
+	h.Lock()
+	defer h.Unlock()
+	name, labels := promName(h.name)
+	withLe := func(le float64) map[string]string {
+		l := map[string]string{"le": formatFloat(le)}
+		for k, v := range labels {
+			l[k] = v
+		}
+		return l
+	}
+	var samples []*Sample
+	var cumulative uint64
+	for i, b := range h.buckets {
+		cumulative += h.counts[i]
+		samples = append(samples, &Sample{Suffix: "_bucket", Labels: withLe(b), Value: float64(cumulative)})
+	}
+	samples = append(samples,
+		&Sample{Suffix: "_bucket", Labels: withLe(math.Inf(1)), Value: float64(h.count)},
+		&Sample{Suffix: "_sum", Labels: labels, Value: h.sum},
+		&Sample{Suffix: "_count", Labels: labels, Value: float64(h.count)},
+	)
+	return name, samples
+}
+
+// WritePrometheus writes all counters, gauges and histograms along with the extra families
+// in the prometheus text exposition format
+func WritePrometheus(w io.Writer, extra ...*Family) error {
+	fs := make(families)
+	app.Lock()
+	for _, c := range app.allCounters {
+		name, sample := c.toSample()
+		fs.add(name, "counter", sample)
+	}
+	for _, g := range app.allGauges {
+		name, sample := g.toSample()
+		fs.add(name, "gauge", sample)
+	}
+	for _, h := range app.allHistograms {
+		name, samples := h.toSamples()
+		fs.add(name, "histogram", samples...)
+	}
+	app.Unlock()
+	fs.add(MetricName("internal_num_goroutines"), "gauge", &Sample{Value: float64(runtime.NumGoroutine())})
+	for _, f := range extra {
+		fs.add(f.Name, f.Type, f.Samples...)
+		fs[f.Name].Help = f.Help
+	}
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		fs[name].write(buf)
+	}
+	return buf.Flush()
+}
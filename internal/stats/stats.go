@@ -25,6 +25,8 @@ type Stat interface {
 type Counter struct {
 	name  string
 	value int64
+	// labels are exported as tags of the datapoint and labels of the prometheus sample
+	labels map[string]string
 
 	sync.Mutex
 }
@@ -63,8 +65,10 @@ func (c *Counter) toDatapoint(measurement string) *reporting.Datapoint {
 	defer c.Unlock()
 	return &reporting.Datapoint{
 		Measurement: measurement,
+		Tags:        c.labels,
 		Fields:      map[string]interface{}{c.name: c.value},
 		TimeStamp:   time.Now(),
+		Kind:        reporting.Cumulative,
 	}
 }
 
@@ -112,10 +116,54 @@ func (g *Gauge) toDatapoint(measurement string) []*reporting.Datapoint {
 	return dp
 }
 
+// DefaultBuckets are the histogram bucket upper bounds in seconds used if none are given
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts observed values in buckets
+type Histogram struct {
+	name    string
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+
+	sync.Mutex
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.Lock()
+	defer h.Unlock()
+	for i, b := range h.buckets {
+		if value <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ObserveSince observes the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) toDatapoint(measurement string) *reporting.Datapoint {
+	h.Lock()
+	defer h.Unlock()
+	return &reporting.Datapoint{
+		Measurement: measurement,
+		Fields:      map[string]interface{}{h.name + ".count": int64(h.count), h.name + ".sum": h.sum},
+		TimeStamp:   time.Now(),
+		Kind:        reporting.Cumulative,
+	}
+}
+
 type Application struct {
-	name        string
-	allCounters []*Counter
-	allGauges   []*Gauge
+	name          string
+	allCounters   []*Counter
+	allGauges     []*Gauge
+	allHistograms []*Histogram
 	sync.Mutex
 }
 
@@ -126,7 +174,13 @@ func AppName(name string) {
 }
 
 func NewCounter(name string) *Counter {
-	s := &Counter{name: name}
+	return NewCounterWithLabels(name, nil)
+}
+
+// NewCounterWithLabels returns a counter of one series of the stat, e.g. per alert source.
+// Values that are not known up front go in labels rather than in the stat name.
+func NewCounterWithLabels(name string, labels map[string]string) *Counter {
+	s := &Counter{name: name, labels: labels}
 	app.Lock()
 	defer app.Unlock()
 	app.allCounters = append(app.allCounters, s)
@@ -141,6 +195,18 @@ func NewGauge(name string) *Gauge {
 	return s
 }
 
+// NewHistogram returns a histogram with the bucket upper bounds, DefaultBuckets if nil
+func NewHistogram(name string, buckets []float64) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	s := &Histogram{name: name, buckets: buckets, counts: make([]uint64, len(buckets))}
+	app.Lock()
+	defer app.Unlock()
+	app.allHistograms = append(app.allHistograms, s)
+	return s
+}
+
 func StartExport(ctx context.Context, interval time.Duration) {
 	if interval == 0 {
 		interval = 60 * time.Second
@@ -163,6 +229,9 @@ func StartExport(ctx context.Context, interval time.Duration) {
 				}
 				g.Reset()
 			}
+			for _, h := range app.allHistograms {
+				reporting.DataChan <- h.toDatapoint(measurement)
+			}
 			for _, dp := range internalStats(measurement) {
 				reporting.DataChan <- dp
 			}
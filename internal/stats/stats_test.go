@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,6 +20,12 @@ func TestCounter(t *testing.T) {
 	assert.Equal(t, dp.Fields, map[string]interface{}{"test": int64(10)})
 	c.Reset()
 	assert.Equal(t, int(c.value), 0)
+
+	c = NewCounterWithLabels("test", map[string]string{"source": "grafana"})
+	c.Add(2)
+	dp = c.toDatapoint("test")
+	assert.Equal(t, dp.Tags, map[string]string{"source": "grafana"})
+	assert.Equal(t, dp.Fields, map[string]interface{}{"test": int64(2)})
 }
 
 func isPresent(g *Gauge, value int64) bool {
@@ -61,3 +68,47 @@ func TestGauge(t *testing.T) {
 	g.Add(5)
 	assert.Equal(t, int(g.lastVal), 20)
 }
+
+func TestWritePrometheus(t *testing.T) {
+	AppName("am")
+	c := NewCounter("processors.inhibitor.alerts_inhibited")
+	c.Add(3)
+	for source, v := range map[string]int64{"grafana": 1, "prometheus": 2} {
+		NewCounterWithLabels("listener.webhook.alerts_recvd", map[string]string{"source": source}).Add(v)
+	}
+	g := NewGauge("api.sessions")
+	g.Set(2)
+	h := NewHistogram("outputs.slack.notify_latency_seconds", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	buf := new(bytes.Buffer)
+	extra := &Family{
+		Name:    "am_alerts_active",
+		Help:    "Active alerts",
+		Type:    "gauge",
+		Samples: []*Sample{{Labels: map[string]string{"team": "t1", "severity": "WARN"}, Value: 4}},
+	}
+	if err := WritePrometheus(buf, extra); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE am_processor_alerts_inhibited_total counter",
+		`am_processor_alerts_inhibited_total{processor="inhibitor"} 3`,
+		`am_listener_alerts_recvd_total{listener="webhook",source="grafana"} 1`,
+		`am_listener_alerts_recvd_total{listener="webhook",source="prometheus"} 2`,
+		"# TYPE am_api_sessions gauge",
+		"am_api_sessions 2",
+		"# TYPE am_output_notify_latency_seconds histogram",
+		`am_output_notify_latency_seconds_bucket{le="0.1",output="slack"} 1`,
+		`am_output_notify_latency_seconds_bucket{le="1",output="slack"} 2`,
+		`am_output_notify_latency_seconds_bucket{le="+Inf",output="slack"} 3`,
+		`am_output_notify_latency_seconds_sum{output="slack"} 5.55`,
+		`am_output_notify_latency_seconds_count{output="slack"} 3`,
+		"# HELP am_alerts_active Active alerts",
+		`am_alerts_active{severity="WARN",team="t1"} 4`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"sync"
+)
+
+// InMemoryExporter keeps ended spans in memory, it is meant for tests
+type InMemoryExporter struct {
+	spans []*Span
+	sync.Mutex
+}
+
+func (m *InMemoryExporter) ExportSpan(span *Span) {
+	m.Lock()
+	defer m.Unlock()
+	m.spans = append(m.spans, span)
+}
+
+// Spans returns the ended spans in the order they ended
+func (m *InMemoryExporter) Spans() []*Span {
+	m.Lock()
+	defer m.Unlock()
+	spans := make([]*Span, len(m.spans))
+	copy(spans, m.spans)
+	return spans
+}
+
+// Find returns the ended spans with the given name
+func (m *InMemoryExporter) Find(name string) []*Span {
+	var found []*Span
+	for _, s := range m.Spans() {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func (m *InMemoryExporter) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.spans = nil
+}
@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/otlp"
+)
+
+const (
+	otlpDefaultUrl           = "http://localhost:4318/v1/traces"
+	otlpDefaultFlushInterval = 5 * time.Second
+	otlpDefaultBufferSize    = 10000
+
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string           `json:"traceId"`
+	SpanId            string           `json:"spanId"`
+	ParentSpanId      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []otlp.Attribute `json:"attributes,omitempty"`
+	Status            otlpStatus       `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlp.Scope  `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlp.Resource     `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+// OtlpExporter buffers spans and sends them as OpenTelemetry traces using OTLP/HTTP with
+// json encoding
+type OtlpExporter struct {
+	Url string
+	// Headers are added to each request, e.g. for authentication
+	Headers       map[string]string
+	ServiceName   string `mapstructure:"service_name"`
+	Timeout       time.Duration
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// BufferSize is the max number of spans kept between flushes, newer spans are dropped
+	BufferSize int `mapstructure:"buffer_size"`
+
+	buf     []*Span
+	dropped int
+	sync.Mutex
+}
+
+func (o *OtlpExporter) ExportSpan(span *Span) {
+	o.Lock()
+	defer o.Unlock()
+	size := o.BufferSize
+	if size == 0 {
+		size = otlpDefaultBufferSize
+	}
+	if len(o.buf) >= size {
+		o.dropped++
+		return
+	}
+	o.buf = append(o.buf, span)
+}
+
+func (o *OtlpExporter) convert(span *Span) *otlpSpan {
+	span.Lock()
+	defer span.Unlock()
+	s := &otlpSpan{
+		TraceId:           span.Context.TraceId.String(),
+		SpanId:            span.Context.SpanId.String(),
+		Name:              span.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		Attributes:        otlp.Attributes(span.Attributes),
+	}
+	if span.ParentId.IsValid() {
+		s.ParentSpanId = span.ParentId.String()
+	}
+	if span.Error != "" {
+		s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+	}
+	return s
+}
+
+func (o *OtlpExporter) post(spans []*Span) error {
+	scope := &otlpScopeSpans{Scope: otlp.Scope{Name: otlp.DefaultServiceName}}
+	for _, span := range spans {
+		scope.Spans = append(scope.Spans, o.convert(span))
+	}
+	req := &otlpRequest{
+		ResourceSpans: []*otlpResourceSpans{{
+			Resource:   otlp.ServiceResource(o.ServiceName),
+			ScopeSpans: []*otlpScopeSpans{scope},
+		}},
+	}
+	url := o.Url
+	if url == "" {
+		url = otlpDefaultUrl
+	}
+	return otlp.Post(url, o.Headers, o.Timeout, req)
+}
+
+// Flush sends all buffered spans. Spans that fail to send are dropped.
+func (o *OtlpExporter) Flush() error {
+	o.Lock()
+	spans, dropped := o.buf, o.dropped
+	o.buf, o.dropped = nil, 0
+	o.Unlock()
+	if dropped > 0 {
+		glog.Errorf("Tracing: Dropped %d spans, buffer full", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return o.post(spans)
+}
+
+// Start flushes the buffered spans every flush interval until ctx is done
+func (o *OtlpExporter) Start(ctx context.Context) {
+	interval := o.FlushInterval
+	if interval == 0 {
+		interval = otlpDefaultFlushInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := o.Flush(); err != nil {
+				glog.Errorf("Tracing: %v", err)
+			}
+		case <-ctx.Done():
+			if err := o.Flush(); err != nil {
+				glog.Errorf("Tracing: %v", err)
+			}
+			return
+		}
+	}
+}
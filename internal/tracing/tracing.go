@@ -0,0 +1,193 @@
+// Package tracing records spans for the path an alert takes from a listener through the
+// handler, transforms, processors and outputs, and exports them to a tracing backend.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceId [16]byte
+
+func (t TraceId) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceId) IsValid() bool {
+	return t != TraceId{}
+}
+
+type SpanId [8]byte
+
+func (s SpanId) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanId) IsValid() bool {
+	return s != SpanId{}
+}
+
+// SpanContext identifies a span. It is carried along with an alert so that later stages
+// can start child spans.
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceId.IsValid() && c.SpanId.IsValid()
+}
+
+// Traceparent returns the W3C traceparent header value for the span context
+func (c SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", c.TraceId, c.SpanId)
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("Invalid traceparent: %s", header)
+	}
+	tid, err := hex.DecodeString(parts[1])
+	if err != nil || len(tid) != len(sc.TraceId) {
+		return sc, fmt.Errorf("Invalid trace id in traceparent: %s", header)
+	}
+	sid, err := hex.DecodeString(parts[2])
+	if err != nil || len(sid) != len(sc.SpanId) {
+		return sc, fmt.Errorf("Invalid span id in traceparent: %s", header)
+	}
+	copy(sc.TraceId[:], tid)
+	copy(sc.SpanId[:], sid)
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("Invalid traceparent: %s", header)
+	}
+	return sc, nil
+}
+
+// Span is a single timed operation in a trace
+type Span struct {
+	Name       string
+	Context    SpanContext
+	ParentId   SpanId
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]string
+	// Error is set if the operation failed
+	Error string
+
+	exporter Exporter
+	ended    bool
+	sync.Mutex
+}
+
+// IsRecording returns true if the span will be exported when it ends
+func (s *Span) IsRecording() bool {
+	return s.exporter != nil
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if !s.IsRecording() || err == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.Error = err.Error()
+}
+
+// End ends the span and exports it. Only the first call has any effect.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.Unlock()
+	s.exporter.ExportSpan(s)
+}
+
+// Exporter sends ended spans to a tracing backend
+type Exporter interface {
+	ExportSpan(span *Span)
+}
+
+var (
+	exporter Exporter
+	expMu    sync.RWMutex
+)
+
+// SetExporter sets the exporter for all new spans. Spans are not recorded if it is nil.
+func SetExporter(e Exporter) {
+	expMu.Lock()
+	defer expMu.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	expMu.RLock()
+	defer expMu.RUnlock()
+	return exporter
+}
+
+// StartSpan starts a new span that is a child of the parent span context, or the root
+// of a new trace if the parent is not valid. The returned span does nothing if no
+// exporter is set.
+func StartSpan(parent SpanContext, name string) *Span {
+	e := getExporter()
+	if e == nil {
+		return &Span{Name: name}
+	}
+	span := &Span{Name: name, StartTime: time.Now(), Attributes: make(map[string]string), exporter: e}
+	if parent.IsValid() {
+		span.Context.TraceId = parent.TraceId
+		span.ParentId = parent.SpanId
+	} else {
+		rand.Read(span.Context.TraceId[:])
+	}
+	rand.Read(span.Context.SpanId[:])
+	return span
+}
+
+type contextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx that carries the span context
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, if any
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(contextKey{}).(SpanContext)
+	return sc
+}
+
+// Start starts a new span that is a child of the span carried by ctx and returns a
+// context carrying the new span
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := StartSpan(SpanContextFromContext(ctx), name)
+	if !span.IsRecording() {
+		return ctx, span
+	}
+	return ContextWithSpanContext(ctx, span.Context), span
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mayuresh82/alert_manager/internal/otlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpans(t *testing.T) {
+	// spans are not recorded without an exporter
+	SetExporter(nil)
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttribute("foo", "bar")
+	span.End()
+	assert.False(t, span.IsRecording())
+	assert.False(t, SpanContextFromContext(ctx).IsValid())
+
+	exp := &InMemoryExporter{}
+	SetExporter(exp)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "root")
+	assert.True(t, SpanContextFromContext(ctx).IsValid())
+	_, child := Start(ctx, "child")
+	child.SetAttribute("alert_name", "Neteng BGP Down")
+	child.SetError(fmt.Errorf("failed"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := exp.Spans()
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, spans[0].Name, "child")
+	assert.Equal(t, spans[0].Context.TraceId, root.Context.TraceId)
+	assert.Equal(t, spans[0].ParentId, root.Context.SpanId)
+	assert.Equal(t, spans[0].Attributes["alert_name"], "Neteng BGP Down")
+	assert.Equal(t, spans[0].Error, "failed")
+	assert.False(t, spans[1].ParentId.IsValid())
+	assert.Equal(t, len(exp.Find("root")), 1)
+
+	// spans started from a carried span context join its trace
+	span = StartSpan(child.Context, "stage")
+	assert.Equal(t, span.Context.TraceId, root.Context.TraceId)
+	assert.Equal(t, span.ParentId, child.Context.SpanId)
+}
+
+func TestTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, sc.TraceId.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, sc.SpanId.String(), "00f067aa0ba902b7")
+	assert.Equal(t, sc.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	for _, h := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(h)
+		assert.NotNil(t, err, h)
+	}
+}
+
+func TestOtlpExporter(t *testing.T) {
+	var (
+		req    otlpRequest
+		header http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer ts.Close()
+	o := &OtlpExporter{Url: ts.URL, Headers: map[string]string{"Authorization": "Bearer xyz"}, BufferSize: 2}
+	SetExporter(o)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "listener.webhook")
+	_, child := Start(ctx, "handler.active")
+	child.SetAttribute("alert_name", "Test Alert")
+	child.SetError(fmt.Errorf("db error"))
+	child.End()
+	root.End()
+	// buffer is full
+	_, dropped := Start(ctx, "dropped")
+	dropped.End()
+
+	assert.Nil(t, o.Flush())
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.Equal(t, header.Get("Authorization"), "Bearer xyz")
+	rs := req.ResourceSpans[0]
+	assert.Equal(t, rs.Resource.Attributes[0], otlp.Attribute{Key: "service.name", Value: otlp.Value{StringValue: "alert_manager"}})
+	spans := rs.ScopeSpans[0].Spans
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, spans[0].Name, "handler.active")
+	assert.Equal(t, spans[0].TraceId, root.Context.TraceId.String())
+	assert.Equal(t, spans[0].ParentSpanId, root.Context.SpanId.String())
+	assert.Equal(t, spans[0].Attributes[0], otlp.Attribute{Key: "alert_name", Value: otlp.Value{StringValue: "Test Alert"}})
+	assert.Equal(t, spans[0].Status, otlpStatus{Code: otlpStatusError, Message: "db error"})
+	assert.Equal(t, spans[1].Name, "listener.webhook")
+	assert.Equal(t, spans[1].ParentSpanId, "")
+	assert.Equal(t, spans[1].Status, otlpStatus{})
+
+	// nothing buffered
+	req = otlpRequest{}
+	assert.Nil(t, o.Flush())
+	assert.Nil(t, req.ResourceSpans)
+
+	ts.Close()
+	_, span := Start(ctx, "failed")
+	span.End()
+	assert.NotNil(t, o.Flush())
+}
@@ -0,0 +1,330 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
+	"github.com/mayuresh82/alert_manager/plugins"
+	"github.com/streadway/amqp"
+)
+
+const (
+	amqpDefaultQueue        = "alert_manager"
+	amqpDefaultExchangeType = "direct"
+	amqpDefaultPrefetch     = 100
+	amqpDefaultParserHeader = "source"
+	amqpDefaultConnectRetry = 60 * time.Second
+	amqpTeamHeader          = "team"
+	amqpConsumerTag         = "alert_manager"
+)
+
+// amqpSession is a channel consuming from the alert queue on an open connection
+type amqpSession interface {
+	Deliveries() <-chan amqp.Delivery
+	// NotifyClose returns a channel that receives when the connection or channel is closed
+	NotifyClose() chan *amqp.Error
+	Close() error
+}
+
+type amqpConn struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	deliveries <-chan amqp.Delivery
+}
+
+func (c *amqpConn) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+func (c *amqpConn) NotifyClose() chan *amqp.Error {
+	return c.channel.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+func (c *amqpConn) Close() error {
+	return c.conn.Close()
+}
+
+// AmqpListener consumes alerts from an amqp queue. Each message is parsed by the parser
+// named in the message header, or the default parser, and acked once all its alerts are
+// accepted by the handler.
+type AmqpListener struct {
+	AmqpAddr string `mapstructure:"amqp_addr"`
+	AmqpUser string `mapstructure:"amqp_username"`
+	AmqpPass string `mapstructure:"amqp_password"`
+	Queue    string `mapstructure:"queue"`
+	// Exchange and BindingKey bind the queue to an exchange, the queue is not bound if no
+	// exchange is set
+	Exchange     string `mapstructure:"exchange"`
+	ExchangeType string `mapstructure:"exchange_type"`
+	BindingKey   string `mapstructure:"binding_key"`
+	Durable      bool   `mapstructure:"durable"`
+	// Prefetch is the max number of unacked messages delivered to the listener
+	Prefetch int `mapstructure:"prefetch"`
+	// ParserHeader is the message header holding the parser name, DefaultParser is used for
+	// messages without it
+	ParserHeader  string        `mapstructure:"parser_header"`
+	DefaultParser string        `mapstructure:"default_parser"`
+	Team          string        `mapstructure:"team"`
+	ConnectRetry  time.Duration `mapstructure:"connect_retry"`
+
+	dial    func() (amqpSession, error)
+	session amqpSession
+
+	statMsgsRecvd      stats.Stat
+	statMsgsError      stats.Stat
+	statAlertsRejected stats.Stat
+}
+
+func NewAmqpListener() *AmqpListener {
+	return &AmqpListener{
+		ConnectRetry:       amqpDefaultConnectRetry,
+		statMsgsRecvd:      stats.NewCounter("listener.amqp.msgs_recvd"),
+		statMsgsError:      stats.NewCounter("listener.amqp.msgs_err"),
+		statAlertsRejected: stats.NewCounter("listener.amqp.alerts_rejected"),
+	}
+}
+
+func (l *AmqpListener) Name() string {
+	return "amqp"
+}
+
+func (l *AmqpListener) GetParsersList() []string {
+	var plist []string
+	for _, p := range parsers {
+		plist = append(plist, p.Name())
+	}
+	return plist
+}
+
+func (l *AmqpListener) Uri() string {
+	return fmt.Sprintf("amqp://%s/%s", l.AmqpAddr, l.queue())
+}
+
+func (l *AmqpListener) uri() string {
+	if l.AmqpUser == "" {
+		return fmt.Sprintf("amqp://%s", l.AmqpAddr)
+	}
+	if l.AmqpPass == "" {
+		return fmt.Sprintf("amqp://%s@%s", l.AmqpUser, l.AmqpAddr)
+	}
+	return fmt.Sprintf("amqp://%s:%s@%s", l.AmqpUser, l.AmqpPass, l.AmqpAddr)
+}
+
+func (l *AmqpListener) queue() string {
+	if l.Queue == "" {
+		return amqpDefaultQueue
+	}
+	return l.Queue
+}
+
+// dialAmqp connects to the server, declares and binds the queue and starts consuming
+func (l *AmqpListener) dialAmqp() (amqpSession, error) {
+	conn, err := amqp.Dial(l.uri())
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to server %s: %v", l.AmqpAddr, err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error getting channel: %v", err)
+	}
+	prefetch := l.Prefetch
+	if prefetch <= 0 {
+		prefetch = amqpDefaultPrefetch
+	}
+	if err := channel.Qos(prefetch, 0, false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error setting prefetch: %v", err)
+	}
+	if _, err := channel.QueueDeclare(
+		l.queue(), // name
+		l.Durable, // durable
+		false,     // auto-deleted
+		false,     // exclusive
+		false,     // noWait
+		nil,       // arguments
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error declaring queue: %v", err)
+	}
+	if l.Exchange != "" {
+		exchangeType := l.ExchangeType
+		if exchangeType == "" {
+			exchangeType = amqpDefaultExchangeType
+		}
+		if err := channel.ExchangeDeclare(l.Exchange, exchangeType, l.Durable, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Error declaring exchange: %v", err)
+		}
+		if err := channel.QueueBind(l.queue(), l.BindingKey, l.Exchange, false, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Error binding queue: %v", err)
+		}
+	}
+	deliveries, err := channel.Consume(
+		l.queue(),       // queue
+		amqpConsumerTag, // consumer
+		false,           // autoAck
+		false,           // exclusive
+		false,           // noLocal
+		false,           // noWait
+		nil,             // arguments
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error consuming from queue: %v", err)
+	}
+	return &amqpConn{conn: conn, channel: channel, deliveries: deliveries}, nil
+}
+
+func (l *AmqpListener) connect() error {
+	dial := l.dial
+	if dial == nil {
+		dial = l.dialAmqp
+	}
+	session, err := dial()
+	if err != nil {
+		return err
+	}
+	l.session = session
+	glog.V(2).Infof("Amqp: Consuming from %s on %s", l.queue(), l.AmqpAddr)
+	return nil
+}
+
+func (l *AmqpListener) disconnect() {
+	if l.session != nil {
+		l.session.Close()
+	}
+	l.session = nil
+}
+
+func amqpHeader(d amqp.Delivery, name string) string {
+	v, _ := d.Headers[name].(string)
+	return v
+}
+
+// handleDelivery parses the message and sends its alerts to the handler. All alerts are
+// formatted before any is sent. The message is acked once all valid alerts are accepted,
+// rejected if it has no valid alert and requeued if the listener is stopped before any alert
+// is accepted.
+func (l *AmqpListener) handleDelivery(ctx context.Context, d amqp.Delivery) {
+	l.statMsgsRecvd.Add(1)
+	if h := amqpHeader(d, "traceparent"); h != "" {
+		if parent, err := tracing.ParseTraceparent(h); err == nil {
+			ctx = tracing.ContextWithSpanContext(ctx, parent)
+		}
+	}
+	ctx, span := tracing.Start(ctx, "listener.amqp")
+	defer span.End()
+	reject := func(err error) {
+		glog.Errorf("Amqp: Rejecting message %s: %v", d.MessageId, err)
+		l.statMsgsError.Add(1)
+		span.SetError(err)
+		d.Reject(false)
+	}
+	parserHeader := l.ParserHeader
+	if parserHeader == "" {
+		parserHeader = amqpDefaultParserHeader
+	}
+	source := amqpHeader(d, parserHeader)
+	if source == "" {
+		source = l.DefaultParser
+	}
+	parser := GetParser(source)
+	if parser == nil {
+		reject(fmt.Errorf("No parser found for source %q", source))
+		return
+	}
+	team := amqpHeader(d, amqpTeamHeader)
+	if team == "" {
+		team = l.Team
+	}
+	if team == "" {
+		team = "default"
+	}
+	span.SetAttribute("source", source)
+	span.SetAttribute("team", team)
+	data, err := parser.Parse(d.Body)
+	if err != nil {
+		reject(err)
+		return
+	}
+	rejected := len(data.Rejected)
+	var events []*models.AlertEvent
+	for _, alert := range data.Alerts {
+		event, err := formatAlertEvent(alert, team)
+		if err != nil {
+			glog.Errorf("Amqp: Rejecting alert %s: %v", alert.Name, err)
+			rejected++
+			continue
+		}
+		events = append(events, event)
+	}
+	l.statAlertsRejected.Add(int64(rejected))
+	if len(events) == 0 {
+		reject(fmt.Errorf("All alerts rejected"))
+		return
+	}
+	for i, event := range events {
+		if err := sendEvent(ctx, l.Name(), event); err != nil {
+			// the alerts already accepted are resent with the message and the handler
+			// matches them to the existing alerts
+			glog.V(2).Infof("Amqp: Requeueing message %s, listener stopped after %d of %d alerts", d.MessageId, i, len(events))
+			span.SetError(err)
+			d.Nack(false, true)
+			return
+		}
+	}
+	d.Ack(false)
+}
+
+func (l *AmqpListener) Listen(ctx context.Context) {
+	if l.AmqpAddr == "" {
+		glog.V(2).Infof("Amqp: No amqp_addr configured, not consuming alerts")
+		return
+	}
+	reconnect := time.NewTimer(0)
+	defer reconnect.Stop()
+	var (
+		deliveries <-chan amqp.Delivery
+		closed     chan *amqp.Error
+	)
+	disconnect := func(err error) {
+		glog.Errorf("Amqp: Connection closed, reconnecting: %v", err)
+		l.disconnect()
+		deliveries, closed = nil, nil
+		reconnect.Reset(l.ConnectRetry)
+	}
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				disconnect(fmt.Errorf("Deliveries closed"))
+				break
+			}
+			l.handleDelivery(ctx, d)
+		case err := <-closed:
+			disconnect(err)
+		case <-reconnect.C:
+			if err := l.connect(); err != nil {
+				glog.V(2).Infof("Amqp: %v", err)
+				reconnect.Reset(l.ConnectRetry)
+				break
+			}
+			deliveries, closed = l.session.Deliveries(), l.session.NotifyClose()
+		case <-ctx.Done():
+			l.disconnect()
+			return
+		}
+	}
+}
+
+func init() {
+	listener := NewAmqpListener()
+	plugins.AddListener(listener)
+}
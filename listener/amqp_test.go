@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/models"
+	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockBatchParser returns two valid alerts
+type mockBatchParser struct{}
+
+func (m *mockBatchParser) Name() string { return "mocked_batch" }
+
+func (m *mockBatchParser) Parse(data []byte) (*WebHookAlertData, error) {
+	var alerts []*WebHookAlert
+	for _, entity := range []string{"ent1", "ent2"} {
+		alerts = append(alerts, &WebHookAlert{Name: "Test Alert", Details: "ok", Entity: entity, Time: time.Now(), Status: "ACTIVE"})
+	}
+	return &WebHookAlertData{Alerts: alerts}, nil
+}
+
+type fakeAck struct {
+	tag          uint64
+	ack, requeue bool
+}
+
+// fakeAcknowledger records the acks, nacks and rejects of deliveries
+type fakeAcknowledger struct {
+	acks chan fakeAck
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks <- fakeAck{tag: tag, ack: true}
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.acks <- fakeAck{tag: tag, requeue: requeue}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.acks <- fakeAck{tag: tag, requeue: requeue}
+	return nil
+}
+
+type fakeAmqpSession struct {
+	deliveries chan amqp.Delivery
+	closed     chan *amqp.Error
+}
+
+func (s *fakeAmqpSession) Deliveries() <-chan amqp.Delivery {
+	return s.deliveries
+}
+
+func (s *fakeAmqpSession) NotifyClose() chan *amqp.Error {
+	return s.closed
+}
+
+func (s *fakeAmqpSession) Close() error {
+	return nil
+}
+
+func TestAmqpListener(t *testing.T) {
+	acker := &fakeAcknowledger{acks: make(chan fakeAck, 10)}
+	dials := make(chan *fakeAmqpSession)
+	lis := &AmqpListener{
+		AmqpAddr:      "localhost:5672",
+		DefaultParser: "mocked",
+		Team:          "neteng",
+		ConnectRetry:  10 * time.Millisecond,
+		statMsgsRecvd: &tu.MockStat{}, statMsgsError: &tu.MockStat{}, statAlertsRejected: &tu.MockStat{},
+	}
+	lis.dial = func() (amqpSession, error) {
+		select {
+		case s := <-dials:
+			return s, nil
+		default:
+			return nil, fmt.Errorf("connection refused")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lis.Listen(ctx)
+	session := &fakeAmqpSession{deliveries: make(chan amqp.Delivery), closed: make(chan *amqp.Error, 1)}
+	dials <- session
+	recvAck := func() fakeAck {
+		select {
+		case a := <-acker.acks:
+			return a
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for ack")
+		}
+		return fakeAck{}
+	}
+	deliver := func(s *fakeAmqpSession, tag uint64, headers amqp.Table, body string) {
+		s.deliveries <- amqp.Delivery{Acknowledger: acker, DeliveryTag: tag, Headers: headers, Body: []byte(body)}
+	}
+
+	// the default parser is used without a source header, and the message is only acked
+	// once the handler accepts the alert
+	deliver(session, 1, nil, "{}")
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, acker.acks)
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "Test Alert")
+	assert.Equal(t, event.Alert.Team, "neteng")
+	assert.Equal(t, recvAck(), fakeAck{tag: 1, ack: true})
+
+	// the parser and team are read from the headers, a partially rejected batch is acked
+	deliver(session, 2, amqp.Table{"source": "mocked_reject", "team": "infra"}, "{}")
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Team, "infra")
+	assert.Equal(t, recvAck(), fakeAck{tag: 2, ack: true})
+
+	// messages without valid alerts or without a parser are rejected
+	deliver(session, 3, amqp.Table{"source": "mocked_reject"}, "none")
+	assert.Equal(t, recvAck(), fakeAck{tag: 3})
+	deliver(session, 4, amqp.Table{"source": "unknown"}, "{}")
+	assert.Equal(t, recvAck(), fakeAck{tag: 4})
+
+	// reconnect after the connection is closed
+	session.closed <- amqp.ErrClosed
+	session = &fakeAmqpSession{deliveries: make(chan amqp.Delivery), closed: make(chan *amqp.Error, 1)}
+	dials <- session
+	deliver(session, 5, nil, "{}")
+	receiveEvent(t)
+	assert.Equal(t, recvAck(), fakeAck{tag: 5, ack: true})
+
+	// messages are requeued if the listener stops halfway through a batch so that the
+	// remaining alerts are not lost
+	lctx, lcancel := context.WithCancel(context.Background())
+	d := amqp.Delivery{Acknowledger: acker, DeliveryTag: 6, Headers: amqp.Table{"source": "mocked_batch"}, Body: []byte("{}")}
+	go lis.handleDelivery(lctx, d)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Entity, "ent1")
+	lcancel()
+	assert.Equal(t, recvAck(), fakeAck{tag: 6, requeue: true})
+
+	// messages not accepted by the handler are requeued when the listener stops
+	deliver(session, 7, nil, "{}")
+	cancel()
+	assert.Equal(t, recvAck(), fakeAck{tag: 7, requeue: true})
+}
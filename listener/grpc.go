@@ -0,0 +1,299 @@
+package listener
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
+	pb "github.com/mayuresh82/alert_manager/listener/pb/v1"
+	"github.com/mayuresh82/alert_manager/plugins"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const grpcHealthMethod = "/alert_manager.v1.AlertService/Health"
+
+var grpcLevels = map[pb.Severity]string{
+	pb.Severity_SEVERITY_INFO:     "INFO",
+	pb.Severity_SEVERITY_WARN:     "WARN",
+	pb.Severity_SEVERITY_MAJOR:    "MAJOR",
+	pb.Severity_SEVERITY_CRITICAL: "CRITICAL",
+}
+
+// GrpcListener receives alerts over the gRPC AlertService defined in pb/v1/alert.proto
+type GrpcListener struct {
+	// ListenAddr is the tcp host:port to listen on, the listener is disabled if empty
+	ListenAddr string `mapstructure:"listen_addr"`
+	// TlsCert and TlsKey are the paths of the server certificate and key, TLS is disabled
+	// if not set
+	TlsCert string `mapstructure:"tls_cert"`
+	TlsKey  string `mapstructure:"tls_key"`
+	// Tokens are the accepted bearer tokens, auth is disabled if empty
+	Tokens []string
+	// Team is the team of alerts that do not set a team, defaults to default
+	Team string
+
+	// ctx is done when the listener stops
+	ctx context.Context
+
+	statRequestsRecvd  stats.Stat
+	statAuthFailures   stats.Stat
+	statAlertsRecvd    stats.Stat
+	statAlertsRejected stats.Stat
+}
+
+func NewGrpcListener() *GrpcListener {
+	return &GrpcListener{
+		statRequestsRecvd:  stats.NewCounter("listener.grpc.requests_recvd"),
+		statAuthFailures:   stats.NewCounter("listener.grpc.auth_failures"),
+		statAlertsRecvd:    stats.NewCounter("listener.grpc.alerts_recvd"),
+		statAlertsRejected: stats.NewCounter("listener.grpc.alerts_rejected"),
+	}
+}
+
+func (g *GrpcListener) Name() string {
+	return "grpc"
+}
+
+func (g *GrpcListener) GetParsersList() []string {
+	return nil
+}
+
+func (g *GrpcListener) Uri() string {
+	return fmt.Sprintf("grpc://%s", g.ListenAddr)
+}
+
+// authorize checks the bearer token of the request and joins the trace of the caller if
+// it sent a traceparent
+func (g *GrpcListener) authorize(ctx context.Context, method string) (context.Context, error) {
+	g.statRequestsRecvd.Add(1)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if h := md.Get("traceparent"); len(h) > 0 {
+		if parent, err := tracing.ParseTraceparent(h[0]); err == nil {
+			ctx = tracing.ContextWithSpanContext(ctx, parent)
+		}
+	}
+	if len(g.Tokens) == 0 || method == grpcHealthMethod {
+		return ctx, nil
+	}
+	for _, auth := range md.Get("authorization") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for _, t := range g.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return ctx, nil
+			}
+		}
+	}
+	g.statAuthFailures.Add(1)
+	return nil, status.Error(codes.Unauthenticated, "Not authorized")
+}
+
+func (g *GrpcListener) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := g.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream overrides the context of an authorized stream
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (g *GrpcListener) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := g.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+}
+
+func (g *GrpcListener) toWebHookAlert(a *pb.Alert, index int) (*WebHookAlert, error) {
+	if a.Name == "" {
+		return nil, fmt.Errorf("Required field name missing")
+	}
+	if a.Entity == "" {
+		return nil, fmt.Errorf("Required field entity missing")
+	}
+	alert := &WebHookAlert{
+		Id:      a.Id,
+		Name:    a.Name,
+		Details: a.Details,
+		Device:  a.Device,
+		Entity:  a.Entity,
+		Time:    time.Now(),
+		Level:   grpcLevels[a.Severity],
+		Status:  Status_ALERTING,
+		Source:  a.Source,
+		Index:   index,
+	}
+	if a.Time != nil {
+		t, err := ptypes.Timestamp(a.Time)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time: %v", err)
+		}
+		alert.Time = t
+	}
+	if a.Status == pb.Status_STATUS_CLEARED {
+		alert.Status = Status_CLEARED
+	}
+	if alert.Source == "" {
+		alert.Source = "grpc"
+	}
+	if len(a.Labels) > 0 {
+		alert.Labels = make(map[string]interface{})
+		for k, v := range a.Labels {
+			alert.Labels[k] = v
+		}
+	}
+	return alert, nil
+}
+
+func (g *GrpcListener) listenCtx() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+	return g.ctx
+}
+
+// ingest sends the alert to the handler and returns its result. The alert is sent with
+// the listener context so that a caller going away does not stop a batch half way, only
+// the trace in ctx is kept.
+func (g *GrpcListener) ingest(ctx context.Context, a *pb.Alert, index int) *pb.AlertResult {
+	g.statAlertsRecvd.Add(1)
+	result := &pb.AlertResult{Index: int32(index), Code: pb.ResultCode_RESULT_CODE_ACCEPTED}
+	alert, err := g.toWebHookAlert(a, index)
+	var event *models.AlertEvent
+	if err == nil {
+		team := a.Team
+		if team == "" {
+			team = g.Team
+		}
+		if team == "" {
+			team = "default"
+		}
+		event, err = formatAlertEvent(alert, team)
+	}
+	if err != nil {
+		result.Code, result.Message = pb.ResultCode_RESULT_CODE_INVALID, err.Error()
+		glog.Errorf("Grpc: Rejecting alert %d:%s: %v", index, a.Name, err)
+		g.statAlertsRejected.Add(1)
+		return result
+	}
+	sendCtx := tracing.ContextWithSpanContext(g.listenCtx(), tracing.SpanContextFromContext(ctx))
+	if err := sendEvent(sendCtx, g.Name(), event); err != nil {
+		result.Code, result.Message = pb.ResultCode_RESULT_CODE_UNAVAILABLE, "Listener stopped"
+		glog.Errorf("Grpc: Unable to send alert %d:%s: %v", index, a.Name, err)
+		g.statAlertsRejected.Add(1)
+	}
+	return result
+}
+
+// grpcService implements pb.AlertServiceServer
+type grpcService struct {
+	g *GrpcListener
+}
+
+func (s *grpcService) SendAlerts(ctx context.Context, req *pb.SendAlertsRequest) (*pb.SendAlertsResponse, error) {
+	ctx, span := tracing.Start(ctx, "listener.grpc")
+	defer span.End()
+	resp := &pb.SendAlertsResponse{}
+	for i, a := range req.Alerts {
+		resp.Results = append(resp.Results, s.g.ingest(ctx, a, i))
+	}
+	return resp, nil
+}
+
+func (s *grpcService) StreamAlerts(stream pb.AlertService_StreamAlertsServer) error {
+	ctx := stream.Context()
+	for i := 0; ; i++ {
+		a, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// each alert on the stream is its own trace, or part of the trace of the caller
+		alertCtx, span := tracing.Start(ctx, "listener.grpc")
+		result := s.g.ingest(alertCtx, a, i)
+		span.End()
+		if err := stream.Send(result); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcService) Health(ctx context.Context, req *pb.HealthRequest) (*pb.HealthResponse, error) {
+	return &pb.HealthResponse{Status: pb.HealthResponse_SERVING}, nil
+}
+
+func (g *GrpcListener) newServer() (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(g.unaryAuth),
+		grpc.StreamInterceptor(g.streamAuth),
+	}
+	if g.TlsCert != "" || g.TlsKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(g.TlsCert, g.TlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load TLS cert: %v", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterAlertServiceServer(srv, &grpcService{g: g})
+	return srv, nil
+}
+
+// serve serves the alert service on l until ctx is done
+func (g *GrpcListener) serve(ctx context.Context, l net.Listener) error {
+	g.ctx = ctx
+	srv, err := g.newServer()
+	if err != nil {
+		l.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	return srv.Serve(l)
+}
+
+func (g *GrpcListener) Listen(ctx context.Context) {
+	if g.ListenAddr == "" {
+		glog.V(2).Infof("Grpc: No listen_addr configured, not listening for alerts")
+		return
+	}
+	l, err := net.Listen("tcp", g.ListenAddr)
+	if err != nil {
+		glog.Errorf("Grpc: Unable to listen on %s: %v", g.ListenAddr, err)
+		return
+	}
+	if err := g.serve(ctx, l); err != nil {
+		glog.Errorf("Grpc: Server error: %v", err)
+	}
+}
+
+func init() {
+	listener := NewGrpcListener()
+	plugins.AddListener(listener)
+}
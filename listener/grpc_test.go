@@ -0,0 +1,236 @@
+package listener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	pb "github.com/mayuresh82/alert_manager/listener/pb/v1"
+	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestGrpcListener() *GrpcListener {
+	return &GrpcListener{
+		Tokens:             []string{"secret"},
+		Team:               "neteng",
+		statRequestsRecvd:  &tu.MockStat{},
+		statAuthFailures:   &tu.MockStat{},
+		statAlertsRecvd:    &tu.MockStat{},
+		statAlertsRejected: &tu.MockStat{},
+	}
+}
+
+// startGrpcListener serves the listener on a local port and returns a client for it
+func startGrpcListener(t *testing.T, ctx context.Context, g *GrpcListener, opts ...grpc.DialOption) pb.AlertServiceClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go g.serve(ctx, l)
+	if len(opts) == 0 {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	conn, err := grpc.DialContext(ctx, l.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	return pb.NewAlertServiceClient(conn)
+}
+
+func TestGrpcListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := startGrpcListener(t, ctx, newTestGrpcListener())
+
+	// health does not need a token, alerts do
+	health, err := client.Health(ctx, &pb.HealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, health.Status, pb.HealthResponse_SERVING)
+	_, err = client.SendAlerts(ctx, &pb.SendAlertsRequest{})
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	badCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong")
+	_, err = client.SendAlerts(badCtx, &pb.SendAlertsRequest{})
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	ts, _ := ptypes.TimestampProto(time.Now().Add(-time.Minute))
+	req := &pb.SendAlertsRequest{Alerts: []*pb.Alert{
+		{Id: "1", Name: "Test Alert", Details: "Test Alert 123", Device: "dev1", Entity: "ent1", Time: ts,
+			Severity: pb.Severity_SEVERITY_CRITICAL, Labels: map[string]string{"site": "dc1"}, Team: "infra"},
+		{Name: "Test Alert!", Entity: "ent1"},
+		{Name: "Test Alert"},
+	}}
+	respCh := make(chan *pb.SendAlertsResponse)
+	go func() {
+		resp, err := client.SendAlerts(authCtx, req)
+		if err != nil {
+			t.Error(err)
+		}
+		respCh <- resp
+	}()
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "Test Alert")
+	assert.Equal(t, event.Alert.ExternalId, "1")
+	assert.Equal(t, event.Alert.Device.String, "dev1")
+	assert.Equal(t, event.Alert.Entity, "ent1")
+	assert.Equal(t, event.Alert.Severity, models.Sev_CRITICAL)
+	assert.Equal(t, event.Alert.Source, "grpc")
+	assert.Equal(t, event.Alert.Team, "infra")
+	assert.Equal(t, event.Alert.Labels["site"], "dc1")
+	assert.Equal(t, event.Alert.StartTime.Unix(), ts.Seconds)
+	resp := <-respCh
+	if assert.Len(t, resp.Results, 3) {
+		assert.Equal(t, resp.Results[0].Code, pb.ResultCode_RESULT_CODE_ACCEPTED)
+		assert.Equal(t, resp.Results[1].Code, pb.ResultCode_RESULT_CODE_INVALID)
+		assert.Equal(t, resp.Results[1].Index, int32(1))
+		assert.Contains(t, resp.Results[1].Message, "Invalid alert name")
+		assert.Equal(t, resp.Results[2].Code, pb.ResultCode_RESULT_CODE_INVALID)
+		assert.Equal(t, resp.Results[2].Message, "Required field entity missing")
+	}
+
+	// streamed alerts get a result each
+	stream, err := client.StreamAlerts(authCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.Alert{Name: "Test Alert", Entity: "ent2", Status: pb.Status_STATUS_CLEARED})
+	event = receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_CLEARED)
+	assert.Equal(t, event.Alert.Entity, "ent2")
+	assert.Equal(t, event.Alert.Team, "neteng")
+	result, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, result.Code, pb.ResultCode_RESULT_CODE_ACCEPTED)
+	stream.Send(&pb.Alert{Entity: "ent2"})
+	result, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, result.Index, int32(1))
+	assert.Equal(t, result.Code, pb.ResultCode_RESULT_CODE_INVALID)
+	stream.CloseSend()
+}
+
+func TestGrpcListenerContext(t *testing.T) {
+	lctx, lcancel := context.WithCancel(context.Background())
+	g := newTestGrpcListener()
+	g.ctx = lctx
+	s := &grpcService{g: g}
+	req := &pb.SendAlertsRequest{Alerts: []*pb.Alert{
+		{Name: "Test Alert", Entity: "ent1"},
+		{Name: "Test Alert", Entity: "ent2"},
+	}}
+
+	// alerts are still sent once the caller goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	respCh := make(chan *pb.SendAlertsResponse)
+	go func() {
+		resp, _ := s.SendAlerts(ctx, req)
+		respCh <- resp
+	}()
+	assert.Equal(t, receiveEvent(t).Alert.Entity, "ent1")
+	assert.Equal(t, receiveEvent(t).Alert.Entity, "ent2")
+	resp := <-respCh
+	if assert.Len(t, resp.Results, 2) {
+		assert.Equal(t, resp.Results[0].Code, pb.ResultCode_RESULT_CODE_ACCEPTED)
+		assert.Equal(t, resp.Results[1].Code, pb.ResultCode_RESULT_CODE_ACCEPTED)
+	}
+
+	// only alerts that are never sent are unavailable
+	lcancel()
+	resp, _ = s.SendAlerts(context.Background(), req)
+	if assert.Len(t, resp.Results, 2) {
+		assert.Equal(t, resp.Results[0].Code, pb.ResultCode_RESULT_CODE_UNAVAILABLE)
+		assert.Equal(t, resp.Results[0].Message, "Listener stopped")
+		assert.Equal(t, resp.Results[1].Code, pb.ResultCode_RESULT_CODE_UNAVAILABLE)
+	}
+}
+
+// writeTestCert writes a self signed cert and key for localhost into dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestGrpcListenerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpc_tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g := newTestGrpcListener()
+	g.TlsCert, g.TlsKey = writeTestCert(t, dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	certPool := x509.NewCertPool()
+	pemData, _ := ioutil.ReadFile(g.TlsCert)
+	certPool.AppendCertsFromPEM(pemData)
+	creds := credentials.NewTLS(&tls.Config{RootCAs: certPool, ServerName: "localhost"})
+	client := startGrpcListener(t, ctx, g, grpc.WithTransportCredentials(creds))
+	health, err := client.Health(ctx, &pb.HealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, health.Status, pb.HealthResponse_SERVING)
+
+	// the server does not accept plaintext connections
+	plain := startGrpcListener(t, ctx, g)
+	shortCtx, shortCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer shortCancel()
+	_, err = plain.Health(shortCtx, &pb.HealthRequest{})
+	assert.NotNil(t, err)
+}
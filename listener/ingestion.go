@@ -0,0 +1,164 @@
+package listener
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	Result_ACCEPTED     = "accepted"
+	Result_REJECTED     = "rejected"
+	Result_DEDUPLICATED = "deduplicated"
+	Result_SAMPLED      = "sampled"
+
+	Ingestion_PENDING   = "pending"
+	Ingestion_COMPLETED = "completed"
+
+	defaultIngestionTtl  = time.Hour
+	defaultMaxIngestions = 10000
+)
+
+// AlertResult is the outcome of an alert in a received batch
+type AlertResult struct {
+	// Index is the position of the alert in the received batch
+	Index  int    `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Ingestion is the outcome of a received batch of alerts. Async batches are pending until
+// all accepted alerts are sent to the handler.
+type Ingestion struct {
+	Id         string         `json:"id,omitempty"`
+	Status     string         `json:"status"`
+	Source     string         `json:"source"`
+	Team       string         `json:"team"`
+	ReceivedAt time.Time      `json:"received_at"`
+	Results    []*AlertResult `json:"results"`
+	// Rejected are the rejected alerts of Results
+	Rejected []*RejectedAlert `json:"rejected,omitempty"`
+
+	mu sync.Mutex
+}
+
+func newIngestion(source, team string) *Ingestion {
+	return &Ingestion{Status: Ingestion_PENDING, Source: source, Team: team, ReceivedAt: time.Now(), Results: []*AlertResult{}}
+}
+
+// add adds the result of an alert and returns it
+func (i *Ingestion) add(index int, name, status, reason string) *AlertResult {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	r := &AlertResult{Index: index, Name: name, Status: status, Reason: reason}
+	i.Results = append(i.Results, r)
+	return r
+}
+
+// sortResults orders the results by position in the batch
+func (i *Ingestion) sortResults() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	sort.SliceStable(i.Results, func(a, b int) bool { return i.Results[a].Index < i.Results[b].Index })
+}
+
+// reject marks an accepted alert as rejected
+func (i *Ingestion) reject(r *AlertResult, reason string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	r.Status, r.Reason = Result_REJECTED, reason
+}
+
+func (i *Ingestion) complete() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Status = Ingestion_COMPLETED
+}
+
+// count returns the number of alerts with the result status
+func (i *Ingestion) count(status string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var n int
+	for _, r := range i.Results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// snapshot returns a copy of the ingestion that is safe to encode
+func (i *Ingestion) snapshot() *Ingestion {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	s := &Ingestion{Id: i.Id, Status: i.Status, Source: i.Source, Team: i.Team, ReceivedAt: i.ReceivedAt, Results: []*AlertResult{}}
+	for _, r := range i.Results {
+		c := *r
+		s.Results = append(s.Results, &c)
+		if c.Status == Result_REJECTED {
+			s.Rejected = append(s.Rejected, &RejectedAlert{Index: c.Index, Name: c.Name, Reason: c.Reason})
+		}
+	}
+	return s
+}
+
+// ingestionStore keeps async ingestions for lookup until they expire, or until max newer
+// ingestions are stored
+type ingestionStore struct {
+	ttl        time.Duration
+	max        int
+	items      map[string]*Ingestion
+	lastExpire time.Time
+	sync.Mutex
+}
+
+func newIngestionStore(ttl time.Duration) *ingestionStore {
+	return &ingestionStore{ttl: ttl, max: defaultMaxIngestions, items: make(map[string]*Ingestion), lastExpire: time.Now()}
+}
+
+// add assigns a new id to the ingestion and stores it
+func (s *ingestionStore) add(i *Ingestion) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	i.Id = hex.EncodeToString(b)
+	s.Lock()
+	defer s.Unlock()
+	if len(s.items) >= s.max || time.Since(s.lastExpire) >= s.ttl/10 {
+		for id, item := range s.items {
+			if time.Since(item.ReceivedAt) > s.ttl {
+				delete(s.items, id)
+			}
+		}
+		s.lastExpire = time.Now()
+	}
+	for len(s.items) >= s.max {
+		var oldest *Ingestion
+		for _, item := range s.items {
+			if oldest == nil || item.ReceivedAt.Before(oldest.ReceivedAt) {
+				oldest = item
+			}
+		}
+		glog.V(2).Infof("Webhook: Ingestion store full, dropping ingestion %s", oldest.Id)
+		delete(s.items, oldest.Id)
+	}
+	s.items[i.Id] = i
+	return nil
+}
+
+func (s *ingestionStore) get(id string) (*Ingestion, bool) {
+	s.Lock()
+	defer s.Unlock()
+	i, ok := s.items[id]
+	if !ok || time.Since(i.ReceivedAt) > s.ttl {
+		return nil, false
+	}
+	return i.snapshot(), true
+}
@@ -0,0 +1,134 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestionResults(t *testing.T) {
+	lis := newTestWebHookListener()
+	var ing Ingestion
+
+	// the response lists the outcome of every alert in the batch
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked_reject&team=neteng", "some"))
+		close(done)
+	}()
+	receiveEvent(t)
+	<-done
+	assert.Equal(t, rr.Code, http.StatusOK)
+	if err := json.NewDecoder(rr.Body).Decode(&ing); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ing.Status, Ingestion_COMPLETED)
+	assert.Equal(t, ing.Source, "mocked_reject")
+	assert.Equal(t, ing.Team, "neteng")
+	assert.Empty(t, ing.Id)
+	if assert.Len(t, ing.Results, 4) {
+		assert.Equal(t, *ing.Results[0], AlertResult{Index: 0, Name: "Test Alert", Status: Result_DEDUPLICATED, Reason: "Duplicate of alert 3"})
+		assert.Equal(t, *ing.Results[1], AlertResult{Index: 1, Name: "Missing Entity", Status: Result_REJECTED, Reason: "Required label entity missing"})
+		assert.Equal(t, ing.Results[2].Status, Result_REJECTED)
+		assert.Equal(t, *ing.Results[3], AlertResult{Index: 3, Name: "Test Alert", Status: Result_ACCEPTED})
+	}
+	assert.Len(t, ing.Rejected, 2)
+}
+
+func TestIngestionAsync(t *testing.T) {
+	lis := newTestWebHookListener()
+	lis.ingestions = newIngestionStore(time.Minute)
+	var ing Ingestion
+
+	// the request returns before the alerts are sent to the handler
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked_reject&async=true", "some"))
+	assert.Equal(t, rr.Code, http.StatusAccepted)
+	if err := json.NewDecoder(rr.Body).Decode(&ing); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, ing.Id, 32)
+	assert.Equal(t, ing.Status, Ingestion_PENDING)
+	assert.Len(t, ing.Results, 4)
+	event := receiveEvent(t)
+	assert.Equal(t, event.Alert.Name, "Test Alert")
+
+	lookup := func(id string) (int, *Ingestion) {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/listener/ingestion/"+id, nil)
+		http.HandlerFunc(lis.ingestionHandler).ServeHTTP(rr, req)
+		var ing Ingestion
+		json.NewDecoder(rr.Body).Decode(&ing)
+		return rr.Code, &ing
+	}
+	var found *Ingestion
+	for i := 0; i < 100; i++ {
+		var code int
+		code, found = lookup(ing.Id)
+		assert.Equal(t, code, http.StatusOK)
+		if found.Status == Ingestion_COMPLETED {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, found.Status, Ingestion_COMPLETED)
+	assert.Equal(t, found.Results[3].Status, Result_ACCEPTED)
+	code, _ := lookup("unknown")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// batches without valid alerts are rejected synchronously
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked_reject&async=true", "none"))
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+
+	// alerts not sent when the listener stops are rejected
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lis.ctx = ctx
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked&async=1", "{}"))
+	assert.Equal(t, rr.Code, http.StatusAccepted)
+	ing = Ingestion{}
+	json.NewDecoder(rr.Body).Decode(&ing)
+	for i := 0; i < 100; i++ {
+		_, found = lookup(ing.Id)
+		if found.Status == Ingestion_COMPLETED {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, *found.Results[0], AlertResult{Index: 0, Name: "Test Alert", Status: Result_REJECTED, Reason: "Listener stopped"})
+}
+
+func TestIngestionStoreExpiry(t *testing.T) {
+	s := newIngestionStore(time.Minute)
+	old := newIngestion("mocked", "neteng")
+	old.ReceivedAt = time.Now().Add(-2 * time.Minute)
+	s.add(old)
+	_, ok := s.get(old.Id)
+	assert.False(t, ok)
+	s.lastExpire = time.Time{}
+	recent := newIngestion("mocked", "neteng")
+	s.add(recent)
+	_, ok = s.get(recent.Id)
+	assert.True(t, ok)
+	assert.NotContains(t, s.items, old.Id)
+
+	// the oldest ingestions are dropped when the store is full
+	s.max = 2
+	next := newIngestion("mocked", "neteng")
+	next.ReceivedAt = recent.ReceivedAt.Add(time.Second)
+	s.add(next)
+	last := newIngestion("mocked", "neteng")
+	last.ReceivedAt = next.ReceivedAt.Add(time.Second)
+	s.add(last)
+	assert.Len(t, s.items, 2)
+	assert.NotContains(t, s.items, recent.Id)
+	assert.Contains(t, s.items, last.Id)
+}
@@ -12,3 +12,13 @@ var parsers []Parser
 func AddParser(parser Parser) {
 	parsers = append(parsers, parser)
 }
+
+// GetParser returns the parser with the given name, or nil if none
+func GetParser(name string) Parser {
+	for _, p := range parsers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
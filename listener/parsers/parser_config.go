@@ -0,0 +1,263 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/listener"
+	"github.com/tidwall/gjson"
+)
+
+var validLevels = map[string]bool{"INFO": true, "WARN": true, "MAJOR": true, "CRITICAL": true}
+
+// configField is a field of a config parser, either a gjson path or a template
+type configField struct {
+	path string
+	tmpl *template.Template
+}
+
+// newConfigField parses expr as a template if it contains an action, else as a gjson path
+func newConfigField(name, expr string) (*configField, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if !strings.Contains(expr, "{{") {
+		return &configField{path: expr}, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(gjson.Result{})).Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template for %s: %v", name, err)
+	}
+	return &configField{tmpl: tmpl}, nil
+}
+
+// templateFuncs returns the template functions for an alert: get looks up a gjson path on
+// the alert and is empty if the path is missing, default replaces an empty value.
+func templateFuncs(alert gjson.Result) template.FuncMap {
+	return template.FuncMap{
+		"get": func(path string) string {
+			return alert.Get(path).String()
+		},
+		"default": func(def, value string) string {
+			if value == "" {
+				return def
+			}
+			return value
+		},
+	}
+}
+
+// value evaluates the field on an alert. Templates are executed with the decoded alert.
+func (f *configField) value(alert gjson.Result) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	if f.tmpl == nil {
+		return alert.Get(f.path).String(), nil
+	}
+	tmpl, err := f.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(templateFuncs(alert)).Execute(&buf, alert.Value()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ConfigParser is a parser defined in a [parsers.<name>] config section. Each field is a
+// gjson path evaluated on the alert, e.g. "labels.host", or a template executed with the
+// alert if it contains an action, e.g. "{{.labels.host}}:{{.labels.port}}" or "{{`myapp`}}"
+// for a fixed value. A missing key is an error in templates, fields that may be missing are
+// read with get, e.g. "{{get "labels.port" | default "80"}}".
+type ConfigParser struct {
+	name string
+	// Alerts is the gjson path of the array of alerts in the body. The body is a single
+	// alert if not set.
+	Alerts string
+	// AlertName is the alert name field, set by the name key
+	AlertName   string `mapstructure:"name"`
+	Id          string
+	Entity      string
+	Device      string
+	Description string
+	Severity    string
+	Status      string
+	Source      string
+	Time        string
+	// TimeFormat is unix, unix_ms or a go time layout, defaults to RFC3339
+	TimeFormat string `mapstructure:"time_format"`
+	// Labels maps label names to fields, LabelsFrom is the gjson path of an object whose
+	// keys are all added as labels
+	Labels     map[string]string
+	LabelsFrom string `mapstructure:"labels_from"`
+	// SeverityMap and StatusMap map source values to alert severities and statuses
+	SeverityMap map[string]string `mapstructure:"severity_map"`
+	StatusMap   map[string]string `mapstructure:"status_map"`
+
+	fields map[string]*configField
+	labels map[string]*configField
+}
+
+func NewConfigParser(name string) *ConfigParser {
+	return &ConfigParser{name: name}
+}
+
+func (p *ConfigParser) Name() string {
+	return p.name
+}
+
+// Init validates the parser config and compiles its fields
+func (p *ConfigParser) Init() error {
+	if p.AlertName == "" || p.Entity == "" {
+		return fmt.Errorf("Parser %s: name and entity are required", p.name)
+	}
+	p.fields = make(map[string]*configField)
+	for name, expr := range map[string]string{
+		"id": p.Id, "name": p.AlertName, "entity": p.Entity, "device": p.Device, "description": p.Description,
+		"severity": p.Severity, "status": p.Status, "source": p.Source, "time": p.Time,
+	} {
+		f, err := newConfigField(name, expr)
+		if err != nil {
+			return fmt.Errorf("Parser %s: %v", p.name, err)
+		}
+		p.fields[name] = f
+	}
+	p.labels = make(map[string]*configField)
+	for name, expr := range p.Labels {
+		f, err := newConfigField(name, expr)
+		if err != nil {
+			return fmt.Errorf("Parser %s: %v", p.name, err)
+		}
+		p.labels[name] = f
+	}
+	for k, v := range p.SeverityMap {
+		if !validLevels[strings.ToUpper(v)] {
+			return fmt.Errorf("Parser %s: invalid severity %s for %s", p.name, v, k)
+		}
+	}
+	for k, v := range p.StatusMap {
+		if v != listener.Status_ALERTING && v != listener.Status_CLEARED {
+			return fmt.Errorf("Parser %s: invalid status %s for %s, should be alerting or cleared", p.name, v, k)
+		}
+	}
+	return nil
+}
+
+func (p *ConfigParser) parseTime(value string) (time.Time, error) {
+	switch p.TimeFormat {
+	case "", time.RFC3339:
+		return time.Parse(time.RFC3339, value)
+	case "unix", "unix_ms":
+		ts, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if p.TimeFormat == "unix_ms" {
+			ts /= 1000
+		}
+		return time.Unix(0, int64(ts*float64(time.Second))), nil
+	}
+	return time.Parse(p.TimeFormat, value)
+}
+
+func (p *ConfigParser) parseAlert(raw json.RawMessage) (*listener.WebHookAlert, error) {
+	a := gjson.ParseBytes(raw)
+	values := make(map[string]string)
+	for name, f := range p.fields {
+		v, err := f.value(a)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to evaluate %s: %v", name, err)
+		}
+		values[name] = v
+	}
+	for _, required := range []string{"name", "entity"} {
+		if values[required] == "" {
+			return nil, fmt.Errorf("Required field %s missing", required)
+		}
+	}
+	alert := &listener.WebHookAlert{
+		Id:      values["id"],
+		Name:    values["name"],
+		Details: values["description"],
+		Device:  values["device"],
+		Entity:  values["entity"],
+		Time:    time.Now(),
+		Source:  values["source"],
+		Labels:  make(map[string]interface{}),
+	}
+	if alert.Source == "" {
+		alert.Source = p.name
+	}
+	if t := values["time"]; t != "" {
+		parsed, err := p.parseTime(t)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time %s: %v", t, err)
+		}
+		alert.Time = parsed
+	}
+	if sev := values["severity"]; sev != "" {
+		if mapped, ok := p.SeverityMap[sev]; ok {
+			sev = mapped
+		}
+		if !validLevels[strings.ToUpper(sev)] {
+			return nil, fmt.Errorf("Invalid severity %s", sev)
+		}
+		alert.Level = strings.ToUpper(sev)
+	}
+	alert.Status = listener.Status_ALERTING
+	if status := values["status"]; status != "" {
+		if mapped, ok := p.StatusMap[status]; ok {
+			status = mapped
+		}
+		if status != listener.Status_ALERTING && status != listener.Status_CLEARED {
+			return nil, fmt.Errorf("Invalid status %s", status)
+		}
+		alert.Status = status
+	}
+	if p.LabelsFrom != "" {
+		a.Get(p.LabelsFrom).ForEach(func(k, v gjson.Result) bool {
+			alert.Labels[k.String()] = v.String()
+			return true
+		})
+	}
+	for name, f := range p.labels {
+		v, err := f.value(a)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to evaluate label %s: %v", name, err)
+		}
+		if v != "" {
+			alert.Labels[name] = v
+		}
+	}
+	return alert, nil
+}
+
+func (p *ConfigParser) Parse(data []byte) (*listener.WebHookAlertData, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, fmt.Errorf("Invalid json received")
+	}
+	var raws []json.RawMessage
+	if p.Alerts == "" {
+		raws = append(raws, json.RawMessage(data))
+	} else {
+		alerts := gjson.GetBytes(data, p.Alerts)
+		if !alerts.IsArray() || len(alerts.Array()) == 0 {
+			return nil, fmt.Errorf("No alerts found at %s", p.Alerts)
+		}
+		for _, a := range alerts.Array() {
+			raws = append(raws, json.RawMessage(a.Raw))
+		}
+	}
+	result := parseBatch(p.name, raws, p.parseAlert)
+	for _, r := range result.Rejected {
+		r.Name, _ = p.fields["name"].value(gjson.ParseBytes(raws[r.Index]))
+	}
+	return result, nil
+}
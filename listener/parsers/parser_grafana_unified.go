@@ -0,0 +1,110 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/listener"
+)
+
+// grafanaUnifiedData defines the alertmanager style webhook payload sent by Grafana 8+
+// unified alerting
+type grafanaUnifiedData struct {
+	Receiver string
+	Status   string
+	OrgId    int64  `json:"orgId"`
+	GroupKey string `json:"groupKey"`
+	// alerts are decoded one by one so that a malformed alert does not fail the batch
+	Alerts      []json.RawMessage
+	ExternalURL string `json:"externalURL"`
+}
+
+type grafanaUnifiedAlert struct {
+	promAlert
+	SilenceURL   string             `json:"silenceURL"`
+	DashboardURL string             `json:"dashboardURL"`
+	PanelURL     string             `json:"panelURL"`
+	Values       map[string]float64 `json:"values"`
+	ValueString  string             `json:"valueString"`
+}
+
+// GrafanaUnifiedParser parses alerts from Grafana unified alerting. The legacy dashboard
+// alerts are parsed by the grafana parser.
+type GrafanaUnifiedParser struct {
+	name string
+	// EntityLabel and DeviceLabel are the names of the labels that hold the entity and device
+	EntityLabel string `mapstructure:"entity_label"`
+	DeviceLabel string `mapstructure:"device_label"`
+}
+
+func (p *GrafanaUnifiedParser) Name() string {
+	return p.name
+}
+
+// values formats the values of the alert query expressions as B=22, C=1
+func (p *GrafanaUnifiedParser) values(values map[string]float64) string {
+	var refs []string
+	for ref := range values {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	var formatted []string
+	for _, ref := range refs {
+		formatted = append(formatted, ref+"="+strconv.FormatFloat(values[ref], 'f', -1, 64))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func (p *GrafanaUnifiedParser) parseAlert(raw json.RawMessage, groupKey string) (*listener.WebHookAlert, error) {
+	var a grafanaUnifiedAlert
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("Unable to decode alert: %v", err)
+	}
+	if a.Annotations == nil {
+		a.Annotations = make(map[string]string)
+	}
+	// alerts without a description or summary are described by their values
+	if a.Annotations["description"] == "" && a.Annotations["summary"] == "" && a.ValueString != "" {
+		a.Annotations["description"] = a.ValueString
+	}
+	alert, err := a.toWebHookAlert(p.EntityLabel, p.DeviceLabel, "grafana", groupKey)
+	if err != nil {
+		return nil, err
+	}
+	if a.DashboardURL != "" {
+		alert.Labels["dashboard_url"] = a.DashboardURL
+	}
+	if a.PanelURL != "" {
+		alert.Labels["panel_url"] = a.PanelURL
+	}
+	if a.SilenceURL != "" {
+		alert.Labels["silence_url"] = a.SilenceURL
+	}
+	if len(a.Values) > 0 {
+		alert.Labels["values"] = p.values(a.Values)
+	}
+	return alert, nil
+}
+
+func (p *GrafanaUnifiedParser) Parse(data []byte) (*listener.WebHookAlertData, error) {
+	d := grafanaUnifiedData{}
+	if err := json.Unmarshal(data, &d); err != nil {
+		glog.Errorf("Unable to decode json: %v", err)
+		return nil, err
+	}
+	if len(d.Alerts) == 0 {
+		return nil, fmt.Errorf("Invalid alert data received")
+	}
+	return parseBatch("Grafana", d.Alerts, func(raw json.RawMessage) (*listener.WebHookAlert, error) {
+		return p.parseAlert(raw, d.GroupKey)
+	}), nil
+}
+
+func init() {
+	parser := &GrafanaUnifiedParser{name: "grafana_unified"}
+	listener.AddParser(parser)
+}
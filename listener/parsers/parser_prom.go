@@ -11,14 +11,140 @@ import (
 
 var promStatusMap = map[string]string{"firing": listener.Status_ALERTING, "resolved": listener.Status_CLEARED}
 
-// PromAmData defines the data sent by Prometheus Alertmanager
+// promAmData defines the v4 webhook payload sent by Prometheus Alertmanager
 type promAmData struct {
-	Alerts       []map[string]interface{}
-	CommonLabels map[string]interface{}
+	Version     string
+	GroupKey    string `json:"groupKey"`
+	Status      string
+	Receiver    string
+	ExternalURL string `json:"externalURL"`
+	// alerts are decoded one by one so that a malformed alert does not fail the batch
+	Alerts       []json.RawMessage
+	CommonLabels map[string]string `json:"commonLabels"`
+}
+
+type promAlert struct {
+	Status       string
+	Labels       map[string]string
+	Annotations  map[string]string
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string
+}
+
+// toWebHookAlert converts an alertmanager style alert. The entity and device are read from
+// the given labels, the source defaults to the given source.
+func (a *promAlert) toWebHookAlert(entityLabel, deviceLabel, source, groupKey string) (*listener.WebHookAlert, error) {
+	name := a.Labels["alertname"]
+	if name == "" {
+		return nil, fmt.Errorf("Required label alertname missing")
+	}
+	status, ok := promStatusMap[a.Status]
+	if !ok {
+		return nil, fmt.Errorf("Invalid status %q", a.Status)
+	}
+	if a.StartsAt.IsZero() {
+		return nil, fmt.Errorf("Required field startsAt missing")
+	}
+	if entityLabel == "" {
+		entityLabel = "entity"
+	}
+	if deviceLabel == "" {
+		deviceLabel = "device"
+	}
+	entity := a.Labels[entityLabel]
+	if entity == "" {
+		return nil, fmt.Errorf("Required label %s missing", entityLabel)
+	}
+	// description and summary are annotations, older configs set the description as a label
+	details := a.Annotations["description"]
+	if details == "" {
+		details = a.Labels["description"]
+	}
+	if details == "" {
+		details = a.Annotations["summary"]
+	}
+	if details == "" {
+		return nil, fmt.Errorf("Required annotation description or summary missing")
+	}
+	if a.Labels["source"] != "" {
+		source = a.Labels["source"]
+	}
+	labels := make(map[string]interface{})
+	for k, v := range a.Labels {
+		labels[k] = v
+	}
+	if summary := a.Annotations["summary"]; summary != "" {
+		labels["summary"] = summary
+	}
+	if a.GeneratorURL != "" {
+		labels["generator_url"] = a.GeneratorURL
+	}
+	if runbook := a.Annotations["runbook_url"]; runbook != "" {
+		labels["runbook_url"] = runbook
+	}
+	if groupKey != "" {
+		labels["group_key"] = groupKey
+	}
+	if status == listener.Status_CLEARED && !a.EndsAt.IsZero() {
+		labels["ends_at"] = a.EndsAt.Format(time.RFC3339)
+	}
+	return &listener.WebHookAlert{
+		Id:      a.Fingerprint,
+		Name:    name,
+		Details: details,
+		Device:  a.Labels[deviceLabel],
+		Entity:  entity,
+		Time:    a.StartsAt,
+		Source:  source,
+		Level:   sevToLevel[a.Labels["severity"]],
+		Status:  status,
+		Labels:  labels,
+	}, nil
+}
+
+// parseBatch parses each alert of an alertmanager style batch. Malformed alerts are rejected
+// individually, and of duplicate alerts in the batch the last one wins.
+func parseBatch(source string, raws []json.RawMessage, parse func(raw json.RawMessage) (*listener.WebHookAlert, error)) *listener.WebHookAlertData {
+	result := &listener.WebHookAlertData{}
+	seen := make(map[string]int)
+	for i, raw := range raws {
+		alert, err := parse(raw)
+		if err != nil {
+			glog.Errorf("%s: Rejecting alert %d: %v", source, i, err)
+			rejected := &listener.RejectedAlert{Index: i, Reason: err.Error()}
+			var named struct{ Labels map[string]interface{} }
+			if json.Unmarshal(raw, &named) == nil {
+				rejected.Name, _ = named.Labels["alertname"].(string)
+			}
+			result.Rejected = append(result.Rejected, rejected)
+			continue
+		}
+		alert.Index = i
+		key := alert.Id
+		if key == "" {
+			key = fmt.Sprintf("%s:%s:%s", alert.Name, alert.Device, alert.Entity)
+		}
+		if j, ok := seen[key]; ok {
+			prev := result.Alerts[j]
+			result.Deduplicated = append(result.Deduplicated, &listener.RejectedAlert{
+				Index: prev.Index, Name: prev.Name, Reason: fmt.Sprintf("Duplicate of alert %d", i),
+			})
+			result.Alerts[j] = alert
+			continue
+		}
+		seen[key] = len(result.Alerts)
+		result.Alerts = append(result.Alerts, alert)
+	}
+	return result
 }
 
 type PromParser struct {
 	name string
+	// EntityLabel and DeviceLabel are the names of the labels that hold the entity and device
+	EntityLabel string `mapstructure:"entity_label"`
+	DeviceLabel string `mapstructure:"device_label"`
 }
 
 func (p *PromParser) Name() string {
@@ -35,50 +161,14 @@ func (p *PromParser) Parse(data []byte) (*listener.WebHookAlertData, error) {
 		return nil, fmt.Errorf("Invalid alert data received")
 	}
 	// Prom alertmanager sends a bunch of alerts in the http message.
-	// There can also be a firing and a resolved for the same alert in the same message. Its stupid.
-	alerts := make(map[string]*listener.WebHookAlert)
-	for _, alertData := range d.Alerts {
-		t, err := time.Parse(time.RFC3339, alertData["startsAt"].(string))
-		if err != nil {
-			glog.Errorf("Unable to parse time string , using current time")
-			t = time.Now()
-		}
-		labels := alertData["labels"].(map[string]interface{})
-		var device string
-		if labels["device"] != nil {
-			device = labels["device"].(string)
-		}
-		if labels["entity"] == nil || labels["description"] == nil {
-			return nil, fmt.Errorf("Entity and description are required")
-		}
-		source := "prometheus"
-		if labels["source"] != nil {
-			source = labels["source"].(string)
+	// There can also be a firing and a resolved for the same alert in the same message.
+	return parseBatch("Prometheus", d.Alerts, func(raw json.RawMessage) (*listener.WebHookAlert, error) {
+		var a promAlert
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, fmt.Errorf("Unable to decode alert: %v", err)
 		}
-		sev := "info"
-		if labels["severity"] != nil {
-			sev = labels["severity"].(string)
-		}
-		alert := &listener.WebHookAlert{
-			Id:      "None",
-			Name:    labels["alertname"].(string),
-			Details: labels["description"].(string),
-			Device:  device,
-			Entity:  labels["entity"].(string),
-			Time:    t,
-			Source:  source,
-			Level:   sevToLevel[sev],
-			Status:  promStatusMap[alertData["status"].(string)],
-			Labels:  labels,
-		}
-		key := fmt.Sprintf("%s:%s:%s", alert.Name, alert.Device, alert.Entity)
-		alerts[key] = alert
-	}
-	var uniqueAlerts []*listener.WebHookAlert
-	for _, a := range alerts {
-		uniqueAlerts = append(uniqueAlerts, a)
-	}
-	return &listener.WebHookAlertData{Alerts: uniqueAlerts}, nil
+		return a.toWebHookAlert(p.EntityLabel, p.DeviceLabel, "prometheus", d.GroupKey)
+	}), nil
 }
 
 func init() {
@@ -2,6 +2,7 @@ package parsers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/mayuresh82/alert_manager/listener"
 	"github.com/stretchr/testify/assert"
@@ -75,7 +76,10 @@ var testDatas = map[string]struct {
 	},
 	"prom": {
 		raw: `{
+			"version": "4",
+			"groupKey": "{}:{alertname=\"Device down\"}",
 			"status": "firing",
+			"receiver": "alert_manager",
 			"alerts": [
 			  {
 				"status": "firing",
@@ -91,38 +95,36 @@ var testDatas = map[string]struct {
 				},
 				"annotations": {},
 				"startsAt": "2019-04-02T22:28:12.208437528Z",
-				"endsAt": "0001-01-01T00:00:00Z"
+				"endsAt": "0001-01-01T00:00:00Z",
+				"fingerprint": "c4b0ad1a2fd0d6a2"
 			  },
 			  {
 				"status": "firing",
 				"labels": {
 				  "alertname": "Device down",
-				  "description": "Device bar is down",
 				  "device": "bar",
 				  "entity": "bar",
 				  "role": "rack-switch",
 				  "severity": "warning",
-				  "site": "ord1",
-				  "source": "prometheus"
+				  "site": "ord1"
 				},
-				"annotations": {},
+				"annotations": {"description": "Device bar is down"},
 				"startsAt": "2019-04-02T22:28:12.208437528Z",
-				"endsAt": "0001-01-01T00:00:00Z"
+				"endsAt": "0001-01-01T00:00:00Z",
+				"fingerprint": "f20a1ae9e5a0e0b1"
 			  }
 			],
 			"commonLabels": {
 				"alertname": "Device down",
 				"role": "rack-switch",
 				"severity": "warning",
-				"site": "ord1",
-				"source": "prometheus"
+				"site": "ord1"
 			},
-			"externalURL": "http://8fd5083ae377:9093",
-			"version": "4"
+			"externalURL": "http://8fd5083ae377:9093"
 		  }`,
 		parsed: []*listener.WebHookAlert{
 			&listener.WebHookAlert{
-				Id:      "None",
+				Id:      "c4b0ad1a2fd0d6a2",
 				Name:    "Device down",
 				Details: "Device foo is down",
 				Device:  "foo",
@@ -131,7 +133,7 @@ var testDatas = map[string]struct {
 				Source:  "prometheus",
 			},
 			&listener.WebHookAlert{
-				Id:      "None",
+				Id:      "f20a1ae9e5a0e0b1",
 				Name:    "Device down",
 				Details: "Device bar is down",
 				Device:  "bar",
@@ -202,3 +204,283 @@ func TestParsingGeneric(t *testing.T) {
 	result, err = parser.Parse([]byte(raw))
 	assert.Error(t, err)
 }
+
+func TestParsingProm(t *testing.T) {
+	raw := `{
+		"version": "4",
+		"groupKey": "{}:{alertname=\"HostDown\"}",
+		"status": "resolved",
+		"alerts": [
+		  {
+			"status": "resolved",
+			"labels": {"alertname": "HostDown", "instance": "host1:9100", "device": "host1", "severity": "critical"},
+			"annotations": {"summary": "Host down", "description": "host1 is unreachable", "runbook_url": "http://wiki/hostdown"},
+			"startsAt": "2019-04-02T22:28:12Z",
+			"endsAt": "2019-04-02T22:38:12Z",
+			"generatorURL": "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0",
+			"fingerprint": "1b9f8e7c6d5a4b3c"
+		  },
+		  {
+			"status": "firing",
+			"labels": {"instance": "host2:9100"},
+			"annotations": {"summary": "Host down"},
+			"startsAt": "2019-04-02T22:28:12Z"
+		  },
+		  {
+			"status": "firing",
+			"labels": {"alertname": "HostDown", "instance": "host3:9100"},
+			"annotations": {"summary": "Host down"},
+			"startsAt": "yesterday"
+		  },
+		  {
+			"status": "firing",
+			"labels": {"alertname": "HostDown"},
+			"annotations": {"summary": "Host down"},
+			"startsAt": "2019-04-02T22:28:12Z"
+		  }
+		]
+	}`
+	parser := &PromParser{name: "prometheus", EntityLabel: "instance"}
+	result, err := parser.Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(result.Alerts), 1)
+	a := result.Alerts[0]
+	assert.Equal(t, a.Id, "1b9f8e7c6d5a4b3c")
+	assert.Equal(t, a.Name, "HostDown")
+	assert.Equal(t, a.Details, "host1 is unreachable")
+	assert.Equal(t, a.Entity, "host1:9100")
+	assert.Equal(t, a.Device, "host1")
+	assert.Equal(t, a.Level, "CRITICAL")
+	assert.Equal(t, a.Status, listener.Status_CLEARED)
+	assert.Equal(t, a.Time, time.Date(2019, 4, 2, 22, 28, 12, 0, time.UTC))
+	assert.Equal(t, a.Labels["summary"], "Host down")
+	assert.Equal(t, a.Labels["runbook_url"], "http://wiki/hostdown")
+	assert.Equal(t, a.Labels["generator_url"], "http://prometheus:9090/graph?g0.expr=up+%3D%3D+0")
+	assert.Equal(t, a.Labels["group_key"], `{}:{alertname="HostDown"}`)
+	assert.Equal(t, a.Labels["ends_at"], "2019-04-02T22:38:12Z")
+
+	// malformed alerts are rejected individually
+	assert.Equal(t, len(result.Rejected), 3)
+	assert.Equal(t, result.Rejected[0].Index, 1)
+	assert.Equal(t, result.Rejected[0].Reason, "Required label alertname missing")
+	assert.Equal(t, result.Rejected[1].Index, 2)
+	assert.Equal(t, result.Rejected[1].Name, "HostDown")
+	assert.Contains(t, result.Rejected[1].Reason, "Unable to decode alert")
+	assert.Equal(t, result.Rejected[2].Index, 3)
+	assert.Equal(t, result.Rejected[2].Reason, "Required label instance missing")
+
+	// the last of duplicate alerts wins
+	raw = `{"alerts": [
+		{"status": "firing", "labels": {"alertname": "HostDown", "instance": "h1"}, "annotations": {"summary": "down"}, "startsAt": "2019-04-02T22:28:12Z", "fingerprint": "a1"},
+		{"status": "resolved", "labels": {"alertname": "HostDown", "instance": "h1"}, "annotations": {"summary": "down"}, "startsAt": "2019-04-02T22:28:12Z", "fingerprint": "a1"}
+	]}`
+	result, err = parser.Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(result.Alerts), 1)
+	assert.Equal(t, result.Alerts[0].Status, listener.Status_CLEARED)
+	assert.Equal(t, result.Alerts[0].Index, 1)
+	assert.Equal(t, len(result.Deduplicated), 1)
+	assert.Equal(t, *result.Deduplicated[0], listener.RejectedAlert{Index: 0, Name: "HostDown", Reason: "Duplicate of alert 1"})
+
+	_, err = parser.Parse([]byte(`{"alerts": []}`))
+	assert.Error(t, err)
+}
+
+func TestParsingGrafanaUnified(t *testing.T) {
+	raw := `{
+		"receiver": "alert_manager",
+		"status": "firing",
+		"orgId": 1,
+		"groupKey": "{}/{}:{alertname=\"High Input Errors\"}",
+		"alerts": [
+		  {
+			"status": "firing",
+			"labels": {"alertname": "High Input Errors", "device": "br1-sjc1", "entity": "et-0/0/3:0", "grafana_folder": "Neteng", "severity": "critical"},
+			"annotations": {"summary": "Input errors on br1-sjc1"},
+			"startsAt": "2022-03-01T10:00:00Z",
+			"endsAt": "0001-01-01T00:00:00Z",
+			"generatorURL": "http://grafana/alerting/grafana/abc/view",
+			"fingerprint": "5e8c6f5b7e2a1d3c",
+			"silenceURL": "http://grafana/alerting/silence/new?matcher=alertname%3DHigh+Input+Errors",
+			"dashboardURL": "http://grafana/d/neteng",
+			"panelURL": "http://grafana/d/neteng?viewPanel=2",
+			"values": {"C": 1, "B": 1222.5},
+			"valueString": "[ var='B' labels={device=br1-sjc1} value=1222.5 ]"
+		  },
+		  {
+			"status": "resolved",
+			"labels": {"alertname": "High Input Errors", "device": "br2-sjc1", "entity": "et-0/0/4:0"},
+			"annotations": {},
+			"startsAt": "2022-03-01T09:00:00Z",
+			"endsAt": "2022-03-01T09:30:00Z",
+			"fingerprint": "6a1b2c3d4e5f6a7b",
+			"values": null,
+			"valueString": "[ var='B' labels={device=br2-sjc1} value=0 ]"
+		  },
+		  {
+			"status": "firing",
+			"labels": {"alertname": "High Input Errors", "device": "br3-sjc1"},
+			"annotations": {"summary": "Input errors on br3-sjc1"},
+			"startsAt": "2022-03-01T10:00:00Z"
+		  }
+		]
+	}`
+	parser := &GrafanaUnifiedParser{name: "grafana_unified"}
+	result, err := parser.Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(result.Alerts), 2)
+	firing := result.Alerts[0]
+	assert.Equal(t, firing.Id, "5e8c6f5b7e2a1d3c")
+	assert.Equal(t, firing.Name, "High Input Errors")
+	assert.Equal(t, firing.Details, "Input errors on br1-sjc1")
+	assert.Equal(t, firing.Device, "br1-sjc1")
+	assert.Equal(t, firing.Entity, "et-0/0/3:0")
+	assert.Equal(t, firing.Source, "grafana")
+	assert.Equal(t, firing.Level, "CRITICAL")
+	assert.Equal(t, firing.Status, listener.Status_ALERTING)
+	assert.Equal(t, firing.Time, time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+	assert.Equal(t, firing.Labels["dashboard_url"], "http://grafana/d/neteng")
+	assert.Equal(t, firing.Labels["panel_url"], "http://grafana/d/neteng?viewPanel=2")
+	assert.Equal(t, firing.Labels["silence_url"], "http://grafana/alerting/silence/new?matcher=alertname%3DHigh+Input+Errors")
+	assert.Equal(t, firing.Labels["generator_url"], "http://grafana/alerting/grafana/abc/view")
+	assert.Equal(t, firing.Labels["values"], "B=1222.5, C=1")
+	assert.Equal(t, firing.Labels["grafana_folder"], "Neteng")
+
+	resolved := result.Alerts[1]
+	assert.Equal(t, resolved.Status, listener.Status_CLEARED)
+	assert.Equal(t, resolved.Details, "[ var='B' labels={device=br2-sjc1} value=0 ]")
+	assert.Equal(t, resolved.Time, time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, resolved.Labels["ends_at"], "2022-03-01T09:30:00Z")
+
+	assert.Equal(t, len(result.Rejected), 1)
+	assert.Equal(t, *result.Rejected[0], listener.RejectedAlert{Index: 2, Name: "High Input Errors", Reason: "Required label entity missing"})
+
+	// legacy dashboard alerts are not supported
+	_, err = parser.Parse([]byte(testDatas["grafana"].raw))
+	assert.Error(t, err)
+}
+
+func TestParsingConfig(t *testing.T) {
+	raw := `{
+		"events": [
+		  {
+			"uid": "a1",
+			"check": {"name": "DiskFull", "output": "disk 95% full"},
+			"host": {"name": "web1", "mount": "/var"},
+			"level": 2,
+			"state": "firing",
+			"ts": 1546300800,
+			"tags": {"dc": "sjc1", "role": "web"}
+		  },
+		  {
+			"uid": "a2",
+			"check": {"name": "DiskFull"},
+			"host": {"name": "web2", "mount": "/"},
+			"state": "ok",
+			"ts": 1546300860
+		  },
+		  {
+			"uid": "a3",
+			"check": {"name": "DiskFull"},
+			"host": {"name": "web3"},
+			"level": 2,
+			"state": "firing"
+		  },
+		  {
+			"uid": "a4",
+			"check": {"name": "DiskFull"},
+			"host": {"name": "web4", "mount": "/"},
+			"level": 7,
+			"state": "firing"
+		  }
+		]
+	}`
+	parser := NewConfigParser("diskmon")
+	parser.Alerts = "events"
+	parser.Id = "uid"
+	parser.AlertName = "check.name"
+	parser.Entity = "host.mount"
+	parser.Device = "host.name"
+	parser.Description = `{{get "check.output"}} on {{.host.name}}`
+	parser.Severity = "level"
+	parser.Status = "state"
+	parser.Time = "ts"
+	parser.TimeFormat = "unix"
+	parser.Labels = map[string]string{"mount": "host.mount", "env": "{{`prod`}}", "team": `{{get "team" | default "infra"}}`}
+	parser.LabelsFrom = "tags"
+	parser.SeverityMap = map[string]string{"1": "warn", "2": "critical"}
+	parser.StatusMap = map[string]string{"firing": "alerting", "ok": "cleared"}
+	if err := parser.Init(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := parser.Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(result.Alerts), 2)
+	alert := result.Alerts[0]
+	assert.Equal(t, alert.Id, "a1")
+	assert.Equal(t, alert.Name, "DiskFull")
+	assert.Equal(t, alert.Entity, "/var")
+	assert.Equal(t, alert.Device, "web1")
+	assert.Equal(t, alert.Details, "disk 95% full on web1")
+	assert.Equal(t, alert.Level, "CRITICAL")
+	assert.Equal(t, alert.Status, listener.Status_ALERTING)
+	assert.Equal(t, alert.Source, "diskmon")
+	assert.Equal(t, alert.Time.Unix(), int64(1546300800))
+	assert.Equal(t, alert.Labels, map[string]interface{}{"dc": "sjc1", "role": "web", "mount": "/var", "env": "prod", "team": "infra"})
+
+	cleared := result.Alerts[1]
+	assert.Equal(t, cleared.Status, listener.Status_CLEARED)
+	assert.Equal(t, cleared.Level, "")
+	assert.Equal(t, cleared.Details, " on web2")
+
+	assert.Equal(t, len(result.Rejected), 2)
+	assert.Equal(t, *result.Rejected[0], listener.RejectedAlert{Index: 2, Name: "DiskFull", Reason: "Required field entity missing"})
+	assert.Equal(t, result.Rejected[1].Index, 3)
+	assert.Equal(t, result.Rejected[1].Reason, "Invalid severity 7")
+
+	// a single alert body
+	parser = NewConfigParser("single")
+	parser.AlertName = "{{.check}}"
+	parser.Entity = "entity"
+	parser.Time = "time"
+	parser.TimeFormat = "2006-01-02 15:04:05"
+	if err := parser.Init(); err != nil {
+		t.Fatal(err)
+	}
+	result, err = parser.Parse([]byte(`{"check": "Ping", "entity": "host1", "time": "2019-01-01 00:00:00"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, result.Alerts[0].Name, "Ping")
+	assert.Equal(t, result.Alerts[0].Time, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	// a missing key is an error, unless read with get
+	result, err = parser.Parse([]byte(`{"entity": "host1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, result.Alerts)
+	assert.Contains(t, result.Rejected[0].Reason, "Unable to evaluate name")
+	_, err = parser.Parse([]byte(`{"check": `))
+	assert.Error(t, err)
+
+	// invalid configs
+	assert.Error(t, NewConfigParser("bad").Init())
+	parser = NewConfigParser("bad")
+	parser.AlertName, parser.Entity = "name", "{{.entity"
+	assert.Error(t, parser.Init())
+	parser = NewConfigParser("bad")
+	parser.AlertName, parser.Entity = "name", "entity"
+	parser.SeverityMap = map[string]string{"1": "urgent"}
+	assert.Error(t, parser.Init())
+	parser.SeverityMap = nil
+	parser.StatusMap = map[string]string{"ok": "resolved"}
+	assert.Error(t, parser.Init())
+}
@@ -0,0 +1,746 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: listener/pb/v1/alert.proto
+
+package pb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Severity int32
+
+const (
+	Severity_SEVERITY_UNSPECIFIED Severity = 0
+	Severity_SEVERITY_INFO        Severity = 1
+	Severity_SEVERITY_WARN        Severity = 2
+	Severity_SEVERITY_MAJOR       Severity = 3
+	Severity_SEVERITY_CRITICAL    Severity = 4
+)
+
+var Severity_name = map[int32]string{
+	0: "SEVERITY_UNSPECIFIED",
+	1: "SEVERITY_INFO",
+	2: "SEVERITY_WARN",
+	3: "SEVERITY_MAJOR",
+	4: "SEVERITY_CRITICAL",
+}
+
+var Severity_value = map[string]int32{
+	"SEVERITY_UNSPECIFIED": 0,
+	"SEVERITY_INFO":        1,
+	"SEVERITY_WARN":        2,
+	"SEVERITY_MAJOR":       3,
+	"SEVERITY_CRITICAL":    4,
+}
+
+func (x Severity) String() string {
+	return proto.EnumName(Severity_name, int32(x))
+}
+
+func (Severity) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{0}
+}
+
+type Status int32
+
+const (
+	// unspecified alerts are treated as alerting
+	Status_STATUS_UNSPECIFIED Status = 0
+	Status_STATUS_ALERTING    Status = 1
+	Status_STATUS_CLEARED     Status = 2
+)
+
+var Status_name = map[int32]string{
+	0: "STATUS_UNSPECIFIED",
+	1: "STATUS_ALERTING",
+	2: "STATUS_CLEARED",
+}
+
+var Status_value = map[string]int32{
+	"STATUS_UNSPECIFIED": 0,
+	"STATUS_ALERTING":    1,
+	"STATUS_CLEARED":     2,
+}
+
+func (x Status) String() string {
+	return proto.EnumName(Status_name, int32(x))
+}
+
+func (Status) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{1}
+}
+
+type ResultCode int32
+
+const (
+	ResultCode_RESULT_CODE_UNSPECIFIED ResultCode = 0
+	// the alert was accepted by the handler
+	ResultCode_RESULT_CODE_ACCEPTED ResultCode = 1
+	// the alert is invalid and was rejected
+	ResultCode_RESULT_CODE_INVALID ResultCode = 2
+	// the alert was not accepted because the listener is stopping or the request was
+	// cancelled, it can be retried
+	ResultCode_RESULT_CODE_UNAVAILABLE ResultCode = 3
+)
+
+var ResultCode_name = map[int32]string{
+	0: "RESULT_CODE_UNSPECIFIED",
+	1: "RESULT_CODE_ACCEPTED",
+	2: "RESULT_CODE_INVALID",
+	3: "RESULT_CODE_UNAVAILABLE",
+}
+
+var ResultCode_value = map[string]int32{
+	"RESULT_CODE_UNSPECIFIED": 0,
+	"RESULT_CODE_ACCEPTED":    1,
+	"RESULT_CODE_INVALID":     2,
+	"RESULT_CODE_UNAVAILABLE": 3,
+}
+
+func (x ResultCode) String() string {
+	return proto.EnumName(ResultCode_name, int32(x))
+}
+
+func (ResultCode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{2}
+}
+
+type HealthResponse_ServingStatus int32
+
+const (
+	HealthResponse_SERVING_STATUS_UNSPECIFIED HealthResponse_ServingStatus = 0
+	HealthResponse_SERVING                    HealthResponse_ServingStatus = 1
+	HealthResponse_NOT_SERVING                HealthResponse_ServingStatus = 2
+)
+
+var HealthResponse_ServingStatus_name = map[int32]string{
+	0: "SERVING_STATUS_UNSPECIFIED",
+	1: "SERVING",
+	2: "NOT_SERVING",
+}
+
+var HealthResponse_ServingStatus_value = map[string]int32{
+	"SERVING_STATUS_UNSPECIFIED": 0,
+	"SERVING":                    1,
+	"NOT_SERVING":                2,
+}
+
+func (x HealthResponse_ServingStatus) String() string {
+	return proto.EnumName(HealthResponse_ServingStatus_name, int32(x))
+}
+
+func (HealthResponse_ServingStatus) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{5, 0}
+}
+
+type Alert struct {
+	// id is the id of the alert in the source system
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// name should only contain alpha-numeric chars, spaces or underscores
+	Name    string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Details string `protobuf:"bytes,3,opt,name=details,proto3" json:"details,omitempty"`
+	Device  string `protobuf:"bytes,4,opt,name=device,proto3" json:"device,omitempty"`
+	Entity  string `protobuf:"bytes,5,opt,name=entity,proto3" json:"entity,omitempty"`
+	// time is the start time of the alert, defaults to the time it was received
+	Time *timestamp.Timestamp `protobuf:"bytes,6,opt,name=time,proto3" json:"time,omitempty"`
+	// severity is overridden by the severity in the alert config if defined
+	Severity Severity `protobuf:"varint,7,opt,name=severity,proto3,enum=alert_manager.v1.Severity" json:"severity,omitempty"`
+	Status   Status   `protobuf:"varint,8,opt,name=status,proto3,enum=alert_manager.v1.Status" json:"status,omitempty"`
+	// source defaults to grpc
+	Source string            `protobuf:"bytes,9,opt,name=source,proto3" json:"source,omitempty"`
+	Labels map[string]string `protobuf:"bytes,10,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// team defaults to the team configured for the listener
+	Team                 string   `protobuf:"bytes,11,opt,name=team,proto3" json:"team,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Alert) Reset()         { *m = Alert{} }
+func (m *Alert) String() string { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()    {}
+func (*Alert) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{0}
+}
+
+func (m *Alert) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Alert.Unmarshal(m, b)
+}
+func (m *Alert) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Alert.Marshal(b, m, deterministic)
+}
+func (m *Alert) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Alert.Merge(m, src)
+}
+func (m *Alert) XXX_Size() int {
+	return xxx_messageInfo_Alert.Size(m)
+}
+func (m *Alert) XXX_DiscardUnknown() {
+	xxx_messageInfo_Alert.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Alert proto.InternalMessageInfo
+
+func (m *Alert) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Alert) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Alert) GetDetails() string {
+	if m != nil {
+		return m.Details
+	}
+	return ""
+}
+
+func (m *Alert) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+func (m *Alert) GetEntity() string {
+	if m != nil {
+		return m.Entity
+	}
+	return ""
+}
+
+func (m *Alert) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *Alert) GetSeverity() Severity {
+	if m != nil {
+		return m.Severity
+	}
+	return Severity_SEVERITY_UNSPECIFIED
+}
+
+func (m *Alert) GetStatus() Status {
+	if m != nil {
+		return m.Status
+	}
+	return Status_STATUS_UNSPECIFIED
+}
+
+func (m *Alert) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *Alert) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Alert) GetTeam() string {
+	if m != nil {
+		return m.Team
+	}
+	return ""
+}
+
+type SendAlertsRequest struct {
+	Alerts               []*Alert `protobuf:"bytes,1,rep,name=alerts,proto3" json:"alerts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SendAlertsRequest) Reset()         { *m = SendAlertsRequest{} }
+func (m *SendAlertsRequest) String() string { return proto.CompactTextString(m) }
+func (*SendAlertsRequest) ProtoMessage()    {}
+func (*SendAlertsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{1}
+}
+
+func (m *SendAlertsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendAlertsRequest.Unmarshal(m, b)
+}
+func (m *SendAlertsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendAlertsRequest.Marshal(b, m, deterministic)
+}
+func (m *SendAlertsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendAlertsRequest.Merge(m, src)
+}
+func (m *SendAlertsRequest) XXX_Size() int {
+	return xxx_messageInfo_SendAlertsRequest.Size(m)
+}
+func (m *SendAlertsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendAlertsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendAlertsRequest proto.InternalMessageInfo
+
+func (m *SendAlertsRequest) GetAlerts() []*Alert {
+	if m != nil {
+		return m.Alerts
+	}
+	return nil
+}
+
+type AlertResult struct {
+	// index is the position of the alert in the request or stream
+	Index int32      `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Code  ResultCode `protobuf:"varint,2,opt,name=code,proto3,enum=alert_manager.v1.ResultCode" json:"code,omitempty"`
+	// message is the reason the alert was not accepted
+	Message              string   `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AlertResult) Reset()         { *m = AlertResult{} }
+func (m *AlertResult) String() string { return proto.CompactTextString(m) }
+func (*AlertResult) ProtoMessage()    {}
+func (*AlertResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{2}
+}
+
+func (m *AlertResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AlertResult.Unmarshal(m, b)
+}
+func (m *AlertResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AlertResult.Marshal(b, m, deterministic)
+}
+func (m *AlertResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AlertResult.Merge(m, src)
+}
+func (m *AlertResult) XXX_Size() int {
+	return xxx_messageInfo_AlertResult.Size(m)
+}
+func (m *AlertResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_AlertResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AlertResult proto.InternalMessageInfo
+
+func (m *AlertResult) GetIndex() int32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+func (m *AlertResult) GetCode() ResultCode {
+	if m != nil {
+		return m.Code
+	}
+	return ResultCode_RESULT_CODE_UNSPECIFIED
+}
+
+func (m *AlertResult) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type SendAlertsResponse struct {
+	Results              []*AlertResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SendAlertsResponse) Reset()         { *m = SendAlertsResponse{} }
+func (m *SendAlertsResponse) String() string { return proto.CompactTextString(m) }
+func (*SendAlertsResponse) ProtoMessage()    {}
+func (*SendAlertsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{3}
+}
+
+func (m *SendAlertsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendAlertsResponse.Unmarshal(m, b)
+}
+func (m *SendAlertsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendAlertsResponse.Marshal(b, m, deterministic)
+}
+func (m *SendAlertsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendAlertsResponse.Merge(m, src)
+}
+func (m *SendAlertsResponse) XXX_Size() int {
+	return xxx_messageInfo_SendAlertsResponse.Size(m)
+}
+func (m *SendAlertsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendAlertsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendAlertsResponse proto.InternalMessageInfo
+
+func (m *SendAlertsResponse) GetResults() []*AlertResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type HealthRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthRequest) Reset()         { *m = HealthRequest{} }
+func (m *HealthRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthRequest) ProtoMessage()    {}
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{4}
+}
+
+func (m *HealthRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthRequest.Unmarshal(m, b)
+}
+func (m *HealthRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthRequest.Marshal(b, m, deterministic)
+}
+func (m *HealthRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthRequest.Merge(m, src)
+}
+func (m *HealthRequest) XXX_Size() int {
+	return xxx_messageInfo_HealthRequest.Size(m)
+}
+func (m *HealthRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthRequest proto.InternalMessageInfo
+
+type HealthResponse struct {
+	Status               HealthResponse_ServingStatus `protobuf:"varint,1,opt,name=status,proto3,enum=alert_manager.v1.HealthResponse_ServingStatus" json:"status,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *HealthResponse) Reset()         { *m = HealthResponse{} }
+func (m *HealthResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthResponse) ProtoMessage()    {}
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7875460681a1a04, []int{5}
+}
+
+func (m *HealthResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthResponse.Unmarshal(m, b)
+}
+func (m *HealthResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthResponse.Marshal(b, m, deterministic)
+}
+func (m *HealthResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthResponse.Merge(m, src)
+}
+func (m *HealthResponse) XXX_Size() int {
+	return xxx_messageInfo_HealthResponse.Size(m)
+}
+func (m *HealthResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthResponse proto.InternalMessageInfo
+
+func (m *HealthResponse) GetStatus() HealthResponse_ServingStatus {
+	if m != nil {
+		return m.Status
+	}
+	return HealthResponse_SERVING_STATUS_UNSPECIFIED
+}
+
+func init() {
+	proto.RegisterEnum("alert_manager.v1.Severity", Severity_name, Severity_value)
+	proto.RegisterEnum("alert_manager.v1.Status", Status_name, Status_value)
+	proto.RegisterEnum("alert_manager.v1.ResultCode", ResultCode_name, ResultCode_value)
+	proto.RegisterEnum("alert_manager.v1.HealthResponse_ServingStatus", HealthResponse_ServingStatus_name, HealthResponse_ServingStatus_value)
+	proto.RegisterType((*Alert)(nil), "alert_manager.v1.Alert")
+	proto.RegisterMapType((map[string]string)(nil), "alert_manager.v1.Alert.LabelsEntry")
+	proto.RegisterType((*SendAlertsRequest)(nil), "alert_manager.v1.SendAlertsRequest")
+	proto.RegisterType((*AlertResult)(nil), "alert_manager.v1.AlertResult")
+	proto.RegisterType((*SendAlertsResponse)(nil), "alert_manager.v1.SendAlertsResponse")
+	proto.RegisterType((*HealthRequest)(nil), "alert_manager.v1.HealthRequest")
+	proto.RegisterType((*HealthResponse)(nil), "alert_manager.v1.HealthResponse")
+}
+
+func init() {
+	proto.RegisterFile("listener/pb/v1/alert.proto", fileDescriptor_e7875460681a1a04)
+}
+
+var fileDescriptor_e7875460681a1a04 = []byte{
+	// 774 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x55, 0x5d, 0x73, 0x9b, 0x46,
+	0x14, 0x2d, 0x48, 0xc6, 0xce, 0x55, 0x2c, 0xe3, 0x8d, 0x5b, 0x33, 0xf4, 0x23, 0x1a, 0xa5, 0x0f,
+	0x1a, 0x3f, 0x80, 0xa3, 0x4e, 0x9b, 0xb4, 0x79, 0x22, 0x08, 0xb7, 0xa4, 0x58, 0xce, 0x2c, 0xd8,
+	0x99, 0xf6, 0x45, 0x83, 0xc4, 0x56, 0x66, 0xca, 0x87, 0xca, 0x2e, 0x9a, 0xea, 0xad, 0xff, 0xa6,
+	0x3f, 0xa0, 0x7f, 0xb0, 0xc3, 0x2e, 0x28, 0x96, 0x65, 0x39, 0x6f, 0x7b, 0xcf, 0x3d, 0xf7, 0xec,
+	0x61, 0xf7, 0x00, 0xa0, 0x27, 0x31, 0x65, 0x24, 0x23, 0x85, 0xb9, 0x98, 0x9a, 0xcb, 0x97, 0x66,
+	0x98, 0x90, 0x82, 0x19, 0x8b, 0x22, 0x67, 0x39, 0x52, 0x79, 0x31, 0x49, 0xc3, 0x2c, 0x9c, 0x93,
+	0xc2, 0x58, 0xbe, 0xd4, 0x9f, 0xcf, 0xf3, 0x7c, 0x9e, 0x10, 0x93, 0xf7, 0xa7, 0xe5, 0x1f, 0x26,
+	0x8b, 0x53, 0x42, 0x59, 0x98, 0x2e, 0xc4, 0x48, 0xff, 0xbf, 0x16, 0xec, 0x59, 0xd5, 0x14, 0xea,
+	0x82, 0x1c, 0x47, 0x9a, 0xd4, 0x93, 0x06, 0x4f, 0xb0, 0x1c, 0x47, 0x08, 0x41, 0x3b, 0x0b, 0x53,
+	0xa2, 0xc9, 0x1c, 0xe1, 0x6b, 0xa4, 0xc1, 0x7e, 0x44, 0x58, 0x18, 0x27, 0x54, 0x6b, 0x71, 0xb8,
+	0x29, 0xd1, 0x17, 0xa0, 0x44, 0x64, 0x19, 0xcf, 0x88, 0xd6, 0xe6, 0x8d, 0xba, 0xaa, 0x70, 0x92,
+	0xb1, 0x98, 0xad, 0xb4, 0x3d, 0x81, 0x8b, 0x0a, 0x19, 0xd0, 0xae, 0xac, 0x68, 0x4a, 0x4f, 0x1a,
+	0x74, 0x86, 0xba, 0x21, 0x7c, 0x1a, 0x8d, 0x4f, 0x23, 0x68, 0x7c, 0x62, 0xce, 0x43, 0x3f, 0xc0,
+	0x01, 0x25, 0x4b, 0x52, 0x54, 0x4a, 0xfb, 0x3d, 0x69, 0xd0, 0x1d, 0xea, 0xc6, 0xfd, 0xa7, 0x35,
+	0xfc, 0x9a, 0x81, 0xd7, 0x5c, 0x74, 0x0e, 0x0a, 0x65, 0x21, 0x2b, 0xa9, 0x76, 0xc0, 0xa7, 0xb4,
+	0x07, 0xa6, 0x78, 0x1f, 0xd7, 0xbc, 0xca, 0x31, 0xcd, 0xcb, 0x62, 0x46, 0xb4, 0x27, 0xc2, 0xb1,
+	0xa8, 0xd0, 0x1b, 0x50, 0x92, 0x70, 0x4a, 0x12, 0xaa, 0x41, 0xaf, 0x35, 0xe8, 0x0c, 0x5f, 0x6c,
+	0x2b, 0xf1, 0x83, 0x34, 0x3c, 0xce, 0x72, 0x32, 0x56, 0xac, 0x70, 0x3d, 0x52, 0x1d, 0x26, 0x23,
+	0x61, 0xaa, 0x75, 0xc4, 0x61, 0x56, 0x6b, 0xfd, 0x47, 0xe8, 0xdc, 0xa1, 0x22, 0x15, 0x5a, 0x7f,
+	0x92, 0x55, 0x7d, 0x01, 0xd5, 0x12, 0x9d, 0xc0, 0xde, 0x32, 0x4c, 0xca, 0xe6, 0x0a, 0x44, 0xf1,
+	0x93, 0xfc, 0x5a, 0xea, 0x8f, 0xe0, 0xd8, 0x27, 0x59, 0xc4, 0xf7, 0xa3, 0x98, 0xfc, 0x55, 0x12,
+	0xca, 0x90, 0x09, 0x0a, 0x77, 0x44, 0x35, 0x89, 0x1b, 0x3c, 0xdd, 0x61, 0x10, 0xd7, 0xb4, 0x7e,
+	0x0e, 0x1d, 0x01, 0x10, 0x5a, 0x26, 0xac, 0xda, 0x2e, 0xce, 0x22, 0xf2, 0x37, 0xb7, 0xb0, 0x87,
+	0x45, 0x81, 0xce, 0xa1, 0x3d, 0xcb, 0x23, 0xe1, 0xa1, 0x3b, 0xfc, 0x6a, 0x5b, 0x53, 0x4c, 0xdb,
+	0x79, 0x44, 0x30, 0x67, 0x56, 0x21, 0x49, 0x09, 0xa5, 0xe1, 0x9c, 0x34, 0x21, 0xa9, 0xcb, 0xfe,
+	0x25, 0xa0, 0xbb, 0xb6, 0xe9, 0x22, 0xcf, 0x28, 0x41, 0xaf, 0x60, 0xbf, 0xe0, 0x1a, 0x8d, 0xf1,
+	0xaf, 0x77, 0x19, 0xe7, 0x2c, 0xdc, 0xb0, 0xfb, 0x47, 0x70, 0xf8, 0x0b, 0x09, 0x13, 0x76, 0x5b,
+	0x9f, 0x40, 0xff, 0x5f, 0x09, 0xba, 0x0d, 0x52, 0x8b, 0x5f, 0xac, 0xef, 0x5f, 0xe2, 0x0f, 0x60,
+	0x6c, 0x6b, 0x6f, 0x4e, 0x18, 0x3e, 0x29, 0x96, 0x71, 0x36, 0xdf, 0x4c, 0x45, 0xff, 0x12, 0x0e,
+	0x37, 0x1a, 0xe8, 0x1b, 0xd0, 0x7d, 0x07, 0xdf, 0xb8, 0xe3, 0x9f, 0x27, 0x7e, 0x60, 0x05, 0xd7,
+	0xfe, 0xe4, 0x7a, 0xec, 0xbf, 0x77, 0x6c, 0xf7, 0xc2, 0x75, 0x46, 0xea, 0x67, 0xa8, 0x03, 0xfb,
+	0x75, 0x5f, 0x95, 0xd0, 0x11, 0x74, 0xc6, 0x57, 0xc1, 0xa4, 0x01, 0xe4, 0xb3, 0x12, 0x0e, 0x9a,
+	0xb0, 0x22, 0x0d, 0x4e, 0x7c, 0xe7, 0xc6, 0xc1, 0x6e, 0xf0, 0xdb, 0x3d, 0x8d, 0x63, 0x38, 0x5c,
+	0x77, 0xdc, 0xf1, 0xc5, 0x95, 0x2a, 0x6d, 0x40, 0x1f, 0x2c, 0x3c, 0x56, 0x65, 0x84, 0xa0, 0xbb,
+	0x86, 0x2e, 0xad, 0x77, 0x57, 0x58, 0x6d, 0xa1, 0xcf, 0xe1, 0x78, 0x8d, 0xd9, 0xd8, 0x0d, 0x5c,
+	0xdb, 0xf2, 0xd4, 0xf6, 0x99, 0x0b, 0x8a, 0xdf, 0xa4, 0x1c, 0x3d, 0x68, 0xfb, 0x19, 0x1c, 0xd5,
+	0xb8, 0xe5, 0x39, 0x38, 0x10, 0xf6, 0xab, 0x1d, 0x04, 0x68, 0x7b, 0x8e, 0x85, 0x9d, 0x91, 0x2a,
+	0x9f, 0xad, 0x00, 0x3e, 0xde, 0x3c, 0xfa, 0x12, 0x4e, 0xb1, 0xe3, 0x5f, 0x7b, 0xc1, 0xc4, 0xbe,
+	0x1a, 0x39, 0xf7, 0x34, 0x35, 0x38, 0xb9, 0xdb, 0xb4, 0x6c, 0xdb, 0x79, 0x1f, 0x38, 0x23, 0x55,
+	0x42, 0xa7, 0xf0, 0xec, 0x6e, 0xc7, 0x1d, 0xdf, 0x58, 0x9e, 0x3b, 0x52, 0xe5, 0x6d, 0x3d, 0xeb,
+	0xc6, 0x72, 0x3d, 0xeb, 0xad, 0xe7, 0xa8, 0xad, 0xe1, 0x3f, 0x32, 0x3c, 0xe5, 0x81, 0xe0, 0x37,
+	0x32, 0x23, 0xe8, 0x03, 0xc0, 0xc7, 0x5c, 0xa1, 0x17, 0x0f, 0x7d, 0x18, 0xee, 0xbd, 0x2c, 0xfa,
+	0xb7, 0x8f, 0x93, 0xea, 0xf4, 0xbc, 0x83, 0xa7, 0x3e, 0x2b, 0x48, 0x98, 0xd6, 0xd2, 0xbb, 0x5e,
+	0x29, 0xfd, 0xf1, 0xc8, 0x0e, 0xa4, 0x73, 0x09, 0xfd, 0x0a, 0x8a, 0x48, 0x1a, 0x7a, 0xbe, 0x3b,
+	0x83, 0xc2, 0x5c, 0xef, 0x53, 0x21, 0x7d, 0xfb, 0xea, 0xf7, 0xef, 0xe7, 0x31, 0xbb, 0x2d, 0xa7,
+	0xc6, 0x2c, 0x4f, 0xcd, 0x34, 0x5c, 0x95, 0x05, 0xa1, 0xb7, 0xaf, 0x87, 0xe6, 0xc6, 0xa0, 0xb9,
+	0xf9, 0xaf, 0x78, 0xb3, 0x98, 0x4e, 0x15, 0xfe, 0x85, 0xfd, 0xee, 0xff, 0x01, 0x00, 0x7a, 0xc2,
+	0xce, 0x04, 0x47, 0x06, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// AlertServiceClient is the client API for AlertService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AlertServiceClient interface {
+	// SendAlerts ingests a batch of alerts and returns a result for each alert
+	SendAlerts(ctx context.Context, in *SendAlertsRequest, opts ...grpc.CallOption) (*SendAlertsResponse, error)
+	// StreamAlerts ingests the alerts sent on the stream and sends back a result for
+	// each alert in the order they were received
+	StreamAlerts(ctx context.Context, opts ...grpc.CallOption) (AlertService_StreamAlertsClient, error)
+	// Health returns the serving status of the listener, it does not require a token
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type alertServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAlertServiceClient(cc grpc.ClientConnInterface) AlertServiceClient {
+	return &alertServiceClient{cc}
+}
+
+func (c *alertServiceClient) SendAlerts(ctx context.Context, in *SendAlertsRequest, opts ...grpc.CallOption) (*SendAlertsResponse, error) {
+	out := new(SendAlertsResponse)
+	err := c.cc.Invoke(ctx, "/alert_manager.v1.AlertService/SendAlerts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *alertServiceClient) StreamAlerts(ctx context.Context, opts ...grpc.CallOption) (AlertService_StreamAlertsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_AlertService_serviceDesc.Streams[0], "/alert_manager.v1.AlertService/StreamAlerts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &alertServiceStreamAlertsClient{stream}
+	return x, nil
+}
+
+type AlertService_StreamAlertsClient interface {
+	Send(*Alert) error
+	Recv() (*AlertResult, error)
+	grpc.ClientStream
+}
+
+type alertServiceStreamAlertsClient struct {
+	grpc.ClientStream
+}
+
+func (x *alertServiceStreamAlertsClient) Send(m *Alert) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *alertServiceStreamAlertsClient) Recv() (*AlertResult, error) {
+	m := new(AlertResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *alertServiceClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, "/alert_manager.v1.AlertService/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AlertServiceServer is the server API for AlertService service.
+type AlertServiceServer interface {
+	// SendAlerts ingests a batch of alerts and returns a result for each alert
+	SendAlerts(context.Context, *SendAlertsRequest) (*SendAlertsResponse, error)
+	// StreamAlerts ingests the alerts sent on the stream and sends back a result for
+	// each alert in the order they were received
+	StreamAlerts(AlertService_StreamAlertsServer) error
+	// Health returns the serving status of the listener, it does not require a token
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+}
+
+// UnimplementedAlertServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedAlertServiceServer struct {
+}
+
+func (*UnimplementedAlertServiceServer) SendAlerts(ctx context.Context, req *SendAlertsRequest) (*SendAlertsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendAlerts not implemented")
+}
+func (*UnimplementedAlertServiceServer) StreamAlerts(srv AlertService_StreamAlertsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamAlerts not implemented")
+}
+func (*UnimplementedAlertServiceServer) Health(ctx context.Context, req *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+
+func RegisterAlertServiceServer(s *grpc.Server, srv AlertServiceServer) {
+	s.RegisterService(&_AlertService_serviceDesc, srv)
+}
+
+func _AlertService_SendAlerts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendAlertsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlertServiceServer).SendAlerts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/alert_manager.v1.AlertService/SendAlerts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlertServiceServer).SendAlerts(ctx, req.(*SendAlertsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AlertService_StreamAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AlertServiceServer).StreamAlerts(&alertServiceStreamAlertsServer{stream})
+}
+
+type AlertService_StreamAlertsServer interface {
+	Send(*AlertResult) error
+	Recv() (*Alert, error)
+	grpc.ServerStream
+}
+
+type alertServiceStreamAlertsServer struct {
+	grpc.ServerStream
+}
+
+func (x *alertServiceStreamAlertsServer) Send(m *AlertResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *alertServiceStreamAlertsServer) Recv() (*Alert, error) {
+	m := new(Alert)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AlertService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlertServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/alert_manager.v1.AlertService/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlertServiceServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _AlertService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "alert_manager.v1.AlertService",
+	HandlerType: (*AlertServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendAlerts",
+			Handler:    _AlertService_SendAlerts_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _AlertService_Health_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamAlerts",
+			Handler:       _AlertService_StreamAlerts_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "listener/pb/v1/alert.proto",
+}
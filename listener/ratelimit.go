@@ -0,0 +1,260 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	RateLimit_REJECT = "reject"
+	RateLimit_SAMPLE = "sample"
+
+	rateLimitAlertName         = "Webhook Rate Limit Exceeded"
+	defaultRateLimitSampleRate = 0.1
+	defaultRateLimitClearAfter = 5 * time.Minute
+	anySource                  = "*"
+)
+
+// RateLimit limits the alerts received for a source or team to Rate alerts per second with
+// bursts of up to Burst alerts. Burst defaults to Rate, and at least 1.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+	// Action is reject to reject the alerts over the limit, or sample to keep SampleRate of
+	// them. Defaults to reject.
+	Action     string
+	SampleRate float64 `mapstructure:"sample_rate"`
+}
+
+func (l *RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, l.Rate)
+}
+
+func (l *RateLimit) validate() error {
+	if l.Rate <= 0 {
+		return fmt.Errorf("rate must be greater than 0")
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst must be at least 1")
+	}
+	if l.Action != "" && l.Action != RateLimit_REJECT && l.Action != RateLimit_SAMPLE {
+		return fmt.Errorf("invalid action %s", l.Action)
+	}
+	return nil
+}
+
+// sampleEvery returns n to keep every nth alert over the limit
+func (l *RateLimit) sampleEvery() int {
+	rate := l.SampleRate
+	if rate <= 0 || rate > 1 {
+		rate = defaultRateLimitSampleRate
+	}
+	return int(math.Round(1 / rate))
+}
+
+// RateLimits are the webhook rate limits per source and team. The * source limits each
+// source without a limit of its own.
+type RateLimits struct {
+	Sources map[string]*RateLimit
+	Teams   map[string]*RateLimit
+	// AlertTeam is the team of the alert raised when a source or team is throttled
+	AlertTeam string `mapstructure:"alert_team"`
+	// ClearAfter clears the alert once the source or team was not throttled for this long
+	ClearAfter time.Duration `mapstructure:"clear_after"`
+}
+
+// validate checks the limits when the config is loaded, a limit with a rate of 0 would
+// reject all alerts
+func (r *RateLimits) validate() error {
+	for kind, limits := range map[string]map[string]*RateLimit{"source": r.Sources, "team": r.Teams} {
+		for name, limit := range limits {
+			if err := limit.validate(); err != nil {
+				return fmt.Errorf("Invalid rate limit for %s %s: %v", kind, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RateLimits) clearAfter() time.Duration {
+	if r.ClearAfter > 0 {
+		return r.ClearAfter
+	}
+	return defaultRateLimitClearAfter
+}
+
+// limitState is the token bucket of a limited source or team
+type limitState struct {
+	kind, name string
+	limit      *RateLimit
+	tokens     float64
+	last       time.Time
+	// excess counts the alerts over the limit for sampling
+	excess int
+	// throttledAt is the last time an alert was over the limit, zero if not throttled
+	throttledAt time.Time
+}
+
+func (s *limitState) refill(now time.Time) {
+	s.tokens = math.Min(s.limit.burst(), s.tokens+now.Sub(s.last).Seconds()*s.limit.Rate)
+	s.last = now
+}
+
+func (s *limitState) String() string {
+	return s.kind + " " + s.name
+}
+
+// rateDecision is the outcome of an alert checked against the rate limits
+type rateDecision struct {
+	allowed bool
+	// sampled is true if the alert was over the limit and dropped by sampling
+	sampled bool
+	// retryAfter is when a rejected sender can retry
+	retryAfter time.Duration
+	reason     string
+	// throttled are the limits newly exceeded by the alert
+	throttled []*limitState
+}
+
+// rateLimiter keeps the state of the configured rate limits
+type rateLimiter struct {
+	states map[string]*limitState
+	sync.Mutex
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{states: make(map[string]*limitState)}
+}
+
+func (r *rateLimiter) state(kind, name string, limit *RateLimit, now time.Time) *limitState {
+	key := kind + "/" + name
+	s, ok := r.states[key]
+	if !ok {
+		s = &limitState{kind: kind, name: name, limit: limit, tokens: limit.burst(), last: now}
+		r.states[key] = s
+	}
+	s.refill(now)
+	return s
+}
+
+// allow checks an alert of the source and team against the limits and takes a token from
+// each if it is within all of them
+func (r *rateLimiter) allow(limits *RateLimits, source, team string, now time.Time) rateDecision {
+	r.Lock()
+	defer r.Unlock()
+	var states []*limitState
+	if l, ok := limits.Sources[source]; ok {
+		states = append(states, r.state("source", source, l, now))
+	} else if l, ok := limits.Sources[anySource]; ok {
+		states = append(states, r.state("source", source, l, now))
+	}
+	if l, ok := limits.Teams[team]; ok {
+		states = append(states, r.state("team", team, l, now))
+	}
+	var exceeded []*limitState
+	for _, s := range states {
+		if s.tokens < 1 {
+			exceeded = append(exceeded, s)
+		}
+	}
+	if len(exceeded) == 0 {
+		for _, s := range states {
+			s.tokens--
+		}
+		return rateDecision{allowed: true}
+	}
+	d := rateDecision{allowed: true}
+	for _, s := range exceeded {
+		if s.throttledAt.IsZero() {
+			d.throttled = append(d.throttled, s)
+		}
+		s.throttledAt = now
+		if s.limit.Action != RateLimit_SAMPLE {
+			// a rejection takes precedence over sampling
+			d.allowed, d.sampled = false, false
+			d.reason = fmt.Sprintf("Rate limit exceeded for %s", s)
+			if s.limit.Rate > 0 {
+				if retry := time.Duration((1 - s.tokens) / s.limit.Rate * float64(time.Second)); retry > d.retryAfter {
+					d.retryAfter = retry
+				}
+			}
+			continue
+		}
+		s.excess++
+		if s.excess%s.limit.sampleEvery() != 0 && (d.allowed || d.sampled) {
+			d.allowed, d.sampled = false, true
+			d.reason = fmt.Sprintf("Dropped by sampling, rate limit exceeded for %s", s)
+		}
+	}
+	return d
+}
+
+// expire returns the throttled limits that were not exceeded since clearAfter and resets them
+func (r *rateLimiter) expire(clearAfter time.Duration, now time.Time) []*limitState {
+	r.Lock()
+	defer r.Unlock()
+	var cleared []*limitState
+	for _, s := range r.states {
+		if !s.throttledAt.IsZero() && now.Sub(s.throttledAt) >= clearAfter {
+			s.throttledAt = time.Time{}
+			s.excess = 0
+			cleared = append(cleared, s)
+		}
+	}
+	return cleared
+}
+
+// sendRateLimitAlert raises or clears the alert of a throttled source or team
+func (k WebHookListener) sendRateLimitAlert(s *limitState, status string) {
+	team := k.RateLimits.AlertTeam
+	if team == "" {
+		team = "default"
+	}
+	alert := &WebHookAlert{
+		Name:    rateLimitAlertName,
+		Details: fmt.Sprintf("Webhook alerts of %s are over the rate limit of %v/s, alerts over the limit are %s", s, s.limit.Rate, s.limit.action()),
+		Entity:  s.String(),
+		Time:    time.Now(),
+		Level:   "WARN",
+		Status:  status,
+		Source:  "alert_manager",
+		Labels:  map[string]interface{}{"limit": s.kind, "throttled": s.name},
+	}
+	if err := sendAlert(k.listenCtx(), k.Name(), alert, team); err != nil {
+		glog.Errorf("Webhook: Unable to send rate limit alert for %s: %v", s, err)
+	}
+}
+
+// action describes what happens to the alerts over the limit
+func (l *RateLimit) action() string {
+	if l.Action == RateLimit_SAMPLE {
+		return "sampled"
+	}
+	return "rejected"
+}
+
+// clearRateLimitAlerts clears the alerts of sources and teams that are no longer throttled
+func (k WebHookListener) clearRateLimitAlerts(ctx context.Context) {
+	clearAfter := k.RateLimits.clearAfter()
+	ticker := time.NewTicker(clearAfter / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, s := range k.limiter.expire(clearAfter, now) {
+				glog.V(2).Infof("Webhook: %s no longer rate limited", s)
+				k.sendRateLimitAlert(s, Status_CLEARED)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
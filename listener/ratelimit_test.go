@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limits := &RateLimits{
+		Sources: map[string]*RateLimit{
+			"grafana": {Rate: 1, Burst: 2},
+			"*":       {Rate: 10, Burst: 1},
+		},
+		Teams: map[string]*RateLimit{"neteng": {Rate: 1, Action: RateLimit_SAMPLE, SampleRate: 0.5}},
+	}
+	r := newRateLimiter()
+	now := time.Now()
+
+	// bursts are allowed, alerts over the limit are rejected
+	assert.True(t, r.allow(limits, "grafana", "infra", now).allowed)
+	assert.True(t, r.allow(limits, "grafana", "infra", now).allowed)
+	d := r.allow(limits, "grafana", "infra", now)
+	assert.False(t, d.allowed)
+	assert.False(t, d.sampled)
+	assert.Equal(t, d.reason, "Rate limit exceeded for source grafana")
+	assert.Equal(t, d.retryAfter, time.Second)
+	if assert.Len(t, d.throttled, 1) {
+		assert.Equal(t, d.throttled[0].String(), "source grafana")
+	}
+	// the source is only reported throttled once
+	d = r.allow(limits, "grafana", "infra", now.Add(500*time.Millisecond))
+	assert.False(t, d.allowed)
+	assert.Empty(t, d.throttled)
+	assert.True(t, r.allow(limits, "grafana", "infra", now.Add(time.Second)).allowed)
+
+	// other sources have their own bucket of the * limit
+	assert.True(t, r.allow(limits, "prometheus", "infra", now).allowed)
+	assert.False(t, r.allow(limits, "prometheus", "infra", now).allowed)
+	assert.True(t, r.allow(limits, "syslog", "infra", now).allowed)
+
+	// every 2nd alert over the team limit is kept
+	later := now.Add(time.Minute)
+	assert.True(t, r.allow(limits, "grafana", "neteng", later).allowed)
+	d = r.allow(limits, "grafana", "neteng", later)
+	assert.False(t, d.allowed)
+	assert.True(t, d.sampled)
+	assert.Equal(t, d.reason, "Dropped by sampling, rate limit exceeded for team neteng")
+	assert.True(t, r.allow(limits, "grafana", "neteng", later).allowed)
+	assert.True(t, r.allow(limits, "grafana", "neteng", later).sampled)
+	// a rejecting limit takes precedence over sampling
+	r.allow(limits, "grafana", "infra", later)
+	r.allow(limits, "grafana", "infra", later)
+	d = r.allow(limits, "grafana", "neteng", later)
+	assert.False(t, d.allowed)
+	assert.False(t, d.sampled)
+
+	// throttled limits are cleared once they are not exceeded for clear_after
+	cleared := r.expire(time.Minute, later.Add(30*time.Second))
+	if assert.Len(t, cleared, 1) {
+		assert.Equal(t, cleared[0].String(), "source prometheus")
+	}
+	var names []string
+	for _, s := range r.expire(time.Minute, later.Add(time.Minute)) {
+		names = append(names, s.String())
+	}
+	assert.ElementsMatch(t, names, []string{"source grafana", "team neteng"})
+	assert.Empty(t, r.expire(time.Minute, later.Add(2*time.Minute)))
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	lis := newTestWebHookListener()
+	lis.RateLimits = &RateLimits{
+		Sources:   map[string]*RateLimit{"mocked": {Rate: 0.5, Burst: 1}},
+		Teams:     map[string]*RateLimit{"neteng": {Rate: 0.001, Burst: 1, Action: RateLimit_SAMPLE, SampleRate: 0.5}},
+		AlertTeam: "infra",
+	}
+	code, sent := postAlert(t, lis, newAlertRequest("source=mocked", "{}"))
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+
+	// the sender can retry a batch of only rate limited alerts, and the source is alerted on
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked", "{}"))
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("Retry-After"), "2")
+	var ing Ingestion
+	if err := json.NewDecoder(rr.Body).Decode(&ing); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, *ing.Results[0], AlertResult{Index: 0, Name: "Test Alert", Status: Result_REJECTED, Reason: "Rate limit exceeded for source mocked"})
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "Webhook Rate Limit Exceeded")
+	assert.Equal(t, event.Alert.Entity, "source mocked")
+	assert.Equal(t, event.Alert.Source, "alert_manager")
+	assert.Equal(t, event.Alert.Team, "infra")
+	assert.Equal(t, event.Alert.Labels["throttled"], "mocked")
+
+	// clears are sent on while the source is over its limit
+	code, sent = postAlert(t, lis, newAlertRequest("source=mocked", Status_CLEARED))
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+
+	// sampled alerts are not an error
+	rr = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked_reject&team=neteng", "some"))
+		close(done)
+	}()
+	assert.Equal(t, receiveEvent(t).Alert.Name, "Test Alert")
+	<-done
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, newAlertRequest("source=mocked_reject&team=neteng", "some"))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	ing = Ingestion{}
+	if err := json.NewDecoder(rr.Body).Decode(&ing); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ing.Results[3].Status, Result_SAMPLED)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Entity, "team neteng")
+
+	// the alert is cleared once the source is no longer throttled
+	for _, s := range lis.limiter.expire(0, time.Now()) {
+		go lis.sendRateLimitAlert(s, Status_CLEARED)
+		event = receiveEvent(t)
+		assert.Equal(t, event.Type, models.EventType_CLEARED)
+		assert.Equal(t, event.Alert.Name, "Webhook Rate Limit Exceeded")
+	}
+	assert.Contains(t, lis.statsSourceAlertsRecvd.counters, "mocked")
+	assert.Contains(t, lis.statsSourceThrottled.counters, "mocked")
+	assert.Contains(t, lis.statsSourceSampled.counters, "mocked_reject")
+}
+
+func TestRateLimitsInit(t *testing.T) {
+	lis := newTestWebHookListener()
+	assert.Nil(t, lis.Init())
+	lis.RateLimits = &RateLimits{Sources: map[string]*RateLimit{"*": {Rate: 0.5}}}
+	assert.Nil(t, lis.Init())
+	for _, limit := range []*RateLimit{{Rate: 0, Burst: 10}, {Rate: -1}, {Rate: 1, Burst: -1}, {Rate: 1, Action: "drop"}} {
+		lis.RateLimits = &RateLimits{Teams: map[string]*RateLimit{"neteng": limit}}
+		assert.NotNil(t, lis.Init(), "%+v", limit)
+	}
+}
@@ -0,0 +1,420 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gosnmp/gosnmp"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
+	"github.com/mayuresh82/alert_manager/plugins"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	snmpTrapOidVarbind = "1.3.6.1.6.3.1.1.4.1.0"
+	// snmpTrapsOid is the prefix of the standard traps, generic trap N of a v1 trap is snmpTraps.N+1
+	snmpTrapsOid = "1.3.6.1.6.3.1.1.5"
+	// snmpEnterpriseSpecific is the generic trap of v1 enterprise specific traps
+	snmpEnterpriseSpecific = 6
+	// snmpDeviceAgent identifies the agent address of the trap as the alert device
+	snmpDeviceAgent = "agent"
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// TrapRule maps a received trap to an alert
+type TrapRule struct {
+	// Name is the name of the alert raised or cleared by the trap
+	Name    string
+	TrapOid string `yaml:"trap_oid"`
+	// Match restricts the rule to traps whose varbinds match the regexes, keyed by varbind name
+	Match map[string]string
+	// Status is either alerting (default) or cleared
+	Status string
+	// Device is the varbind holding the device name, e.g. sysName. The agent address is
+	// used if not set or if the trap does not have the varbind.
+	Device string
+	// Entity is the varbind holding the entity, e.g. ifName. The device is used if not set.
+	Entity string
+	// Details is a template executed with the varbind values, e.g. "{{.ifName}} is down"
+	Details  string
+	Severity string
+	// Labels are the varbinds added as alert labels
+	Labels []string
+
+	match   map[string]*regexp.Regexp
+	details *template.Template
+}
+
+// TrapRules defines the varbind names and the rules used to convert traps to alerts
+type TrapRules struct {
+	// Varbinds maps varbind names to oids. Varbinds in a trap are matched by prefix so that
+	// ifName matches ifName.3
+	Varbinds map[string]string
+	Rules    []*TrapRule
+}
+
+// LoadTrapRules reads and validates the trap rules from a yaml file
+func LoadTrapRules(file string) (*TrapRules, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules := &TrapRules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("Unable to decode trap rules: %v", err)
+	}
+	for name, oid := range rules.Varbinds {
+		rules.Varbinds[name] = strings.TrimPrefix(oid, ".")
+	}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" || rule.TrapOid == "" {
+			return nil, fmt.Errorf("Trap rule %d: name and trap_oid are required", i)
+		}
+		rule.TrapOid = strings.TrimPrefix(rule.TrapOid, ".")
+		switch rule.Status {
+		case "":
+			rule.Status = Status_ALERTING
+		case Status_ALERTING, Status_CLEARED:
+		default:
+			return nil, fmt.Errorf("Trap rule %s: invalid status %s", rule.Name, rule.Status)
+		}
+		rule.match = make(map[string]*regexp.Regexp)
+		for vb, m := range rule.Match {
+			re, err := regexp.Compile(m)
+			if err != nil {
+				return nil, fmt.Errorf("Trap rule %s: invalid match for %s: %v", rule.Name, vb, err)
+			}
+			rule.match[vb] = re
+		}
+		details := rule.Details
+		if details == "" {
+			details = rule.Name
+		}
+		if rule.details, err = template.New(rule.Name).Option("missingkey=zero").Parse(details); err != nil {
+			return nil, fmt.Errorf("Trap rule %s: invalid details: %v", rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// values returns the trap varbind values keyed by varbind name
+func (r *TrapRules) values(vars []gosnmp.SnmpPDU) map[string]string {
+	values := make(map[string]string)
+	for _, v := range vars {
+		oid := strings.TrimPrefix(v.Name, ".")
+		for name, prefix := range r.Varbinds {
+			if oid == prefix || strings.HasPrefix(oid, prefix+".") {
+				values[name] = snmpValue(v)
+			}
+		}
+	}
+	return values
+}
+
+// find returns the first rule matching the trap
+func (r *TrapRules) find(trapOid string, values map[string]string) *TrapRule {
+	for _, rule := range r.Rules {
+		if rule.TrapOid != trapOid {
+			continue
+		}
+		matched := true
+		for vb, re := range rule.match {
+			if v, ok := values[vb]; !ok || !re.MatchString(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule
+		}
+	}
+	return nil
+}
+
+func snmpValue(v gosnmp.SnmpPDU) string {
+	switch val := v.Value.(type) {
+	case []byte:
+		return string(val)
+	case string:
+		return strings.TrimPrefix(val, ".")
+	}
+	return fmt.Sprintf("%v", v.Value)
+}
+
+// SnmpTrapListener receives SNMPv1, v2c and v3 traps and converts them to alerts based on the
+// trap rules
+type SnmpTrapListener struct {
+	// ListenAddr is the udp host:port to receive traps on, the listener is disabled if empty
+	ListenAddr string `mapstructure:"listen_addr"`
+	// Community is the accepted v1/v2c community. If empty, any community is accepted unless
+	// a v3 username is set, in which case v1 and v2c traps are dropped.
+	Community string
+	// v3 USM params. The security level is derived from the configured protocols.
+	Username       string
+	AuthProtocol   string `mapstructure:"auth_protocol"`
+	AuthPassphrase string `mapstructure:"auth_passphrase"`
+	PrivProtocol   string `mapstructure:"priv_protocol"`
+	PrivPassphrase string `mapstructure:"priv_passphrase"`
+	// EngineId is the hex encoded engine id of the trap senders
+	EngineId  string `mapstructure:"engine_id"`
+	RulesFile string `mapstructure:"rules_file"`
+	// Team is the team assigned to the alerts, defaults to default
+	Team string
+
+	rules *TrapRules
+
+	statTrapsRecvd     stats.Stat
+	statTrapsUnmatched stats.Stat
+	statAuthFailures   stats.Stat
+	statAlertsRejected stats.Stat
+}
+
+func NewSnmpTrapListener() *SnmpTrapListener {
+	return &SnmpTrapListener{
+		statTrapsRecvd:     stats.NewCounter("listener.snmptrap.traps_recvd"),
+		statTrapsUnmatched: stats.NewCounter("listener.snmptrap.traps_unmatched"),
+		statAuthFailures:   stats.NewCounter("listener.snmptrap.auth_failures"),
+		statAlertsRejected: stats.NewCounter("listener.snmptrap.alerts_rejected"),
+	}
+}
+
+func (s *SnmpTrapListener) Name() string {
+	return "snmptrap"
+}
+
+func (s *SnmpTrapListener) GetParsersList() []string {
+	return nil
+}
+
+func (s *SnmpTrapListener) Uri() string {
+	return fmt.Sprintf("udp://%s", s.ListenAddr)
+}
+
+func (s *SnmpTrapListener) params() (*gosnmp.GoSNMP, error) {
+	params := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: s.Community}
+	if s.Username == "" {
+		return params, nil
+	}
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:               s.Username,
+		AuthenticationProtocol: gosnmp.NoAuth,
+		PrivacyProtocol:        gosnmp.NoPriv,
+	}
+	if s.EngineId != "" {
+		id, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(s.EngineId), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid engine id %s: %v", s.EngineId, err)
+		}
+		sp.AuthoritativeEngineID = string(id)
+	}
+	flags := gosnmp.NoAuthNoPriv
+	if s.AuthProtocol != "" {
+		auth, ok := snmpAuthProtocols[strings.ToUpper(s.AuthProtocol)]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported auth protocol: %s", s.AuthProtocol)
+		}
+		sp.AuthenticationProtocol = auth
+		sp.AuthenticationPassphrase = s.AuthPassphrase
+		flags = gosnmp.AuthNoPriv
+	}
+	if s.PrivProtocol != "" {
+		if flags != gosnmp.AuthNoPriv {
+			return nil, fmt.Errorf("Privacy requires an auth protocol")
+		}
+		priv, ok := snmpPrivProtocols[strings.ToUpper(s.PrivProtocol)]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported priv protocol: %s", s.PrivProtocol)
+		}
+		sp.PrivacyProtocol = priv
+		sp.PrivacyPassphrase = s.PrivPassphrase
+		flags = gosnmp.AuthPriv
+	}
+	// v2c traps are still accepted, the version is read from each received packet
+	params.Version = gosnmp.Version3
+	params.SecurityModel = gosnmp.UserSecurityModel
+	params.MsgFlags = flags
+	params.SecurityParameters = sp
+	return params, nil
+}
+
+// v1TrapOid translates the generic and specific trap of a v1 trap to the snmpTrapOID of
+// the equivalent v2 trap as per RFC 3584 section 3.1
+func v1TrapOid(trap *gosnmp.SnmpPacket) string {
+	if trap.GenericTrap >= 0 && trap.GenericTrap < snmpEnterpriseSpecific {
+		return fmt.Sprintf("%s.%d", snmpTrapsOid, trap.GenericTrap+1)
+	}
+	enterprise := strings.TrimPrefix(trap.Enterprise, ".")
+	if enterprise == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s.0.%d", enterprise, trap.SpecificTrap)
+}
+
+// formatAlert converts a trap to an alert based on the first matching rule. A nil alert is
+// returned if no rule matches.
+func (s *SnmpTrapListener) formatAlert(trap *gosnmp.SnmpPacket, agent string) (*WebHookAlert, error) {
+	var trapOid string
+	if trap.Version == gosnmp.Version1 {
+		trapOid = v1TrapOid(trap)
+	} else {
+		for _, v := range trap.Variables {
+			if strings.TrimPrefix(v.Name, ".") == snmpTrapOidVarbind {
+				trapOid = snmpValue(v)
+				break
+			}
+		}
+	}
+	if trapOid == "" {
+		return nil, fmt.Errorf("Trap from %s has no snmpTrapOID", agent)
+	}
+	values := s.rules.values(trap.Variables)
+	rule := s.rules.find(trapOid, values)
+	if rule == nil {
+		return nil, nil
+	}
+	values[snmpDeviceAgent] = agent
+	device := agent
+	if v := values[rule.Device]; rule.Device != "" && v != "" {
+		device = v
+	}
+	entity := device
+	if rule.Entity != "" {
+		entity = values[rule.Entity]
+		if entity == "" {
+			return nil, fmt.Errorf("Trap %s from %s is missing the entity varbind %s", trapOid, agent, rule.Entity)
+		}
+	}
+	var details bytes.Buffer
+	if err := rule.details.Execute(&details, values); err != nil {
+		return nil, fmt.Errorf("Unable to format details of %s: %v", rule.Name, err)
+	}
+	labels := map[string]interface{}{"trap_oid": trapOid, "agent_addr": agent}
+	for _, l := range rule.Labels {
+		if v, ok := values[l]; ok {
+			labels[l] = v
+		}
+	}
+	return &WebHookAlert{
+		Name:    rule.Name,
+		Details: details.String(),
+		Device:  device,
+		Entity:  entity,
+		Time:    time.Now(),
+		Level:   rule.Severity,
+		Status:  rule.Status,
+		Source:  "snmptrap",
+		Labels:  labels,
+	}, nil
+}
+
+// authorized checks the community of v1 and v2c traps. Only v3 traps are accepted if a v3
+// username is set without a community. v3 traps are authenticated by the trap listener.
+func (s *SnmpTrapListener) authorized(trap *gosnmp.SnmpPacket) bool {
+	if trap.Version != gosnmp.Version1 && trap.Version != gosnmp.Version2c {
+		return true
+	}
+	if s.Community == "" {
+		return s.Username == ""
+	}
+	return trap.Community == s.Community
+}
+
+func (s *SnmpTrapListener) handleTrap(trap *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	s.statTrapsRecvd.Add(1)
+	if !s.authorized(trap) {
+		glog.Errorf("Snmptrap: Invalid community in %s trap from %s", trap.Version, addr.IP)
+		s.statAuthFailures.Add(1)
+		return
+	}
+	ctx, span := tracing.Start(context.Background(), "listener.snmptrap")
+	defer span.End()
+	agent := addr.IP.String()
+	span.SetAttribute("agent_addr", agent)
+	alert, err := s.formatAlert(trap, agent)
+	if err == nil && alert == nil {
+		glog.V(4).Infof("Snmptrap: No rule matched trap from %s", agent)
+		s.statTrapsUnmatched.Add(1)
+		return
+	}
+	if err == nil {
+		team := s.Team
+		if team == "" {
+			team = "default"
+		}
+		if err = sendAlert(ctx, s.Name(), alert, team); err == nil {
+			return
+		}
+	}
+	glog.Errorf("Snmptrap: Rejecting trap: %v", err)
+	s.statAlertsRejected.Add(1)
+	span.SetError(err)
+}
+
+// newTrapListener loads the trap rules and returns a trap listener for the configured
+// snmp params
+func (s *SnmpTrapListener) newTrapListener() (*gosnmp.TrapListener, error) {
+	rules, err := LoadTrapRules(s.RulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load trap rules: %v", err)
+	}
+	s.rules = rules
+	params, err := s.params()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config: %v", err)
+	}
+	tl := gosnmp.NewTrapListener()
+	tl.Params = params
+	tl.OnNewTrap = s.handleTrap
+	return tl, nil
+}
+
+func (s *SnmpTrapListener) Listen(ctx context.Context) {
+	if s.ListenAddr == "" {
+		glog.V(2).Infof("Snmptrap: No listen_addr configured, not listening for traps")
+		return
+	}
+	tl, err := s.newTrapListener()
+	if err != nil {
+		glog.Errorf("Snmptrap: %v", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		tl.Close()
+	}()
+	if err := tl.Listen(s.ListenAddr); err != nil {
+		glog.Errorf("Snmptrap: Unable to listen on %s: %v", s.ListenAddr, err)
+	}
+}
+
+func init() {
+	listener := NewSnmpTrapListener()
+	plugins.AddListener(listener)
+}
@@ -0,0 +1,231 @@
+package listener
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	ah "github.com/mayuresh82/alert_manager/handler"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testLinkDown = "1.3.6.1.6.3.1.1.5.3"
+	testLinkUp   = "1.3.6.1.6.3.1.1.5.4"
+	testBgpDown  = "1.3.6.1.2.1.15.7.2"
+)
+
+// startTrapListener starts the listener on a free local port
+func startTrapListener(t *testing.T, lis *SnmpTrapListener) (*gosnmp.TrapListener, uint16) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	tl, err := lis.newTrapListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tl.Listen("127.0.0.1:" + strconv.Itoa(port))
+	select {
+	case <-tl.Listening():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Trap listener did not start")
+	}
+	return tl, uint16(port)
+}
+
+func sendTrap(t *testing.T, client *gosnmp.GoSNMP, trapOid string, vars ...gosnmp.SnmpPDU) {
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+	trap := gosnmp.SnmpTrap{Variables: append([]gosnmp.SnmpPDU{
+		{Name: "1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(100)},
+		{Name: snmpTrapOidVarbind, Type: gosnmp.ObjectIdentifier, Value: trapOid},
+	}, vars...)}
+	if _, err := client.SendTrap(trap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func linkVars(ifName string) []gosnmp.SnmpPDU {
+	return []gosnmp.SnmpPDU{
+		{Name: "1.3.6.1.2.1.2.2.1.1.3", Type: gosnmp.Integer, Value: 3},
+		{Name: "1.3.6.1.2.1.31.1.1.1.1.3", Type: gosnmp.OctetString, Value: ifName},
+		{Name: "1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: "dev1"},
+	}
+}
+
+func receiveEvent(t *testing.T) *models.AlertEvent {
+	select {
+	case event := <-ah.ListenChan:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("No alert received for trap")
+	}
+	return nil
+}
+
+func TestSnmpTrapListenerV2c(t *testing.T) {
+	lis := NewSnmpTrapListener()
+	lis.Community = "public"
+	lis.RulesFile = "../testutil/testdata/test_snmptrap_rules.yaml"
+	lis.Team = "neteng"
+	tl, port := startTrapListener(t, lis)
+	defer tl.Close()
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: port, Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+
+	// linkDown raises the alert on the sysName device and ifName entity
+	sendTrap(t, client, testLinkDown, linkVars("et-0/0/1")...)
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "Link Down")
+	assert.Equal(t, event.Alert.Device.String, "dev1")
+	assert.Equal(t, event.Alert.Entity, "et-0/0/1")
+	assert.Equal(t, event.Alert.Description, "Interface et-0/0/1 is down")
+	assert.Equal(t, event.Alert.Severity, models.Sev_WARN)
+	assert.Equal(t, event.Alert.Source, "snmptrap")
+	assert.Equal(t, event.Alert.Team, "neteng")
+	assert.Equal(t, event.Alert.Labels["ifIndex"], "3")
+	assert.Equal(t, event.Alert.Labels["trap_oid"], testLinkDown)
+	assert.Equal(t, event.Alert.Labels["agent_addr"], "127.0.0.1")
+
+	// linkUp clears it
+	sendTrap(t, client, testLinkUp, linkVars("et-0/0/1")...)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_CLEARED)
+	assert.Equal(t, event.Alert.Name, "Link Down")
+	assert.Equal(t, event.Alert.Device.String, "dev1")
+	assert.Equal(t, event.Alert.Entity, "et-0/0/1")
+
+	// traps with the wrong community, unmatched varbinds or without a rule are dropped
+	bad := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: port, Version: gosnmp.Version2c, Community: "private", Timeout: time.Second}
+	sendTrap(t, bad, testLinkDown, linkVars("et-0/0/2")...)
+	established := gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.15.3.1.2.10.0.0.1", Type: gosnmp.Integer, Value: 6}
+	sendTrap(t, client, testBgpDown, established)
+	sendTrap(t, client, "1.3.6.1.4.1.2636.4.1.1", linkVars("et-0/0/3")...)
+
+	// the device defaults to the agent address
+	sendTrap(t, client, testBgpDown,
+		gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.15.3.1.2.10.0.0.1", Type: gosnmp.Integer, Value: 1},
+		gosnmp.SnmpPDU{Name: "1.3.6.1.2.1.15.3.1.7.10.0.0.1", Type: gosnmp.IPAddress, Value: "10.0.0.1"},
+	)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Name, "BGP Session Down")
+	assert.Equal(t, event.Alert.Device.String, "127.0.0.1")
+	assert.Equal(t, event.Alert.Entity, "10.0.0.1")
+	assert.Equal(t, event.Alert.Description, "BGP Session Down")
+	assert.Equal(t, event.Alert.Severity, models.Sev_CRITICAL)
+}
+
+func TestSnmpTrapListenerV1(t *testing.T) {
+	lis := NewSnmpTrapListener()
+	lis.Community = "public"
+	lis.RulesFile = "../testutil/testdata/test_snmptrap_rules.yaml"
+	tl, port := startTrapListener(t, lis)
+	defer tl.Close()
+	client := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: port, Version: gosnmp.Version1, Community: "public", Timeout: time.Second}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+
+	// the generic linkDown trap matches the rule of the v2 linkDown trap oid
+	trap := gosnmp.SnmpTrap{
+		Variables:    linkVars("et-0/0/1"),
+		Enterprise:   ".1.3.6.1.4.1.2636",
+		AgentAddress: "10.1.1.1",
+		GenericTrap:  2,
+		Timestamp:    100,
+	}
+	if _, err := client.SendTrap(trap); err != nil {
+		t.Fatal(err)
+	}
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "Link Down")
+	assert.Equal(t, event.Alert.Entity, "et-0/0/1")
+	assert.Equal(t, event.Alert.Labels["trap_oid"], testLinkDown)
+
+	// enterprise specific traps are <enterprise>.0.<specific>
+	assert.Equal(t, v1TrapOid(&gosnmp.SnmpPacket{SnmpTrap: gosnmp.SnmpTrap{
+		Enterprise: ".1.3.6.1.4.1.2636.4.1", GenericTrap: 6, SpecificTrap: 1,
+	}}), "1.3.6.1.4.1.2636.4.1.0.1")
+	assert.Equal(t, v1TrapOid(&gosnmp.SnmpPacket{SnmpTrap: gosnmp.SnmpTrap{GenericTrap: 6, SpecificTrap: 1}}), "")
+}
+
+func TestSnmpTrapListenerV3(t *testing.T) {
+	lis := NewSnmpTrapListener()
+	lis.RulesFile = "../testutil/testdata/test_snmptrap_rules.yaml"
+	lis.Username = "am"
+	lis.AuthProtocol = "sha"
+	lis.AuthPassphrase = "authpassword"
+	lis.PrivProtocol = "aes"
+	lis.PrivPassphrase = "privpassword"
+	lis.EngineId = "0x80001f8880e9bd0c1d12667a5100000000"
+	authFailures := &tu.CountStat{}
+	lis.statAuthFailures = authFailures
+	tl, port := startTrapListener(t, lis)
+	defer tl.Close()
+	client := &gosnmp.GoSNMP{
+		Target:        "127.0.0.1",
+		Port:          port,
+		Version:       gosnmp.Version3,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.AuthPriv,
+		Timeout:       time.Second,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "am",
+			AuthenticationProtocol:   gosnmp.SHA,
+			AuthenticationPassphrase: "authpassword",
+			PrivacyProtocol:          gosnmp.AES,
+			PrivacyPassphrase:        "privpassword",
+			AuthoritativeEngineID:    "\x80\x00\x1f\x88\x80\xe9\xbd\x0c\x1d\x12\x66\x7a\x51\x00\x00\x00\x00",
+			AuthoritativeEngineBoots: 1,
+		},
+	}
+	// traps that fail authentication are dropped
+	bad := *client
+	badParams := client.SecurityParameters.Copy().(*gosnmp.UsmSecurityParameters)
+	badParams.AuthenticationPassphrase = "wrongpassword"
+	bad.SecurityParameters = badParams
+	sendTrap(t, &bad, testLinkDown, linkVars("et-0/0/2")...)
+
+	// v2c traps are dropped as no community is configured
+	v2c := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: port, Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+	sendTrap(t, v2c, testLinkDown, linkVars("et-0/0/3")...)
+	deadline := time.Now().Add(2 * time.Second)
+	for authFailures.Value() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, authFailures.Value(), int64(1))
+
+	sendTrap(t, client, testLinkDown, linkVars("et-0/0/1")...)
+	event := receiveEvent(t)
+	assert.Equal(t, event.Alert.Name, "Link Down")
+	assert.Equal(t, event.Alert.Entity, "et-0/0/1")
+
+	// unless the community is also configured
+	withCommunity := *lis
+	withCommunity.Community = "public"
+	tl2, port2 := startTrapListener(t, &withCommunity)
+	defer tl2.Close()
+	v2c.Port = port2
+	sendTrap(t, v2c, testLinkDown, linkVars("et-0/0/3")...)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Entity, "et-0/0/3")
+	assert.Equal(t, authFailures.Value(), int64(1))
+}
+
+func TestLoadTrapRules(t *testing.T) {
+	_, err := LoadTrapRules("../snmptrap_rules.yaml")
+	assert.Nil(t, err)
+	_, err = LoadTrapRules("../testutil/testdata/missing.yaml")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,547 @@
+package listener
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
+	"github.com/mayuresh82/alert_manager/plugins"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// syslogMaxMsgLen is the max length of a message read from a tcp stream
+	syslogMaxMsgLen = 64 * 1024
+	syslogNilValue  = "-"
+	rfc3164Time     = "Jan _2 15:04:05"
+)
+
+// syslogLevels maps the syslog severity to the alert level, 0 is emergency and 7 debug
+var syslogLevels = []string{"CRITICAL", "CRITICAL", "CRITICAL", "MAJOR", "WARN", "INFO", "INFO", "INFO"}
+
+// SyslogMessage is a parsed RFC 3164 or RFC 5424 message. Fields that are not present in
+// the message are empty.
+type SyslogMessage struct {
+	Facility int
+	Severity int
+	Time     time.Time
+	Host     string
+	Program  string
+	ProcId   string
+	// MsgId and StructuredData are only set for RFC 5424 messages
+	MsgId          string
+	StructuredData string
+	Message        string
+}
+
+func parseSyslogPri(data string) (int, string, error) {
+	end := strings.IndexByte(data, '>')
+	if !strings.HasPrefix(data, "<") || end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("Invalid priority")
+	}
+	pri, err := strconv.Atoi(data[1:end])
+	if err != nil || pri > 191 {
+		return 0, "", fmt.Errorf("Invalid priority %s", data[1:end])
+	}
+	return pri, data[end+1:], nil
+}
+
+// nextField returns the next space separated field and the rest of the data
+func nextField(data string) (string, string) {
+	if i := strings.IndexByte(data, ' '); i >= 0 {
+		return data[:i], data[i+1:]
+	}
+	return data, ""
+}
+
+func syslogValue(field string) string {
+	if field == syslogNilValue {
+		return ""
+	}
+	return field
+}
+
+// ParseSyslog parses a syslog message in either RFC 5424 or RFC 3164 format
+func ParseSyslog(data string) (*SyslogMessage, error) {
+	data = strings.TrimRight(data, "\r\n\x00")
+	pri, rest, err := parseSyslogPri(data)
+	if err != nil {
+		return nil, err
+	}
+	msg := &SyslogMessage{Facility: pri / 8, Severity: pri % 8}
+	if strings.HasPrefix(rest, "1 ") {
+		err = msg.parse5424(rest[2:])
+	} else {
+		msg.parse3164(rest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (m *SyslogMessage) parse5424(data string) error {
+	var ts string
+	ts, data = nextField(data)
+	if ts != syslogNilValue {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("Invalid timestamp %s", ts)
+		}
+		m.Time = t
+	}
+	var host, app, procId, msgId string
+	host, data = nextField(data)
+	app, data = nextField(data)
+	procId, data = nextField(data)
+	msgId, data = nextField(data)
+	m.Host, m.Program, m.ProcId, m.MsgId = syslogValue(host), syslogValue(app), syslogValue(procId), syslogValue(msgId)
+	if data == "" {
+		return fmt.Errorf("Missing structured data")
+	}
+	if data[0] == '-' {
+		data = data[1:]
+	} else {
+		// structured data is one or more [id param="value"] elements, values may contain
+		// escaped quotes and brackets
+		i, inValue := 0, false
+		for ; i < len(data); i++ {
+			c := data[i]
+			if c == '\\' && inValue {
+				i++
+				continue
+			}
+			if c == '"' {
+				inValue = !inValue
+			}
+			if !inValue && c == ']' && (i+1 == len(data) || data[i+1] != '[') {
+				break
+			}
+		}
+		if i == len(data) || data[0] != '[' {
+			return fmt.Errorf("Invalid structured data")
+		}
+		m.StructuredData = data[:i+1]
+		data = data[i+1:]
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(data, " "), "\ufeff")
+	return nil
+}
+
+// parse3164 parses a BSD syslog message. Devices differ in what they send so every part
+// of the header is optional, and the remaining data is the message.
+func (m *SyslogMessage) parse3164(data string) {
+	if len(data) >= len(rfc3164Time) {
+		if t, err := time.ParseInLocation(rfc3164Time, data[:len(rfc3164Time)], time.Local); err == nil {
+			now := time.Now()
+			m.Time = t.AddDate(now.Year(), 0, 0)
+			// messages from the end of last year
+			if m.Time.Sub(now) > 24*time.Hour {
+				m.Time = m.Time.AddDate(-1, 0, 0)
+			}
+			data = strings.TrimPrefix(data[len(rfc3164Time):], " ")
+		}
+	}
+	if m.Time.IsZero() {
+		ts, rest := nextField(data)
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			m.Time = t
+			data = rest
+		}
+	}
+	// the hostname is omitted by some senders, in which case the first field is the tag
+	if field, rest := nextField(data); field != "" && !strings.HasSuffix(field, ":") && !strings.Contains(field, "[") {
+		if tag, _ := nextField(rest); strings.HasSuffix(tag, ":") || strings.Contains(tag, "[") {
+			m.Host = field
+			data = rest
+		}
+	}
+	tagEnd := strings.IndexFunc(data, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-./", r))
+	})
+	if tagEnd > 0 && (data[tagEnd] == '[' || data[tagEnd] == ':') {
+		m.Program = data[:tagEnd]
+		rest := data[tagEnd:]
+		if rest[0] == '[' {
+			if end := strings.IndexByte(rest, ']'); end > 0 {
+				m.ProcId = rest[1:end]
+				rest = rest[end+1:]
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			data = strings.TrimPrefix(rest[1:], " ")
+		} else {
+			m.Program, m.ProcId = "", ""
+		}
+	}
+	m.Message = data
+}
+
+// SyslogRule matches syslog messages and maps them to alerts. The named capture groups
+// name, device and entity of the message and clear regexes set the alert name, device
+// and entity, the other named groups are added as alert labels.
+type SyslogRule struct {
+	// Name is the alert name if the message does not capture a name
+	Name string
+	// Host and Program restrict the rule to messages from matching hosts and programs
+	Host    string
+	Program string
+	// Message raises the alert, Clear clears it
+	Message  string
+	Clear    string
+	Severity string
+
+	host, program, message, clear *regexp.Regexp
+}
+
+// SyslogRules are the rules used to convert syslog messages to alerts
+type SyslogRules struct {
+	Rules []*SyslogRule
+}
+
+func compileRegex(rule, field, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Syslog rule %s: invalid %s regex: %v", rule, field, err)
+	}
+	return re, nil
+}
+
+// LoadSyslogRules reads and validates the syslog rules from a yaml file
+func LoadSyslogRules(file string) (*SyslogRules, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules := &SyslogRules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("Unable to decode syslog rules: %v", err)
+	}
+	for i, rule := range rules.Rules {
+		if rule.Message == "" {
+			return nil, fmt.Errorf("Syslog rule %d: message is required", i)
+		}
+		if rule.host, err = compileRegex(rule.Name, "host", rule.Host); err != nil {
+			return nil, err
+		}
+		if rule.program, err = compileRegex(rule.Name, "program", rule.Program); err != nil {
+			return nil, err
+		}
+		if rule.message, err = compileRegex(rule.Name, "message", rule.Message); err != nil {
+			return nil, err
+		}
+		if rule.clear, err = compileRegex(rule.Name, "clear", rule.Clear); err != nil {
+			return nil, err
+		}
+		if rule.Name == "" && !hasGroup(rule.message, "name") {
+			return nil, fmt.Errorf("Syslog rule %d: name or a name capture group is required", i)
+		}
+		if rule.Name == "" && rule.clear != nil && !hasGroup(rule.clear, "name") {
+			return nil, fmt.Errorf("Syslog rule %d: the clear regex requires a name capture group if the rule has no name", i)
+		}
+	}
+	return rules, nil
+}
+
+func hasGroup(re *regexp.Regexp, group string) bool {
+	for _, name := range re.SubexpNames() {
+		if name == group {
+			return true
+		}
+	}
+	return false
+}
+
+// captureGroups returns the named groups captured by the regex, or nil if it does not match
+func captureGroups(re *regexp.Regexp, msg string) map[string]string {
+	if re == nil {
+		return nil
+	}
+	groups := re.FindStringSubmatch(msg)
+	if groups == nil {
+		return nil
+	}
+	captured := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && groups[i] != "" {
+			captured[name] = groups[i]
+		}
+	}
+	return captured
+}
+
+// formatAlert converts a message to an alert based on the first matching rule. A nil alert
+// is returned if no rule matches.
+func (r *SyslogRules) formatAlert(msg *SyslogMessage, sender string) *WebHookAlert {
+	for _, rule := range r.Rules {
+		if rule.host != nil && !rule.host.MatchString(msg.Host) {
+			continue
+		}
+		if rule.program != nil && !rule.program.MatchString(msg.Program) {
+			continue
+		}
+		status := Status_ALERTING
+		captured := captureGroups(rule.message, msg.Message)
+		if captured == nil {
+			status = Status_CLEARED
+			if captured = captureGroups(rule.clear, msg.Message); captured == nil {
+				continue
+			}
+		}
+		alert := &WebHookAlert{
+			Name:    rule.Name,
+			Details: msg.Message,
+			Device:  msg.Host,
+			Time:    msg.Time,
+			Level:   rule.Severity,
+			Status:  status,
+			Source:  "syslog",
+			Labels:  map[string]interface{}{"sender": sender},
+		}
+		if alert.Device == "" {
+			alert.Device = sender
+		}
+		if alert.Time.IsZero() {
+			alert.Time = time.Now()
+		}
+		if alert.Level == "" {
+			alert.Level = syslogLevels[msg.Severity]
+		}
+		if msg.Program != "" {
+			alert.Labels["program"] = msg.Program
+		}
+		for k, v := range captured {
+			switch k {
+			case "name":
+				alert.Name = v
+			case "device":
+				alert.Device = v
+			case "entity":
+				alert.Entity = v
+			default:
+				alert.Labels[k] = v
+			}
+		}
+		if alert.Entity == "" {
+			alert.Entity = alert.Device
+		}
+		return alert
+	}
+	return nil
+}
+
+// SyslogListener receives RFC 3164 and RFC 5424 syslog messages over udp and tcp and
+// converts them to alerts based on the syslog rules
+type SyslogListener struct {
+	// UdpAddr and TcpAddr are the addresses to listen on, each is disabled if empty
+	UdpAddr   string `mapstructure:"udp_addr"`
+	TcpAddr   string `mapstructure:"tcp_addr"`
+	RulesFile string `mapstructure:"rules_file"`
+	// Team is the team assigned to the alerts, defaults to default
+	Team string
+
+	rules *SyslogRules
+
+	statMsgsRecvd      stats.Stat
+	statMsgsUnmatched  stats.Stat
+	statMsgsError      stats.Stat
+	statAlertsRejected stats.Stat
+}
+
+func NewSyslogListener() *SyslogListener {
+	return &SyslogListener{
+		statMsgsRecvd:      stats.NewCounter("listener.syslog.msgs_recvd"),
+		statMsgsUnmatched:  stats.NewCounter("listener.syslog.msgs_unmatched"),
+		statMsgsError:      stats.NewCounter("listener.syslog.msgs_err"),
+		statAlertsRejected: stats.NewCounter("listener.syslog.alerts_rejected"),
+	}
+}
+
+func (s *SyslogListener) Name() string {
+	return "syslog"
+}
+
+func (s *SyslogListener) GetParsersList() []string {
+	return nil
+}
+
+func (s *SyslogListener) Uri() string {
+	var uris []string
+	if s.UdpAddr != "" {
+		uris = append(uris, "udp://"+s.UdpAddr)
+	}
+	if s.TcpAddr != "" {
+		uris = append(uris, "tcp://"+s.TcpAddr)
+	}
+	return strings.Join(uris, ",")
+}
+
+func (s *SyslogListener) handleMessage(data string, sender string) {
+	s.statMsgsRecvd.Add(1)
+	msg, err := ParseSyslog(data)
+	if err != nil {
+		glog.V(2).Infof("Syslog: Unable to parse message from %s: %v", sender, err)
+		s.statMsgsError.Add(1)
+		return
+	}
+	alert := s.rules.formatAlert(msg, sender)
+	if alert == nil {
+		s.statMsgsUnmatched.Add(1)
+		return
+	}
+	ctx, span := tracing.Start(context.Background(), "listener.syslog")
+	defer span.End()
+	span.SetAttribute("sender", sender)
+	team := s.Team
+	if team == "" {
+		team = "default"
+	}
+	if err := sendAlert(ctx, s.Name(), alert, team); err != nil {
+		glog.Errorf("Syslog: Rejecting message from %s: %v", sender, err)
+		s.statAlertsRejected.Add(1)
+		span.SetError(err)
+	}
+}
+
+func (s *SyslogListener) serveUdp(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, syslogMaxMsgLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				glog.Errorf("Syslog: Udp read error: %v", err)
+			}
+			return
+		}
+		s.handleMessage(string(buf[:n]), addr.(*net.UDPAddr).IP.String())
+	}
+}
+
+// readFrame reads a message from a tcp stream framed either by octet counting or by a
+// trailing newline as per RFC 6587. Frames longer than the buffer of r are rejected.
+func readFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] < '0' || b[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return "", fmt.Errorf("Message exceeds %d bytes", r.Size())
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		return string(line), err
+	}
+	count, err := r.ReadSlice(' ')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("Invalid message length")
+	}
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(count)))
+	if err != nil || n > syslogMaxMsgLen {
+		return "", fmt.Errorf("Invalid message length %s", count)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+func (s *SyslogListener) serveConn(ctx context.Context, conn net.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	sender := conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	r := bufio.NewReaderSize(conn, syslogMaxMsgLen)
+	for {
+		msg, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				glog.Errorf("Syslog: Closing connection from %s: %v", sender, err)
+			}
+			return
+		}
+		s.handleMessage(msg, sender)
+	}
+}
+
+func (s *SyslogListener) serveTcp(ctx context.Context, l net.Listener) {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				glog.Errorf("Syslog: Tcp accept error: %v", err)
+			}
+			return
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *SyslogListener) Listen(ctx context.Context) {
+	if s.UdpAddr == "" && s.TcpAddr == "" {
+		glog.V(2).Infof("Syslog: No udp_addr or tcp_addr configured, not listening for syslog")
+		return
+	}
+	rules, err := LoadSyslogRules(s.RulesFile)
+	if err != nil {
+		glog.Errorf("Syslog: Unable to load syslog rules: %v", err)
+		return
+	}
+	s.rules = rules
+	if s.UdpAddr != "" {
+		conn, err := net.ListenPacket("udp", s.UdpAddr)
+		if err != nil {
+			glog.Errorf("Syslog: Unable to listen on udp %s: %v", s.UdpAddr, err)
+			return
+		}
+		go s.serveUdp(ctx, conn)
+	}
+	if s.TcpAddr != "" {
+		l, err := net.Listen("tcp", s.TcpAddr)
+		if err != nil {
+			glog.Errorf("Syslog: Unable to listen on tcp %s: %v", s.TcpAddr, err)
+			return
+		}
+		go s.serveTcp(ctx, l)
+	}
+	<-ctx.Done()
+}
+
+func init() {
+	listener := NewSyslogListener()
+	plugins.AddListener(listener)
+}
@@ -0,0 +1,208 @@
+package listener
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected SyslogMessage
+	}{
+		{
+			data: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8",
+			expected: SyslogMessage{Facility: 4, Severity: 2, Host: "mymachine.example.com", Program: "su", MsgId: "ID47",
+				Message: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			data: `<165>1 2003-10-11T22:14:15.003Z host1 evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App\"l]"][examplePriority@32473 class="high"] ` + "\ufeffAn application event",
+			expected: SyslogMessage{Facility: 20, Severity: 5, Host: "host1", Program: "evntslog", ProcId: "1234", MsgId: "ID47",
+				StructuredData: `[exampleSDID@32473 iut="3" eventSource="App\"l]"][examplePriority@32473 class="high"]`,
+				Message:        "An application event"},
+		},
+		{
+			data:     "<13>1 - - - - - -",
+			expected: SyslogMessage{Facility: 1, Severity: 5},
+		},
+		{
+			data:     "<28>Oct 11 22:14:15 core-1 chassisd[1234]: CHASSISD_PSU_FAIL: PEM 1 failed\n",
+			expected: SyslogMessage{Facility: 3, Severity: 4, Host: "core-1", Program: "chassisd", ProcId: "1234", Message: "CHASSISD_PSU_FAIL: PEM 1 failed"},
+		},
+		{
+			data:     "<13>Feb  5 17:32:18 sshd: Accepted publickey",
+			expected: SyslogMessage{Facility: 1, Severity: 5, Program: "sshd", Message: "Accepted publickey"},
+		},
+		{
+			data:     "<13>2003-10-11T22:14:15Z host2 kernel: link down",
+			expected: SyslogMessage{Facility: 1, Severity: 5, Host: "host2", Program: "kernel", Message: "link down"},
+		},
+		{
+			data:     "<13>no header here",
+			expected: SyslogMessage{Facility: 1, Severity: 5, Message: "no header here"},
+		},
+	}
+	for _, tt := range tests {
+		msg, err := ParseSyslog(tt.data)
+		if !assert.Nil(t, err, tt.data) {
+			continue
+		}
+		msg.Time = time.Time{}
+		assert.Equal(t, tt.expected, *msg)
+	}
+
+	msg, _ := ParseSyslog("<28>Oct 11 22:14:15 core-1 chassisd: test")
+	assert.Equal(t, msg.Time.Month(), time.October)
+	assert.Equal(t, msg.Time.Day(), 11)
+	assert.False(t, msg.Time.After(time.Now().Add(24*time.Hour)))
+
+	for _, data := range []string{"", "no pri", "<192>bad pri", "<1>1 bad-time host - - - -", "<1>1 - host app - - [unterminated"} {
+		_, err := ParseSyslog(data)
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestSyslogRules(t *testing.T) {
+	rules, err := LoadSyslogRules("../testutil/testdata/test_syslog_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadSyslogRules("../syslog_rules.yaml")
+	assert.Nil(t, err)
+
+	// rules without a name capture it in both the message and clear regexes
+	dir, err := ioutil.TempDir("", "am_syslog_rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rules.yaml")
+	ioutil.WriteFile(file, []byte("rules:\n  - message: '^(?P<name>\\w+)_FAIL'\n    clear: '_OK$'\n"), 0600)
+	_, err = LoadSyslogRules(file)
+	assert.NotNil(t, err)
+	ioutil.WriteFile(file, []byte("rules:\n  - message: '^(?P<name>\\w+)_FAIL'\n    clear: '^(?P<name>\\w+)_OK'\n"), 0600)
+	_, err = LoadSyslogRules(file)
+	assert.Nil(t, err)
+
+	msg, _ := ParseSyslog("<28>Oct 11 22:14:15 core-1 chassisd[1234]: CHASSISD_PSU_FAIL: PEM 1 failed")
+	alert := rules.formatAlert(msg, "10.1.1.1")
+	assert.Equal(t, alert.Name, "PSU Failure")
+	assert.Equal(t, alert.Device, "core-1")
+	assert.Equal(t, alert.Entity, "PEM 1")
+	assert.Equal(t, alert.Status, Status_ALERTING)
+	assert.Equal(t, alert.Level, "CRITICAL")
+	assert.Equal(t, alert.Details, "CHASSISD_PSU_FAIL: PEM 1 failed")
+	assert.Equal(t, alert.Labels, map[string]interface{}{"sender": "10.1.1.1", "program": "chassisd"})
+
+	msg, _ = ParseSyslog("<30>Oct 11 22:14:15 core-1 chassisd[1234]: CHASSISD_PSU_OK: PEM 1 is OK")
+	alert = rules.formatAlert(msg, "10.1.1.1")
+	assert.Equal(t, alert.Name, "PSU Failure")
+	assert.Equal(t, alert.Entity, "PEM 1")
+	assert.Equal(t, alert.Status, Status_CLEARED)
+
+	// host does not match
+	msg, _ = ParseSyslog("<28>Oct 11 22:14:15 tor-1 chassisd[1234]: CHASSISD_PSU_FAIL: PEM 1 failed")
+	assert.Nil(t, rules.formatAlert(msg, "10.1.1.1"))
+
+	// captured name and labels, the device defaults to the sender and the severity to the
+	// syslog severity
+	msg, _ = ParseSyslog("<27>1 - - rpd - - - BGP_NEIGHBOR_STATE_CHANGED: BGP peer 10.0.0.1 (External AS 65001) changed state from Established to Idle (event RecvNotify)")
+	alert = rules.formatAlert(msg, "10.1.1.2")
+	assert.Equal(t, alert.Name, "BGP Session Down")
+	assert.Equal(t, alert.Device, "10.1.1.2")
+	assert.Equal(t, alert.Entity, "10.0.0.1")
+	assert.Equal(t, alert.Labels["peer_as"], "65001")
+	assert.Equal(t, alert.Labels["event"], "RecvNotify")
+
+	msg, _ = ParseSyslog("<28>1 - edge-2 chassisd - - - CHASSISD_FAN_FAIL: Fan Tray 0 Fan 1 failed")
+	alert = rules.formatAlert(msg, "10.1.1.3")
+	assert.Equal(t, alert.Name, "FAN_FAIL")
+	assert.Equal(t, alert.Entity, "Fan Tray 0 Fan 1")
+	assert.Equal(t, alert.Level, "WARN")
+}
+
+func TestSyslogListener(t *testing.T) {
+	lis := NewSyslogListener()
+	rules, err := LoadSyslogRules("../testutil/testdata/test_syslog_rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.rules = rules
+	lis.Team = "neteng"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go lis.serveUdp(ctx, udp)
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go lis.serveTcp(ctx, tcp)
+
+	psuFail := "<28>Oct 11 22:14:15 core-1 chassisd[1234]: CHASSISD_PSU_FAIL: PEM %d failed"
+	conn, err := net.Dial("udp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, psuFail, 0)
+	event := receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_ACTIVE)
+	assert.Equal(t, event.Alert.Name, "PSU Failure")
+	assert.Equal(t, event.Alert.Device.String, "core-1")
+	assert.Equal(t, event.Alert.Entity, "PEM 0")
+	assert.Equal(t, event.Alert.Source, "syslog")
+	assert.Equal(t, event.Alert.Team, "neteng")
+	assert.Equal(t, event.Alert.Labels["sender"], "127.0.0.1")
+
+	// tcp with newline and octet counted framing, unmatched messages are dropped
+	conn, err = net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, psuFail+"\n", 1)
+	fmt.Fprintf(conn, "<13>Oct 11 22:14:15 core-1 sshd[1]: Accepted publickey\n")
+	octet := fmt.Sprintf("<30>1 2003-10-11T22:14:15Z core-1 chassisd - - - CHASSISD_PSU_OK: PEM %d is OK", 2)
+	fmt.Fprintf(conn, "%d %s", len(octet), octet)
+	event = receiveEvent(t)
+	assert.Equal(t, event.Alert.Entity, "PEM 1")
+	event = receiveEvent(t)
+	assert.Equal(t, event.Type, models.EventType_CLEARED)
+	assert.Equal(t, event.Alert.Entity, "PEM 2")
+}
+
+func TestSyslogReadFrame(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("<13>msg 1\n9 <13>msg 2<13>msg 3"), 64)
+	for _, want := range []string{"<13>msg 1\n", "<13>msg 2", "<13>msg 3"} {
+		msg, err := readFrame(r)
+		assert.Nil(t, err)
+		assert.Equal(t, msg, want)
+	}
+
+	// frames longer than the buffer are rejected
+	for _, data := range []string{
+		"<13>" + strings.Repeat("a", 100) + "\n",
+		strings.Repeat("1", 100) + " <13>msg",
+		fmt.Sprintf("%d <13>msg", syslogMaxMsgLen+1),
+	} {
+		r = bufio.NewReaderSize(strings.NewReader(data), 64)
+		_, err := readFrame(r)
+		assert.NotNil(t, err)
+	}
+}
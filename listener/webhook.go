@@ -2,10 +2,13 @@ package listener
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
 	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
@@ -32,32 +36,86 @@ type WebHookAlert struct {
 	Status  string
 	Source  string
 	Labels  map[string]interface{}
+	// Index is the position of the alert in the received batch
+	Index int
 }
 
 type WebHookAlertData struct {
 	Alerts []*WebHookAlert
+	// Rejected are the alerts in the batch that could not be parsed
+	Rejected []*RejectedAlert
+	// Deduplicated are the alerts in the batch replaced by a later duplicate alert
+	Deduplicated []*RejectedAlert
+}
+
+// RejectedAlert is an alert that was rejected and the reason why
+type RejectedAlert struct {
+	// Index is the position of the alert in the received batch
+	Index  int    `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
 }
 
 type WebHookListener struct {
-	ListenAddr         string `mapstructure:"listen_addr"`
-	UseAuth            bool   `mapstructure:"use_auth"`
+	ListenAddr string `mapstructure:"listen_addr"`
+	// UseAuth enables http basic auth with the username and password
+	UseAuth            bool `mapstructure:"use_auth"`
 	Username, Password string
+	// TokenAuth enables bearer tokens, which are managed through the api and stored hashed
+	// in the DB
+	TokenAuth bool `mapstructure:"token_auth"`
+	// Signatures are the body signatures verified per source
+	Signatures map[string]*WebhookSignature
+	// IngestionTtl is how long the results of async requests can be looked up
+	IngestionTtl time.Duration `mapstructure:"ingestion_ttl"`
+	// MaxIngestions is the max number of results kept for lookup, the oldest are dropped first
+	MaxIngestions int `mapstructure:"max_ingestions"`
+	// RateLimits limit the alerts received per source and team, alerts are not limited if
+	// not set
+	RateLimits *RateLimits `mapstructure:"rate_limits"`
+
+	db         models.Dbase
+	ctx        context.Context
+	ingestions *ingestionStore
+	limiter    *rateLimiter
 
-	statRequestsRecvd stats.Stat
-	statRequestsError stats.Stat
-	statsAuthFailures stats.Stat
+	statRequestsRecvd  stats.Stat
+	statRequestsError  stats.Stat
+	statsAuthFailures  stats.Stat
+	statAlertsRejected stats.Stat
+	statAlertsDeduped  stats.Stat
+	// statsSourceAuthFailures are the auth failures per source
+	statsSourceAuthFailures *sourceCounters
+	// statsSourceAlertsRecvd, statsSourceThrottled and statsSourceSampled are the alerts
+	// received, rejected by rate limits and dropped by sampling per source
+	statsSourceAlertsRecvd *sourceCounters
+	statsSourceThrottled   *sourceCounters
+	statsSourceSampled     *sourceCounters
 }
 
 func NewWebHookListener() *WebHookListener {
 
 	return &WebHookListener{
-		statRequestsRecvd: stats.NewCounter("listener.webhook.requests_recvd"),
-		statRequestsError: stats.NewCounter("listener.webhook.requests_err"),
-		statsAuthFailures: stats.NewCounter("listener.webhook.auth_failures"),
+		statRequestsRecvd:       stats.NewCounter("listener.webhook.requests_recvd"),
+		statRequestsError:       stats.NewCounter("listener.webhook.requests_err"),
+		statsAuthFailures:       stats.NewCounter("listener.webhook.auth_failures"),
+		statAlertsRejected:      stats.NewCounter("listener.webhook.alerts_rejected"),
+		statAlertsDeduped:       stats.NewCounter("listener.webhook.alerts_deduplicated"),
+		statsSourceAuthFailures: newSourceCounters("listener.webhook.auth_failures"),
+		statsSourceAlertsRecvd:  newSourceCounters("listener.webhook.alerts_recvd"),
+		statsSourceThrottled:    newSourceCounters("listener.webhook.alerts_throttled"),
+		statsSourceSampled:      newSourceCounters("listener.webhook.alerts_sampled"),
+		ingestions:              newIngestionStore(defaultIngestionTtl),
+		limiter:                 newRateLimiter(),
 	}
 }
 
-func (k *WebHookListener) sanityCheck(d *WebHookAlert) error {
+// SetDb sets the DB that webhook tokens are looked up in
+func (k *WebHookListener) SetDb(db models.Dbase) {
+	k.db = db
+}
+
+func sanityCheck(d *WebHookAlert) error {
 	// alert name should only contain alpha-numeric chars, spaces or underscores
 	reg, err := regexp.Compile("[^a-zA-Z0-9_\\s]+")
 	if err != nil {
@@ -70,8 +128,10 @@ func (k *WebHookListener) sanityCheck(d *WebHookAlert) error {
 	return nil
 }
 
-func (k *WebHookListener) formatAlertEvent(d *WebHookAlert, team string) (*models.AlertEvent, error) {
-	if err := k.sanityCheck(d); err != nil {
+// formatAlertEvent converts a received alert into an alert event for the handler, applying
+// the alert config if the alert is defined
+func formatAlertEvent(d *WebHookAlert, team string) (*models.AlertEvent, error) {
+	if err := sanityCheck(d); err != nil {
 		return nil, err
 	}
 	// check if the alert exists in the definition
@@ -88,6 +148,7 @@ func (k *WebHookListener) formatAlertEvent(d *WebHookAlert, team string) (*model
 	}
 	event := &models.AlertEvent{}
 	event.Alert = models.NewAlert(d.Name, d.Details, d.Entity, d.Source, scope, team, d.Id, d.Time, d.Level, false)
+	event.Alert.ReceivedAt = time.Now()
 	if d.Device != "" {
 		event.Alert.AddDevice(d.Device)
 	}
@@ -119,28 +180,30 @@ func (k *WebHookListener) formatAlertEvent(d *WebHookAlert, team string) (*model
 	return event, nil
 }
 
-func (k *WebHookListener) basicAuth(h http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		defer h.ServeHTTP(w, r)
-		if !k.UseAuth {
-			return
-		}
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-
-		username, password, authOK := r.BasicAuth()
-		if !authOK {
-			k.statsAuthFailures.Add(1)
-			http.Error(w, "Not authorized", http.StatusUnauthorized)
-			return
-		}
+// sendAlert formats a single alert received by the named listener and sends it to the
+// handler as part of the trace in ctx. It returns once the handler accepted the alert or
+// ctx is done.
+func sendAlert(ctx context.Context, listener string, alert *WebHookAlert, team string) error {
+	event, err := formatAlertEvent(alert, team)
+	if err != nil {
+		return err
+	}
+	return sendEvent(ctx, listener, event)
+}
 
-		if username != k.Username || password != k.Password {
-			k.statsAuthFailures.Add(1)
-			http.Error(w, "Not authorized", http.StatusUnauthorized)
-			return
-		}
+// sendEvent sends a formatted alert event to the handler as part of the trace in ctx
+func sendEvent(ctx context.Context, listener string, event *models.AlertEvent) error {
+	_, span := tracing.Start(ctx, "listener."+listener+".alert")
+	defer span.End()
+	span.SetAttribute("alert_name", event.Alert.Name)
+	event.Alert.Trace = span.Context
+	select {
+	case ah.ListenChan <- event:
+	case <-ctx.Done():
+		span.SetError(ctx.Err())
+		return ctx.Err()
 	}
+	return nil
 }
 
 func (k WebHookListener) pingHandler(w http.ResponseWriter, r *http.Request) {
@@ -149,6 +212,15 @@ func (k WebHookListener) pingHandler(w http.ResponseWriter, r *http.Request) {
 
 func (k WebHookListener) httpHandler(w http.ResponseWriter, r *http.Request) {
 	k.statRequestsRecvd.Add(1)
+	// join the trace of the sender if it sent a traceparent header
+	ctx := r.Context()
+	if h := r.Header.Get("traceparent"); h != "" {
+		if parent, err := tracing.ParseTraceparent(h); err == nil {
+			ctx = tracing.ContextWithSpanContext(ctx, parent)
+		}
+	}
+	ctx, span := tracing.Start(ctx, "listener.webhook")
+	defer span.End()
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -170,6 +242,7 @@ func (k WebHookListener) httpHandler(w http.ResponseWriter, r *http.Request) {
 	if !ok || len(source) != 1 {
 		glog.Errorf("No query found in URL: %v", r.URL)
 		k.statRequestsError.Add(1)
+		span.SetError(fmt.Errorf("No query found in URL"))
 		http.Error(w, "No query found in URL", http.StatusBadRequest)
 		return
 	}
@@ -180,15 +253,34 @@ func (k WebHookListener) httpHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		glog.V(2).Infof("No team specified in URL, using 'default'")
 	}
-	var parser Parser
-	for _, p := range parsers {
-		if p.Name() == source[0] {
-			parser = p
-			break
+	span.SetAttribute("source", source[0])
+	span.SetAttribute("team", team)
+	parser := GetParser(source[0])
+	// unauthorized requests are rejected before parsing
+	if status, err := k.authorize(r, body, source[0], team); err != nil {
+		glog.Errorf("Webhook: Rejecting request from %s for source %s: %v", r.RemoteAddr, source[0], err)
+		span.SetError(err)
+		if status != http.StatusUnauthorized {
+			k.statRequestsError.Add(1)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		k.statsAuthFailures.Add(1)
+		// only known sources are tagged, the source query is set by the client
+		if parser != nil {
+			k.statsSourceAuthFailures.Add(source[0], 1)
+		} else {
+			k.statsSourceAuthFailures.Add("unknown", 1)
 		}
+		if k.UseAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		}
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
 	}
 	if parser == nil {
 		k.statRequestsError.Add(1)
+		span.SetError(fmt.Errorf("No parser found for source %s", source[0]))
 		glog.Errorf("No parser found in alert definition")
 		http.Error(w, "No parser found in alert definition", http.StatusInternalServerError)
 		return
@@ -198,19 +290,160 @@ func (k WebHookListener) httpHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		glog.Error(err)
 		k.statRequestsError.Add(1)
+		span.SetError(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	async, _ := strconv.ParseBool(queries.Get("async"))
+	// format all alerts first so that the batch is either forwarded or rejected per alert
+	ing := newIngestion(source[0], team)
+	for _, r := range data.Rejected {
+		ing.add(r.Index, r.Name, Result_REJECTED, r.Reason)
+	}
+	for _, r := range data.Deduplicated {
+		ing.add(r.Index, r.Name, Result_DEDUPLICATED, r.Reason)
+	}
+	var (
+		events     []*models.AlertEvent
+		results    []*AlertResult
+		throttled  int
+		retryAfter time.Duration
+	)
+	k.statsSourceAlertsRecvd.Add(source[0], int64(len(data.Alerts)+len(data.Rejected)+len(data.Deduplicated)))
 	for _, alert := range data.Alerts {
-		event, err := k.formatAlertEvent(alert, team)
+		event, err := formatAlertEvent(alert, team)
 		if err != nil {
 			glog.Error(err)
+			ing.add(alert.Index, alert.Name, Result_REJECTED, err.Error())
+			continue
+		}
+		// clears are never rate limited, a dropped clear would leave the alert active
+		if k.RateLimits != nil && alert.Status != Status_CLEARED {
+			d := k.limiter.allow(k.RateLimits, source[0], team, time.Now())
+			for _, throttled := range d.throttled {
+				glog.Errorf("Webhook: %s is over its rate limit", throttled)
+				go k.sendRateLimitAlert(throttled, Status_ALERTING)
+			}
+			if !d.allowed {
+				status := Result_REJECTED
+				if d.sampled {
+					status = Result_SAMPLED
+					k.statsSourceSampled.Add(source[0], 1)
+				} else {
+					throttled++
+					k.statsSourceThrottled.Add(source[0], 1)
+				}
+				if d.retryAfter > retryAfter {
+					retryAfter = d.retryAfter
+				}
+				ing.add(alert.Index, alert.Name, status, d.reason)
+				continue
+			}
+		}
+		events = append(events, event)
+		results = append(results, ing.add(alert.Index, alert.Name, Result_ACCEPTED, ""))
+	}
+	ing.sortResults()
+	if len(data.Deduplicated) > 0 {
+		k.statAlertsDeduped.Add(int64(len(data.Deduplicated)))
+	}
+	if rejected := ing.count(Result_REJECTED); rejected > 0 {
+		k.statAlertsRejected.Add(int64(rejected))
+		span.SetAttribute("alerts_rejected", strconv.Itoa(rejected))
+	}
+	if len(events) == 0 && throttled > 0 {
+		// only rate limited alerts are rejected, the sender can retry the whole batch
+		ing.complete()
+		k.statRequestsError.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		k.writeIngestion(w, http.StatusTooManyRequests, ing)
+		return
+	}
+	// the request fails if every alert is rejected, sampled alerts are not retried
+	if len(events) == 0 && ing.count(Result_REJECTED) > 0 && ing.count(Result_SAMPLED) == 0 {
+		ing.complete()
+		k.statRequestsError.Add(1)
+		k.writeIngestion(w, http.StatusBadRequest, ing)
+		return
+	}
+	// the alerts are sent as part of the request trace but only stop when the listener stops,
+	// so that the batch is not half applied if the client goes away
+	sendCtx := tracing.ContextWithSpanContext(k.listenCtx(), span.Context)
+	if async {
+		if err := k.ingestions.add(ing); err != nil {
 			k.statRequestsError.Add(1)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			span.SetError(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		span.SetAttribute("ingestion_id", ing.Id)
+		go k.sendEvents(sendCtx, ing, events, results)
+		k.writeIngestion(w, http.StatusAccepted, ing)
+		return
+	}
+	k.sendEvents(sendCtx, ing, events, results)
+	status := http.StatusOK
+	if len(events) > 0 && ing.count(Result_ACCEPTED) == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	k.writeIngestion(w, status, ing)
+}
+
+// sendEvents sends the accepted alerts of the batch to the handler and completes the
+// ingestion. Alerts not sent before ctx is done are rejected.
+func (k WebHookListener) sendEvents(ctx context.Context, ing *Ingestion, events []*models.AlertEvent, results []*AlertResult) {
+	defer ing.complete()
+	for i, event := range events {
+		if err := sendEvent(ctx, "webhook", event); err != nil {
+			glog.Errorf("Webhook: Unable to send alert %s: %v", event.Alert.Name, err)
+			ing.reject(results[i], "Listener stopped")
+			k.statAlertsRejected.Add(1)
+		}
+	}
+}
+
+func (k WebHookListener) writeIngestion(w http.ResponseWriter, status int, ing *Ingestion) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ing.snapshot())
+}
+
+// ingestionHandler returns the results of an async request by ingestion id. The request
+// needs the same token or basic auth as alerts of the source and team of the ingestion.
+func (k WebHookListener) ingestionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/listener/ingestion/"), "/")
+	ing, ok := k.ingestions.get(id)
+	if !ok {
+		http.Error(w, "Ingestion not found", http.StatusNotFound)
+		return
+	}
+	if status, err := k.authorizeLookup(r, ing.Source, ing.Team); err != nil {
+		glog.Errorf("Webhook: Rejecting ingestion request from %s for source %s: %v", r.RemoteAddr, ing.Source, err)
+		if status != http.StatusUnauthorized {
+			http.Error(w, err.Error(), status)
 			return
 		}
-		ah.ListenChan <- event
+		k.statsAuthFailures.Add(1)
+		k.statsSourceAuthFailures.Add(ing.Source, 1)
+		if k.UseAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		}
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ing)
+}
+
+func (k WebHookListener) listenCtx() context.Context {
+	if k.ctx == nil {
+		return context.Background()
+	}
+	return k.ctx
 }
 
 func (k *WebHookListener) Name() string {
@@ -234,8 +467,27 @@ func (k *WebHookListener) Uri() string {
 	return fmt.Sprintf("http://%s/listener/alert/", addr)
 }
 
+// Init validates the rate limits once the config is loaded
+func (k *WebHookListener) Init() error {
+	if k.RateLimits == nil {
+		return nil
+	}
+	return k.RateLimits.validate()
+}
+
 func (k WebHookListener) Listen(ctx context.Context) {
-	http.HandleFunc("/listener/alert/", k.basicAuth(k.httpHandler))
+	k.ctx = ctx
+	if k.IngestionTtl > 0 {
+		k.ingestions.ttl = k.IngestionTtl
+	}
+	if k.MaxIngestions > 0 {
+		k.ingestions.max = k.MaxIngestions
+	}
+	if k.RateLimits != nil {
+		go k.clearRateLimitAlerts(ctx)
+	}
+	http.HandleFunc("/listener/alert/", k.httpHandler)
+	http.HandleFunc("/listener/ingestion/", k.ingestionHandler)
 	http.HandleFunc("/listener/ping/", k.pingHandler)
 	srv := &http.Server{Addr: k.ListenAddr, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
 	idleConnsClosed := make(chan struct{})
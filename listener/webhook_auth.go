@@ -0,0 +1,173 @@
+package listener
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+)
+
+const defaultSignatureMaxAge = 5 * time.Minute
+
+var signatureHashes = map[string]func() hash.Hash{
+	"":       sha256.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// WebhookSignature verifies the HMAC signature of the request body sent by a source, e.g.
+// github sends a sha256=<hex hmac> X-Hub-Signature-256 header.
+type WebhookSignature struct {
+	Secret string
+	// Header holds the hex encoded signature, with an optional Prefix
+	Header string
+	Prefix string
+	// Algorithm is sha1, sha256 or sha512, defaults to sha256
+	Algorithm string
+	// TimestampHeader holds the unix time the request was signed at, the signed message is
+	// then <timestamp>:<body>. Requests older than MaxAge are rejected.
+	TimestampHeader string        `mapstructure:"timestamp_header"`
+	MaxAge          time.Duration `mapstructure:"max_age"`
+}
+
+// Verify checks the signature of the request body
+func (s *WebhookSignature) Verify(r *http.Request, body []byte) error {
+	newHash, ok := signatureHashes[s.Algorithm]
+	if !ok {
+		return fmt.Errorf("Unsupported signature algorithm %s", s.Algorithm)
+	}
+	sig := r.Header.Get(s.Header)
+	if sig == "" || !strings.HasPrefix(sig, s.Prefix) {
+		return fmt.Errorf("Missing signature header %s", s.Header)
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, s.Prefix))
+	if err != nil {
+		return fmt.Errorf("Invalid signature: %v", err)
+	}
+	mac := hmac.New(newHash, []byte(s.Secret))
+	if s.TimestampHeader != "" {
+		ts := r.Header.Get(s.TimestampHeader)
+		secs, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid signature timestamp %q", ts)
+		}
+		maxAge := s.MaxAge
+		if maxAge == 0 {
+			maxAge = defaultSignatureMaxAge
+		}
+		if age := time.Since(time.Unix(secs, 0)); age > maxAge || age < -maxAge {
+			return fmt.Errorf("Signature timestamp %s too old", ts)
+		}
+		mac.Write([]byte(ts + ":"))
+	}
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("Invalid signature")
+	}
+	return nil
+}
+
+// sourceCounters are the counters of a stat per alert source, created on first use with
+// the source as a label
+type sourceCounters struct {
+	name     string
+	counters map[string]stats.Stat
+	sync.Mutex
+}
+
+func newSourceCounters(name string) *sourceCounters {
+	return &sourceCounters{name: name, counters: make(map[string]stats.Stat)}
+}
+
+func (c *sourceCounters) Add(source string, value int64) {
+	c.Lock()
+	defer c.Unlock()
+	counter, ok := c.counters[source]
+	if !ok {
+		counter = stats.NewCounterWithLabels(c.name, map[string]string{"source": source})
+		c.counters[source] = counter
+	}
+	counter.Add(value)
+}
+
+// lookupToken returns the webhook token in the DB matching the bearer token, if any
+func (k WebHookListener) lookupToken(ctx context.Context, token string) (*models.WebhookToken, error) {
+	var tokens models.WebhookTokens
+	tx := k.db.NewTx()
+	err := models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
+		var err error
+		tokens, err = tx.SelectWebhookTokens(models.QuerySelectWebhookTokenByHash, models.HashToken(token))
+		return err
+	})
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	return tokens[0], nil
+}
+
+// authorize authenticates a request for alerts of the source and team. Sources with a
+// signature configured must sign the body, other requests need a bearer token valid for
+// the source and team if token auth is enabled, or the basic auth credentials. It returns
+// the http status of the failure if the request is not authorized.
+func (k WebHookListener) authorize(r *http.Request, body []byte, source, team string) (int, error) {
+	if sig, ok := k.Signatures[source]; ok {
+		if err := sig.Verify(r, body); err != nil {
+			return http.StatusUnauthorized, err
+		}
+		return http.StatusOK, nil
+	}
+	return k.authorizeCredentials(r, source, team)
+}
+
+// authorizeLookup checks the credentials of a request for the results of an ingestion. A
+// signature of the empty body can be replayed, so signed sources need a token or basic auth.
+func (k WebHookListener) authorizeLookup(r *http.Request, source, team string) (int, error) {
+	if _, ok := k.Signatures[source]; ok && !k.UseAuth && !k.TokenAuth {
+		return http.StatusUnauthorized, fmt.Errorf("Lookups of signed source %s need token or basic auth", source)
+	}
+	return k.authorizeCredentials(r, source, team)
+}
+
+// authorizeCredentials checks the bearer token or basic auth credentials of a request
+func (k WebHookListener) authorizeCredentials(r *http.Request, source, team string) (int, error) {
+	if !k.UseAuth && !k.TokenAuth {
+		return http.StatusOK, nil
+	}
+	if k.TokenAuth && k.db != nil {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token, err := k.lookupToken(r.Context(), strings.TrimPrefix(auth, "Bearer "))
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("Unable to verify token: %v", err)
+			}
+			if token == nil {
+				return http.StatusUnauthorized, fmt.Errorf("Invalid token")
+			}
+			if !token.Authorizes(source, team) {
+				return http.StatusUnauthorized, fmt.Errorf("Token %s not valid for source %s and team %s", token.Name, source, team)
+			}
+			return http.StatusOK, nil
+		}
+	}
+	if k.UseAuth {
+		username, password, ok := r.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(username), []byte(k.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(k.Password)) == 1 {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusUnauthorized, fmt.Errorf("Missing or invalid credentials")
+}
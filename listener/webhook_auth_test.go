@@ -0,0 +1,249 @@
+package listener
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	ah "github.com/mayuresh82/alert_manager/handler"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDb struct {
+	tokens models.WebhookTokens
+}
+
+func (d *mockDb) NewTx() models.Txn {
+	return &mockTx{db: d}
+}
+
+func (d *mockDb) Close() error {
+	return nil
+}
+
+type mockTx struct {
+	*models.Tx
+	db *mockDb
+}
+
+func (tx *mockTx) SelectWebhookTokens(query string, args ...interface{}) (models.WebhookTokens, error) {
+	var tokens models.WebhookTokens
+	for _, t := range tx.db.tokens {
+		if t.TokenHash == args[0].(string) {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (tx *mockTx) Commit() error {
+	return nil
+}
+
+func (tx *mockTx) Rollback() error {
+	return nil
+}
+
+func newTestWebHookListener() *WebHookListener {
+	return &WebHookListener{
+		statRequestsRecvd:       &tu.MockStat{},
+		statRequestsError:       &tu.MockStat{},
+		statsAuthFailures:       &tu.MockStat{},
+		statAlertsRejected:      &tu.MockStat{},
+		statAlertsDeduped:       &tu.MockStat{},
+		statsSourceAuthFailures: newSourceCounters("listener.webhook.auth_failures"),
+		statsSourceAlertsRecvd:  newSourceCounters("listener.webhook.alerts_recvd"),
+		statsSourceThrottled:    newSourceCounters("listener.webhook.alerts_throttled"),
+		statsSourceSampled:      newSourceCounters("listener.webhook.alerts_sampled"),
+		limiter:                 newRateLimiter(),
+	}
+}
+
+// postAlert sends the request to the listener and returns the response code and whether
+// the alert reached the handler
+func postAlert(t *testing.T, lis *WebHookListener, req *http.Request) (int, bool) {
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, req)
+		close(done)
+	}()
+	select {
+	case <-ah.ListenChan:
+		<-done
+		return rr.Code, true
+	case <-done:
+		return rr.Code, false
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for response")
+	}
+	return 0, false
+}
+
+func newAlertRequest(query, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/listener/alert/?"+query, bytes.NewReader([]byte(body)))
+	return req
+}
+
+func TestWebhookBasicAuth(t *testing.T) {
+	lis := newTestWebHookListener()
+	lis.UseAuth, lis.Username, lis.Password = true, "am", "secret"
+
+	// the request is not processed after an auth failure
+	code, sent := postAlert(t, lis, newAlertRequest("source=mocked", "{}"))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.False(t, sent)
+	req := newAlertRequest("source=mocked", "{}")
+	req.SetBasicAuth("am", "wrong")
+	code, sent = postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.False(t, sent)
+
+	req = newAlertRequest("source=mocked", "{}")
+	req.SetBasicAuth("am", "secret")
+	code, sent = postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+}
+
+func TestWebhookTokenAuth(t *testing.T) {
+	lis := newTestWebHookListener()
+	lis.TokenAuth = true
+	teamToken, _ := models.NewWebhookToken("neteng", "mocked", "neteng", "foo")
+	anyToken, _ := models.NewWebhookToken("any", "", "", "foo")
+	lis.SetDb(&mockDb{tokens: models.WebhookTokens{teamToken, anyToken}})
+	withToken := func(query, token string) *http.Request {
+		req := newAlertRequest(query, "{}")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	code, sent := postAlert(t, lis, withToken("source=mocked&team=neteng", teamToken.Token))
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+	code, sent = postAlert(t, lis, withToken("source=mocked&team=infra", anyToken.Token))
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+
+	// tokens are only valid for their source and team
+	code, sent = postAlert(t, lis, withToken("source=mocked&team=infra", teamToken.Token))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.False(t, sent)
+	code, sent = postAlert(t, lis, withToken("source=mocked_reject&team=neteng", teamToken.Token))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.False(t, sent)
+	code, _ = postAlert(t, lis, withToken("source=mocked", "wrong"))
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code, _ = postAlert(t, lis, withToken("source=abcd", "wrong"))
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// failures are counted per known source
+	assert.Contains(t, lis.statsSourceAuthFailures.counters, "mocked")
+	assert.Contains(t, lis.statsSourceAuthFailures.counters, "mocked_reject")
+	assert.Contains(t, lis.statsSourceAuthFailures.counters, "unknown")
+	assert.NotContains(t, lis.statsSourceAuthFailures.counters, "abcd")
+}
+
+func TestIngestionAuth(t *testing.T) {
+	lis := newTestWebHookListener()
+	lis.ingestions = newIngestionStore(time.Minute)
+	lis.TokenAuth = true
+	teamToken, _ := models.NewWebhookToken("neteng", "mocked", "neteng", "foo")
+	otherToken, _ := models.NewWebhookToken("infra", "mocked", "infra", "foo")
+	lis.SetDb(&mockDb{tokens: models.WebhookTokens{teamToken, otherToken}})
+	ing := newIngestion("mocked", "neteng")
+	if err := lis.ingestions.add(ing); err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(token string) int {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/listener/ingestion/"+ing.Id, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		http.HandlerFunc(lis.ingestionHandler).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// results are only returned to callers allowed to send alerts of the ingestion
+	assert.Equal(t, lookup(""), http.StatusUnauthorized)
+	assert.Equal(t, lookup("wrong"), http.StatusUnauthorized)
+	assert.Equal(t, lookup(otherToken.Token), http.StatusUnauthorized)
+	assert.Equal(t, lookup(teamToken.Token), http.StatusOK)
+	assert.Contains(t, lis.statsSourceAuthFailures.counters, "mocked")
+
+	// a signature of the empty body is not accepted for lookups of signed sources
+	lis.Signatures = map[string]*WebhookSignature{"mocked": {Secret: "secret", Header: "X-Hub-Signature-256", Prefix: "sha256="}}
+	signed := func() int {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/listener/ingestion/"+ing.Id, nil)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign("secret", ""))
+		http.HandlerFunc(lis.ingestionHandler).ServeHTTP(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, signed(), http.StatusUnauthorized)
+	assert.Equal(t, lookup(teamToken.Token), http.StatusOK)
+	lis.TokenAuth = false
+	assert.Equal(t, signed(), http.StatusUnauthorized)
+}
+
+func sign(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	lis := newTestWebHookListener()
+	// signed sources do not need other credentials
+	lis.UseAuth = true
+	lis.Signatures = map[string]*WebhookSignature{
+		"mocked": {Secret: "secret", Header: "X-Hub-Signature-256", Prefix: "sha256="},
+		"mocked_reject": {
+			Secret: "secret", Header: "X-Grafana-Alerting-Signature",
+			TimestampHeader: "X-Grafana-Alerting-Signature-Timestamp",
+		},
+	}
+	body := `{"alerts": []}`
+
+	req := newAlertRequest("source=mocked", body)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+sign("secret", body))
+	code, sent := postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+	for _, sig := range []string{"", sign("secret", body), "sha256=" + sign("wrong", body), "sha256=zz"} {
+		req = newAlertRequest("source=mocked", body)
+		req.Header.Set("X-Hub-Signature-256", sig)
+		code, sent = postAlert(t, lis, req)
+		assert.Equal(t, code, http.StatusUnauthorized)
+		assert.False(t, sent)
+	}
+	// basic auth does not replace the signature
+	req = newAlertRequest("source=mocked", body)
+	req.SetBasicAuth(lis.Username, lis.Password)
+	code, _ = postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// the timestamp is part of the signed message
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req = newAlertRequest("source=mocked_reject", body)
+	req.Header.Set("X-Grafana-Alerting-Signature", sign("secret", ts+":"+body))
+	req.Header.Set("X-Grafana-Alerting-Signature-Timestamp", ts)
+	code, sent = postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusOK)
+	assert.True(t, sent)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req = newAlertRequest("source=mocked_reject", body)
+	req.Header.Set("X-Grafana-Alerting-Signature", sign("secret", old+":"+body))
+	req.Header.Set("X-Grafana-Alerting-Signature-Timestamp", old)
+	code, _ = postAlert(t, lis, req)
+	assert.Equal(t, code, http.StatusUnauthorized)
+}
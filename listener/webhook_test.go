@@ -2,6 +2,7 @@ package listener
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"net/http"
 	"net/http/httptest"
@@ -11,7 +12,7 @@ import (
 
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
-	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,11 +31,32 @@ func (m *mockParser) Parse(data []byte) (*WebHookAlertData, error) {
 		Level:   "WARN",
 		Status:  "ACTIVE",
 		Source:  "mocked"}
+	if string(data) == Status_CLEARED {
+		alert.Status = Status_CLEARED
+	}
 	return &WebHookAlertData{Alerts: []*WebHookAlert{alert}}, nil
 }
 
+type mockRejectParser struct{}
+
+func (m *mockRejectParser) Name() string { return "mocked_reject" }
+
+func (m *mockRejectParser) Parse(data []byte) (*WebHookAlertData, error) {
+	good := &WebHookAlert{Name: "Test Alert", Details: "ok", Entity: "ent1", Time: time.Now(), Status: "ACTIVE", Index: 3}
+	badName := &WebHookAlert{Name: "Test Alert!", Details: "bad name", Entity: "ent2", Time: time.Now(), Status: "ACTIVE", Index: 2}
+	d := &WebHookAlertData{
+		Alerts:       []*WebHookAlert{good, badName},
+		Rejected:     []*RejectedAlert{{Index: 1, Name: "Missing Entity", Reason: "Required label entity missing"}},
+		Deduplicated: []*RejectedAlert{{Index: 0, Name: "Test Alert", Reason: "Duplicate of alert 3"}},
+	}
+	if string(data) == "none" {
+		d.Alerts = d.Alerts[1:]
+	}
+	return d, nil
+}
+
 func TestAlertHandlerBadRequest(t *testing.T) {
-	lis := &WebHookListener{statRequestsRecvd: &tu.MockStat{}, statRequestsError: &tu.MockStat{}}
+	lis := newTestWebHookListener()
 
 	// test empty request
 	req, err := http.NewRequest("POST", "/listener/alert", nil)
@@ -72,7 +94,7 @@ func TestAlertHandlerBadRequest(t *testing.T) {
 }
 
 func TestAlertHandlerParsing(t *testing.T) {
-	lis := &WebHookListener{statRequestsRecvd: &tu.MockStat{}, statRequestsError: &tu.MockStat{}}
+	lis := newTestWebHookListener()
 
 	req, err := http.NewRequest("POST", "/listener/alert/?source=mocked&team=foo", bytes.NewReader([]byte("blah")))
 	if err != nil {
@@ -94,9 +116,81 @@ func TestAlertHandlerParsing(t *testing.T) {
 	assert.Equal(t, event.Alert.Team, "foo")
 }
 
+func TestAlertHandlerRejected(t *testing.T) {
+	lis := newTestWebHookListener()
+	var resp struct{ Rejected []*RejectedAlert }
+
+	// valid alerts in the batch are accepted
+	req, _ := http.NewRequest("POST", "/listener/alert/?source=mocked_reject", bytes.NewReader([]byte("some")))
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, req)
+		close(done)
+	}()
+	event := <-ah.ListenChan
+	<-done
+	assert.Equal(t, event.Alert.Name, "Test Alert")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(resp.Rejected), 2)
+	assert.Equal(t, *resp.Rejected[0], RejectedAlert{Index: 1, Name: "Missing Entity", Reason: "Required label entity missing"})
+	assert.Equal(t, resp.Rejected[1].Index, 2)
+	assert.Contains(t, resp.Rejected[1].Reason, "Invalid alert name")
+
+	// the request fails if all alerts are rejected
+	req, _ = http.NewRequest("POST", "/listener/alert/?source=mocked_reject", bytes.NewReader([]byte("none")))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(lis.httpHandler).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(resp.Rejected), 2)
+}
+
+func TestAlertHandlerTracing(t *testing.T) {
+	exp := &tracing.InMemoryExporter{}
+	tracing.SetExporter(exp)
+	defer tracing.SetExporter(nil)
+	lis := newTestWebHookListener()
+
+	req, err := http.NewRequest("POST", "/listener/alert/?source=mocked&team=foo", bytes.NewReader([]byte("blah")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(lis.httpHandler)
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	event := <-ah.ListenChan
+	<-done
+	reqSpans := exp.Find("listener.webhook")
+	alertSpans := exp.Find("listener.webhook.alert")
+	assert.Equal(t, len(reqSpans), 1)
+	assert.Equal(t, len(alertSpans), 1)
+	// the request joins the trace of the sender
+	assert.Equal(t, reqSpans[0].Context.TraceId.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, reqSpans[0].ParentId.String(), "00f067aa0ba902b7")
+	assert.Equal(t, reqSpans[0].Attributes["source"], "mocked")
+	assert.Equal(t, alertSpans[0].ParentId, reqSpans[0].Context.SpanId)
+	assert.Equal(t, alertSpans[0].Attributes["alert_name"], "Test Alert")
+	// the alert carries its span to the handler
+	assert.Equal(t, event.Alert.Trace, alertSpans[0].Context)
+}
+
 func TestMain(m *testing.M) {
 	p := &mockParser{}
 	AddParser(p)
+	AddParser(&mockRejectParser{})
+	AddParser(&mockBatchParser{})
 	flag.Parse()
 	ah.Config = ah.NewConfigHandler("../testutil/testdata/test_config.yaml")
 	ah.Config.LoadConfig()
@@ -1,21 +1,25 @@
 package output
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"sync"
+	"text/template"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 	"github.com/streadway/amqp"
 )
 
 const (
-	exchangeName = "alerts"
-	exchangeType = "direct"
+	amqpDefaultExchange     = "alerts"
+	amqpDefaultExchangeType = "direct"
+	amqpDefaultBufferSize   = 1000
+	amqpConfirmTimeout      = 10 * time.Second
 )
 
 type Incident struct {
@@ -28,48 +32,88 @@ type Incident struct {
 	IsAggregate bool      `json:"is_aggregate"`
 }
 
+// routingKeyData is used to render the routing key template for each event
+type routingKeyData struct {
+	Name, Type, Team, Severity, Status, Source, Device, Entity string
+}
+
+// amqpSession is a channel in confirm mode on an open connection
+type amqpSession interface {
+	// Publish publishes the message and waits for the broker to confirm it
+	Publish(exchange, key string, msg amqp.Publishing) error
+	// NotifyClose returns a channel that receives when the connection or channel is closed
+	NotifyClose() chan *amqp.Error
+	Close() error
+}
+
+type amqpConn struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+func (c *amqpConn) Publish(exchange, key string, msg amqp.Publishing) error {
+	if err := c.channel.Publish(exchange, key, false, false, msg); err != nil {
+		return err
+	}
+	select {
+	case confirm, ok := <-c.confirms:
+		if !ok {
+			return fmt.Errorf("Channel closed before confirm")
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("Message %d was nacked by the broker", confirm.DeliveryTag)
+		}
+	case <-time.After(amqpConfirmTimeout):
+		return fmt.Errorf("Timed out waiting for confirm")
+	}
+	return nil
+}
+
+func (c *amqpConn) NotifyClose() chan *amqp.Error {
+	return c.channel.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+func (c *amqpConn) Close() error {
+	return c.conn.Close()
+}
+
+// amqpPending is a message waiting to be published
+type amqpPending struct {
+	key  string
+	msg  *amqp.Publishing
+	req  *plugins.SendRequest
+	span *tracing.Span
+}
+
 type Publisher struct {
-	AmqpAddr      string        `mapstructure:"amqp_addr"`
-	AmqpUser      string        `mapstructure:"amqp_username"`
-	AmqpPass      string        `mapstructure:"amqp_password"`
+	AmqpAddr string `mapstructure:"amqp_addr"`
+	AmqpUser string `mapstructure:"amqp_username"`
+	AmqpPass string `mapstructure:"amqp_password"`
+	// AmqpRoutingKey is a template rendered with the Name, Type, Team, Severity, Status,
+	// Source, Device and Entity of each event, e.g. "{{.Team}}.{{.Severity}}"
 	AmqpRoutingKey string        `mapstructure:"amqp_routing_key"`
-	ConnectRetry  time.Duration `mapstructure:"connect_retry"`
-	ready         bool
-	Notif         chan *plugins.SendRequest
-	channel       *amqp.Channel
+	Exchange       string        `mapstructure:"exchange"`
+	ExchangeType   string        `mapstructure:"exchange_type"`
+	Durable        bool          `mapstructure:"durable"`
+	ConnectRetry   time.Duration `mapstructure:"connect_retry"`
+	// BufferSize is the max number of messages kept while disconnected, the oldest are dropped first
+	BufferSize int `mapstructure:"buffer_size"`
+	Notif      chan *plugins.SendRequest
 
-	sync.RWMutex
+	dial    func() (amqpSession, error)
+	session amqpSession
+	closed  chan *amqp.Error
+	buffer  []*amqpPending
+	keyTmpl *template.Template
 }
 
 func (p *Publisher) Name() string {
 	return "amqp"
 }
 
-func (p *Publisher) Publish(incident *Incident) error {
-	data, err := json.Marshal(incident)
-	if err != nil {
-		return fmt.Errorf("Unable to marshal incident json: %v", err)
-	}
-	msg := amqp.Publishing{
-		Timestamp:       time.Now(),
-		DeliveryMode:    1, // non-persistent : TODO : make it persistent ?
-		Priority:        0,
-		Headers:         amqp.Table{},
-		ContentType:     "application/json",
-		ContentEncoding: "",
-		Body:            data,
-	}
-	return p.channel.Publish(
-		exchangeName, // publish to an exchange
-		p.AmqpRoutingKey,   // routing to 0 or more queues
-		false,        // mandatory
-		false,        // immediate
-		msg,
-	)
-}
-
 func (p *Publisher) uri() string {
-	if p.AmqpPass == "" {
+	if p.AmqpUser == "" {
 		return fmt.Sprintf("amqp://%s", p.AmqpAddr)
 	}
 	if p.AmqpPass == "" {
@@ -78,47 +122,74 @@ func (p *Publisher) uri() string {
 	return fmt.Sprintf("amqp://%s:%s@%s", p.AmqpUser, p.AmqpPass, p.AmqpAddr)
 }
 
-func (p *Publisher) Setup() error {
-	p.RLock()
-	if p.ready {
-		return nil
+func (p *Publisher) exchange() string {
+	if p.Exchange == "" {
+		return amqpDefaultExchange
 	}
-	p.RUnlock()
-	var conn *amqp.Connection
-	var err error
+	return p.Exchange
+}
 
-	conn, err = amqp.Dial(p.uri())
+// dialAmqp connects to the server and declares the exchange on a channel in confirm mode
+func (p *Publisher) dialAmqp() (amqpSession, error) {
+	conn, err := amqp.Dial(p.uri())
 	if err != nil {
-		glog.V(2).Infof("Rabbitmq: Error connecting to server %s: %v", p.AmqpAddr, err)
-		go func() {
-			time.Sleep(p.ConnectRetry)
-			p.Setup()
-		}()
-		return err
+		return nil, fmt.Errorf("Error connecting to server %s: %v", p.AmqpAddr, err)
 	}
-
 	channel, err := conn.Channel()
 	if err != nil {
-		return fmt.Errorf("Error getting channel: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("Error getting channel: %v", err)
+	}
+	exchangeType := p.ExchangeType
+	if exchangeType == "" {
+		exchangeType = amqpDefaultExchangeType
 	}
-	p.channel = channel
-	if err = p.channel.ExchangeDeclare(
-		exchangeName, // name
+	if err = channel.ExchangeDeclare(
+		p.exchange(), // name
 		exchangeType, // type
-		false,        // durable
+		p.Durable,    // durable
 		false,        // auto-deleted
 		false,        // internal
 		false,        // noWait
 		nil,          // arguments
 	); err != nil {
-		return fmt.Errorf("Error declaring exchange: %v", err)
+		conn.Close()
+		return nil, fmt.Errorf("Error declaring exchange: %v", err)
 	}
-	p.Lock()
-	p.ready = true
-	p.Unlock()
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error enabling publisher confirms: %v", err)
+	}
+	return &amqpConn{
+		conn:     conn,
+		channel:  channel,
+		confirms: channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+	}, nil
+}
+
+func (p *Publisher) connect() error {
+	dial := p.dial
+	if dial == nil {
+		dial = p.dialAmqp
+	}
+	session, err := dial()
+	if err != nil {
+		return err
+	}
+	p.session = session
+	p.closed = session.NotifyClose()
+	glog.V(2).Infof("Amqp: Connected to %s", p.AmqpAddr)
 	return nil
 }
 
+func (p *Publisher) disconnect() {
+	if p.session != nil {
+		p.session.Close()
+	}
+	p.session = nil
+	p.closed = nil
+}
+
 func (p *Publisher) toIncident(event *models.AlertEvent) *Incident {
 	alert := event.Alert
 	incident := &Incident{
@@ -134,28 +205,128 @@ func (p *Publisher) toIncident(event *models.AlertEvent) *Incident {
 	return incident
 }
 
+func (p *Publisher) routingKey(event *models.AlertEvent) (string, error) {
+	if p.keyTmpl == nil {
+		tmpl, err := template.New("routing_key").Parse(p.AmqpRoutingKey)
+		if err != nil {
+			return "", err
+		}
+		p.keyTmpl = tmpl
+	}
+	alert := event.Alert
+	buf := new(bytes.Buffer)
+	err := p.keyTmpl.Execute(buf, routingKeyData{
+		Name:     alert.Name,
+		Type:     event.Type.String(),
+		Team:     alert.Team,
+		Severity: alert.Severity.String(),
+		Status:   alert.Status.String(),
+		Source:   alert.Source,
+		Device:   alert.Device.String,
+		Entity:   alert.Entity,
+	})
+	return buf.String(), err
+}
+
+func (p *Publisher) message(event *models.AlertEvent) (*amqp.Publishing, error) {
+	data, err := json.Marshal(p.toIncident(event))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal incident json: %v", err)
+	}
+	return &amqp.Publishing{
+		Timestamp:    time.Now(),
+		DeliveryMode: amqp.Persistent,
+		MessageId:    idempotencyKey(event),
+		Type:         event.Type.String(),
+		Headers:      amqp.Table{},
+		ContentType:  "application/json",
+		Body:         data,
+	}, nil
+}
+
+// enqueue adds the message to the buffer, dropping the oldest message if the buffer is full
+func (p *Publisher) enqueue(m *amqpPending) {
+	size := p.BufferSize
+	if size <= 0 {
+		size = amqpDefaultBufferSize
+	}
+	if len(p.buffer) >= size {
+		dropped := p.buffer[0]
+		glog.Errorf("Amqp: Buffer full, dropping message %s", dropped.msg.MessageId)
+		dropped.span.SetError(fmt.Errorf("Dropped from full buffer"))
+		dropped.span.End()
+		p.buffer = p.buffer[1:]
+	}
+	p.buffer = append(p.buffer, m)
+}
+
+// flush publishes buffered messages in order until the buffer is empty or a publish fails
+func (p *Publisher) flush() error {
+	for len(p.buffer) > 0 && p.session != nil {
+		m := p.buffer[0]
+		if err := p.session.Publish(p.exchange(), m.key, *m.msg); err != nil {
+			return err
+		}
+		m.req.Sent(p.Name())
+		m.span.End()
+		p.buffer = p.buffer[1:]
+	}
+	return nil
+}
+
 func (p *Publisher) Start(ctx context.Context, options *plugins.Options) {
-	if err := p.Setup(); err != nil {
-		glog.Errorf("Failed to start amqp publisher: %v", err)
+	reconnect := time.NewTimer(0)
+	defer reconnect.Stop()
+	// publish flushes the buffer, reconnecting after ConnectRetry if publishing fails
+	publish := func() {
+		if err := p.flush(); err != nil {
+			glog.Errorf("Amqp: Failed to publish incident, %d buffered: %v", len(p.buffer), err)
+			p.disconnect()
+			reconnect.Reset(p.ConnectRetry)
+		}
 	}
 	for {
 		select {
 		case req := <-p.Notif:
-			p.RLock()
-			if !p.ready {
-				glog.V(2).Infof("Amqp publisher not ready, skipping event")
-				p.RUnlock()
+			// the span ends once the message is published
+			span := req.StartSpan(p.Name())
+			msg, err := p.message(req.Event)
+			if err != nil {
+				glog.Errorf("Amqp: %v", err)
+				span.SetError(err)
+				span.End()
 				break
 			}
-			p.RUnlock()
-			if req.Event.Type != models.EventType_ACTIVE && req.Event.Type != models.EventType_CLEARED {
+			key, err := p.routingKey(req.Event)
+			if err != nil {
+				glog.Errorf("Amqp: Unable to render routing key: %v", err)
+				span.SetError(err)
+				span.End()
 				break
 			}
-			//TODO dont publish repeat notifications
-			if err := p.Publish(p.toIncident(req.Event)); err != nil {
-				glog.Errorf("Amqp: Failed to publish incident: %v", err)
+			p.enqueue(&amqpPending{key: key, msg: msg, req: req, span: span})
+			if p.session == nil {
+				glog.V(2).Infof("Amqp: Publisher not connected, %d messages buffered", len(p.buffer))
+				break
 			}
+			publish()
+		case err := <-p.closed:
+			glog.Errorf("Amqp: Connection closed, reconnecting: %v", err)
+			p.disconnect()
+			reconnect.Reset(p.ConnectRetry)
+		case <-reconnect.C:
+			if err := p.connect(); err != nil {
+				glog.V(2).Infof("Amqp: %v", err)
+				reconnect.Reset(p.ConnectRetry)
+				break
+			}
+			publish()
 		case <-ctx.Done():
+			for _, m := range p.buffer {
+				m.span.SetError(fmt.Errorf("Not published before shutdown"))
+				m.span.End()
+			}
+			p.disconnect()
 			return
 		}
 	}
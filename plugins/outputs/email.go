@@ -3,10 +3,13 @@ package output
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"html/template"
 	"net"
 	"strconv"
+	"strings"
+	ttemplate "text/template"
 	"time"
 
 	"github.com/go-mail/mail"
@@ -16,20 +19,55 @@ import (
 	tpl "github.com/mayuresh82/alert_manager/template"
 )
 
+const (
+	emailThreadOutput = "email"
+	emailDateFormat   = "Mon Jan 2 15:04:05 MST 2006"
+)
+
+// EmailMessage is a single multipart email
+type EmailMessage struct {
+	From, Subject string
+	To            []string
+	Html, Text    string
+	// MessageId is the id of this message, InReplyTo is the id of the first message sent for the alert
+	MessageId, InReplyTo string
+}
+
+// SmtpConfig holds the smtp server params
+type SmtpConfig struct {
+	Addr, Username, Password string
+	// Tls is one of implicit, starttls, none, or empty to pick based on the port
+	Tls                string
+	InsecureSkipVerify bool
+}
+
 type Emailer interface {
-	send(addr, username, pwd, from, subject, body string, recipients []string) error
+	send(smtp *SmtpConfig, msg *EmailMessage) error
 }
 
 type EmailSender struct{}
 
-func (e *EmailSender) send(addr, username, pwd, from, subject, body string, recipients []string) error {
+func (e *EmailSender) send(smtp *SmtpConfig, msg *EmailMessage) error {
 	m := mail.NewMessage()
-	m.SetAddressHeader("From", from, "Alert Manager")
-	m.SetHeader("To", recipients...)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", body)
+	m.SetAddressHeader("From", msg.From, "Alert Manager")
+	m.SetHeader("To", msg.To...)
+	m.SetHeader("Subject", msg.Subject)
+	if msg.MessageId != "" {
+		m.SetHeader("Message-ID", msg.MessageId)
+	}
+	if msg.InReplyTo != "" {
+		m.SetHeader("In-Reply-To", msg.InReplyTo)
+		m.SetHeader("References", msg.InReplyTo)
+	}
+	m.SetDateHeader("Date", time.Now())
+	if msg.Text != "" {
+		m.SetBody("text/plain", msg.Text)
+		m.AddAlternative("text/html", msg.Html)
+	} else {
+		m.SetBody("text/html", msg.Html)
+	}
 
-	host, port, err := net.SplitHostPort(addr)
+	host, port, err := net.SplitHostPort(smtp.Addr)
 	if err != nil {
 		return err
 	}
@@ -37,9 +75,24 @@ func (e *EmailSender) send(addr, username, pwd, from, subject, body string, reci
 		port = "25"
 	}
 	p, _ := strconv.Atoi(port)
-	d := mail.NewDialer(host, p, username, pwd)
-	if p == 587 {
+	d := mail.NewDialer(host, p, smtp.Username, smtp.Password)
+	d.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: smtp.InsecureSkipVerify}
+	switch smtp.Tls {
+	case "implicit":
+		d.SSL = true
+	case "starttls":
+		d.SSL = false
 		d.StartTLSPolicy = mail.MandatoryStartTLS
+	case "none":
+		d.SSL = false
+		d.StartTLSPolicy = mail.NoStartTLS
+	case "":
+		// NewDialer uses implicit tls on 465
+		if p == 587 {
+			d.StartTLSPolicy = mail.MandatoryStartTLS
+		}
+	default:
+		return fmt.Errorf("Invalid smtp tls mode: %s", smtp.Tls)
 	}
 	if err := d.DialAndSend(m); err != nil {
 		return err
@@ -50,17 +103,53 @@ func (e *EmailSender) send(addr, username, pwd, from, subject, body string, reci
 type EmailRecipient struct {
 	From string
 	To   []string
+	// Subject is a template for the subject of all events, executed with the TplData
+	Subject string
+	// Subjects are templates for the subject of specific event types, e.g. cleared
+	Subjects map[string]string
+
+	subjectTmpls map[string]*ttemplate.Template
+}
+
+// subjectTemplate returns the subject template for the event type, or nil if none configured
+func (r *EmailRecipient) subjectTemplate(eventType models.EventType) (*ttemplate.Template, error) {
+	raw := r.Subject
+	for e, s := range r.Subjects {
+		if strings.ToUpper(e) == eventType.String() {
+			raw = s
+		}
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	if tmpl, ok := r.subjectTmpls[raw]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := ttemplate.New("subject").Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if r.subjectTmpls == nil {
+		r.subjectTmpls = make(map[string]*ttemplate.Template)
+	}
+	r.subjectTmpls[raw] = tmpl
+	return tmpl, nil
 }
 
 type EmailNotifier struct {
 	Notif        chan *plugins.SendRequest
 	rawTpl       string
+	rawTextTpl   string
 	Emailer      Emailer
 	SmtpAddr     string `mapstructure:"smtp_addr"`
 	UseAuth      bool   `mapstructure:"use_auth"`
 	SmtpUsername string `mapstructure:"smtp_username"`
 	SmtpPassword string `mapstructure:"smtp_password"`
-	Recipients   map[string]*EmailRecipient
+	// SmtpTls is one of implicit, starttls or none. By default implicit tls is used on
+	// port 465, starttls is required on port 587 and used if available on other ports.
+	SmtpTls            string `mapstructure:"smtp_tls"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	Recipients         map[string]*EmailRecipient
 }
 
 type TplData struct {
@@ -71,6 +160,7 @@ type TplData struct {
 	AlertSeverity string
 	Header        string
 	AlertParams   []struct{ Name, Value string }
+	Alert         *models.Alert
 }
 
 func (e *EmailNotifier) Name() string {
@@ -89,6 +179,81 @@ func (e *EmailNotifier) renderTemplate(data *TplData) (string, error) {
 	return buf.String(), nil
 }
 
+func (e *EmailNotifier) renderText(data *TplData) (string, error) {
+	if e.rawTextTpl == "" {
+		return "", nil
+	}
+	tmpl, err := ttemplate.New("email_text").Parse(e.rawTextTpl)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err = tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// domain returns the domain of the from address used in message ids
+func (e *EmailNotifier) domain(from string) string {
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		return strings.Trim(from[i+1:], "> ")
+	}
+	return "alert_manager"
+}
+
+// threadId returns the stable message id of the first email sent for an alert
+func (e *EmailNotifier) threadId(alert *models.Alert, from string) string {
+	return fmt.Sprintf("<alert-%d.%d@%s>", alert.Id, alert.StartTime.Unix(), e.domain(from))
+}
+
+// messageIds returns the message id of the email for the event and the message id it replies to, if
+// any. The first email sent for an alert gets the stable thread id, later emails reply to it.
+func (e *EmailNotifier) messageIds(req *plugins.SendRequest, from string, db models.Dbase) (string, string) {
+	alert := req.Event.Alert
+	threadId := e.threadId(alert, from)
+	reply := fmt.Sprintf("<alert-%d.%s.%d@%s>", alert.Id, strings.ToLower(req.Event.Type.String()), time.Now().UnixNano(), e.domain(from))
+	if alert.Id == 0 {
+		return reply, ""
+	}
+	if db == nil {
+		// without a db only active events can start a thread
+		if req.Event.Type == models.EventType_ACTIVE {
+			return threadId, ""
+		}
+		return reply, threadId
+	}
+	var sent *models.OutputMessage
+	err := models.WithTx(context.Background(), db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		var er error
+		sent, er = models.GetOutputMessage(tx, alert.Id, emailThreadOutput+"."+req.Name)
+		return er
+	})
+	if err != nil {
+		glog.V(2).Infof("Output: Email: Unable to get thread for alert %d: %v", alert.Id, err)
+	}
+	if sent == nil {
+		return threadId, ""
+	}
+	return reply, sent.MessageId
+}
+
+// saveThread records the thread id once the first email for an alert has been sent
+func (e *EmailNotifier) saveThread(req *plugins.SendRequest, msg *EmailMessage, db models.Dbase) {
+	alert := req.Event.Alert
+	if db == nil || alert.Id == 0 || msg.InReplyTo != "" || msg.MessageId != e.threadId(alert, msg.From) {
+		return
+	}
+	err := models.WithTx(context.Background(), db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		return models.SaveOutputMessage(tx, &models.OutputMessage{
+			AlertId: alert.Id, Output: emailThreadOutput + "." + req.Name, Channel: msg.From, MessageId: msg.MessageId,
+		})
+	})
+	if err != nil {
+		glog.V(2).Infof("Output: Email: Unable to save thread for alert %d: %v", alert.Id, err)
+	}
+}
+
 func (e *EmailNotifier) subject(event *models.AlertEvent) string {
 	alert := event.Alert
 	var subject string
@@ -100,13 +265,22 @@ func (e *EmailNotifier) subject(event *models.AlertEvent) string {
 	return subject
 }
 
-func (e *EmailNotifier) start(req *plugins.SendRequest, weburl string) {
+func (e *EmailNotifier) start(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(e.Name())
+	defer span.End()
 	event := req.Event
-	startTime := event.Alert.StartTime.UTC().Format("Mon Jan 2 15:04:05 MST 2006")
+	recp, ok := e.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	startTime := event.Alert.StartTime.UTC().Format(emailDateFormat)
 	data := &TplData{
 		Subject:       e.subject(event),
-		AlertMgrURL:   weburl + fmt.Sprintf("/%d", event.Alert.Id),
-		SentAt:        time.Now().Format("Mon Jan 2 15:04:05 MST 2006"),
+		AlertMgrURL:   opts.WebUrl + fmt.Sprintf("/%d", event.Alert.Id),
+		SentAt:        time.Now().Format(emailDateFormat),
 		EventType:     event.Type.String(),
 		AlertSeverity: event.Alert.Severity.String(),
 		AlertParams: []struct{ Name, Value string }{
@@ -115,31 +289,61 @@ func (e *EmailNotifier) start(req *plugins.SendRequest, weburl string) {
 			struct{ Name, Value string }{"Entity", event.Alert.Entity},
 			struct{ Name, Value string }{"StartTime", startTime},
 		},
+		Alert: event.Alert,
 	}
 	data.Header = fmt.Sprintf("[%s][%s] %s", data.AlertSeverity, data.EventType, event.Alert.Name)
 	if event.Alert.Device.Valid {
 		data.AlertParams = append(data.AlertParams, struct{ Name, Value string }{"Device", event.Alert.Device.String})
 	}
+	tmpl, err := recp.subjectTemplate(event.Type)
+	if err != nil {
+		glog.Errorf("Output: Email: Failed to parse subject template: %v", err)
+		span.SetError(err)
+		return
+	}
+	if tmpl != nil {
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, data); err != nil {
+			glog.Errorf("Output: Email: Failed to render subject template: %v", err)
+			span.SetError(err)
+			return
+		}
+		data.Subject = buf.String()
+	}
 	body, err := e.renderTemplate(data)
 	if err != nil {
 		glog.Errorf("Output: Email: Failed to render template: %v", err)
+		span.SetError(err)
 		return
 	}
-	recp, ok := e.Recipients[req.Name]
-	if !ok {
-		glog.Errorf("Failed to get recipient for output %s", req.Name)
+	text, err := e.renderText(data)
+	if err != nil {
+		glog.Errorf("Output: Email: Failed to render text template: %v", err)
+		span.SetError(err)
 		return
 	}
-	if err := e.Emailer.send(
-		e.SmtpAddr,
-		e.SmtpUsername,
-		e.SmtpPassword,
-		recp.From,
-		data.Subject,
-		body,
-		recp.To); err != nil {
+	msg := &EmailMessage{
+		From:    recp.From,
+		To:      recp.To,
+		Subject: data.Subject,
+		Html:    body,
+		Text:    text,
+	}
+	msg.MessageId, msg.InReplyTo = e.messageIds(req, recp.From, opts.Db)
+	smtp := &SmtpConfig{
+		Addr:               e.SmtpAddr,
+		Username:           e.SmtpUsername,
+		Password:           e.SmtpPassword,
+		Tls:                e.SmtpTls,
+		InsecureSkipVerify: e.InsecureSkipVerify,
+	}
+	if err := e.Emailer.send(smtp, msg); err != nil {
 		glog.Errorf("Output: Email : Unable to send email : %v", err)
+		span.SetError(err)
+		return
 	}
+	req.Sent(e.Name())
+	e.saveThread(req, msg, opts.Db)
 }
 
 func (e *EmailNotifier) Start(ctx context.Context, opts *plugins.Options) {
@@ -149,7 +353,7 @@ func (e *EmailNotifier) Start(ctx context.Context, opts *plugins.Options) {
 			if req.Event.Type == models.EventType_ACKD {
 				break
 			}
-			e.start(req, opts.WebUrl)
+			e.start(req, opts)
 		case <-ctx.Done():
 			return
 		}
@@ -158,9 +362,10 @@ func (e *EmailNotifier) Start(ctx context.Context, opts *plugins.Options) {
 
 func init() {
 	e := &EmailNotifier{
-		Notif:   make(chan *plugins.SendRequest),
-		rawTpl:  tpl.EmailTemplate,
-		Emailer: &EmailSender{},
+		Notif:      make(chan *plugins.SendRequest),
+		rawTpl:     tpl.EmailTemplate,
+		rawTextTpl: tpl.EmailTextTemplate,
+		Emailer:    &EmailSender{},
 	}
 	plugins.AddOutput(e, e.Notif)
 }
@@ -0,0 +1,330 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	fileHousekeepingInterval = 1 * time.Minute
+	// open files that have not been written to in this time are closed
+	fileIdleTimeout   = 10 * time.Minute
+	rotatedTimeFormat = "20060102T150405.000"
+)
+
+// pathData is used to render the path template for each record
+type pathData struct {
+	Team, Source, Date string
+}
+
+type jsonlFile struct {
+	path      string
+	f         *os.File
+	size      int64
+	openedAt  time.Time
+	lastWrite time.Time
+}
+
+type FileRecipient struct {
+	// Path is a template for the file path, e.g. /var/log/am/{{.Team}}/{{.Date}}.jsonl
+	Path string
+	// MaxSize is the size in bytes after which a file is rotated
+	MaxSize int64 `mapstructure:"max_size"`
+	// RotateEvery is the interval after which a file is rotated
+	RotateEvery time.Duration `mapstructure:"rotate_every"`
+	// Compress gzips rotated files
+	Compress bool
+	// MaxAge is the age after which old files are deleted
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	tmpl  *template.Template
+	files map[string]*jsonlFile
+	// compressing are the rotated files being compressed, tracked by wg
+	compressing map[string]bool
+	wg          sync.WaitGroup
+	sync.Mutex
+}
+
+func (r *FileRecipient) render(data pathData) (string, error) {
+	if r.tmpl == nil {
+		tmpl, err := template.New("path").Parse(r.Path)
+		if err != nil {
+			return "", err
+		}
+		r.tmpl = tmpl
+	}
+	buf := new(bytes.Buffer)
+	if err := r.tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// pathSafe makes a value safe to use as part of a file path
+func pathSafe(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator || r == '*' || r == '?' {
+			return '_'
+		}
+		return r
+	}, strings.Replace(value, "..", "_", -1))
+}
+
+func (r *FileRecipient) open(path string) (*jsonlFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	now := time.Now()
+	return &jsonlFile{path: path, f: f, size: info.Size(), openedAt: now, lastWrite: now}, nil
+}
+
+// rotate closes the current file and renames it with a timestamp suffix, compressing it if required
+func (r *FileRecipient) rotate(jf *jsonlFile) error {
+	delete(r.files, jf.path)
+	if err := jf.f.Close(); err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("%s.%s", jf.path, time.Now().Format(rotatedTimeFormat))
+	if err := os.Rename(jf.path, rotated); err != nil {
+		return err
+	}
+	if r.Compress {
+		if r.compressing == nil {
+			r.compressing = make(map[string]bool)
+		}
+		r.compressing[rotated] = true
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			if err := compressFile(rotated); err != nil {
+				glog.Errorf("Output: File: Failed to compress %s: %v", rotated, err)
+			}
+			r.Lock()
+			delete(r.compressing, rotated)
+			r.Unlock()
+		}()
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (r *FileRecipient) write(path string, record []byte) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.files == nil {
+		r.files = make(map[string]*jsonlFile)
+	}
+	jf, ok := r.files[path]
+	if ok && r.MaxSize > 0 && jf.size+int64(len(record)) > r.MaxSize {
+		if err := r.rotate(jf); err != nil {
+			return fmt.Errorf("Failed to rotate %s: %v", path, err)
+		}
+		ok = false
+	}
+	if !ok {
+		var err error
+		if jf, err = r.open(path); err != nil {
+			return err
+		}
+		r.files[path] = jf
+	}
+	n, err := jf.f.Write(record)
+	jf.size += int64(n)
+	jf.lastWrite = time.Now()
+	return err
+}
+
+// housekeeping rotates files based on time, closes idle files and removes files older than MaxAge
+func (r *FileRecipient) housekeeping() {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	for path, jf := range r.files {
+		if r.RotateEvery > 0 && now.Sub(jf.openedAt) >= r.RotateEvery {
+			if err := r.rotate(jf); err != nil {
+				glog.Errorf("Output: File: Failed to rotate %s: %v", path, err)
+			}
+			continue
+		}
+		if now.Sub(jf.lastWrite) >= fileIdleTimeout {
+			jf.f.Close()
+			delete(r.files, path)
+		}
+	}
+	if r.MaxAge == 0 {
+		return
+	}
+	// find all files generated by the path template
+	pattern, err := r.render(pathData{Team: "*", Source: "*", Date: "*"})
+	if err != nil {
+		return
+	}
+	current, _ := filepath.Glob(pattern)
+	rotated, _ := filepath.Glob(pattern + ".*")
+	for _, f := range append(current, rotated...) {
+		// files being written or compressed are not removed
+		if _, open := r.files[f]; open || r.compressing[strings.TrimSuffix(f, ".gz")] {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if now.Sub(info.ModTime()) > r.MaxAge {
+			glog.V(2).Infof("Output: File: Removing %s older than %v", f, r.MaxAge)
+			if err := os.Remove(f); err != nil {
+				glog.Errorf("Output: File: Failed to remove %s: %v", f, err)
+			}
+		}
+	}
+}
+
+// closeAll closes all files and waits for rotated files to be compressed
+func (r *FileRecipient) closeAll() {
+	r.Lock()
+	for path, jf := range r.files {
+		jf.f.Close()
+		delete(r.files, path)
+	}
+	r.Unlock()
+	r.wg.Wait()
+}
+
+type FileNotifier struct {
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*FileRecipient
+}
+
+func (n *FileNotifier) Name() string {
+	return "file"
+}
+
+// record returns the json encoded alert along with the event type and timestamp
+func (n *FileNotifier) record(event *models.AlertEvent, ts time.Time) ([]byte, error) {
+	data, err := json.Marshal(event.Alert)
+	if err != nil {
+		return nil, err
+	}
+	rec := make(map[string]interface{})
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec["event_type"] = event.Type.String()
+	rec["timestamp"] = ts.Unix()
+	data, err = json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (n *FileNotifier) send(req *plugins.SendRequest) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	now := time.Now()
+	alert := req.Event.Alert
+	path, err := recp.render(pathData{
+		Team:   pathSafe(alert.Team),
+		Source: pathSafe(alert.Source),
+		Date:   now.UTC().Format("2006-01-02"),
+	})
+	if err != nil {
+		glog.Errorf("Output: File: Failed to render path: %v", err)
+		span.SetError(err)
+		return
+	}
+	rec, err := n.record(req.Event, now)
+	if err != nil {
+		glog.Errorf("Output: File: Cant get json record for alert %s: %v", alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	if err := recp.write(path, rec); err != nil {
+		glog.Errorf("Output: Unable to write to file %s: %v", path, err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+}
+
+func (n *FileNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	t := time.NewTicker(fileHousekeepingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req)
+		case <-t.C:
+			for _, r := range n.Recipients {
+				r.housekeeping()
+			}
+		case <-ctx.Done():
+			for _, r := range n.Recipients {
+				r.closeAll()
+			}
+			return
+		}
+	}
+}
+
+func init() {
+	n := &FileNotifier{Notif: make(chan *plugins.SendRequest)}
+	plugins.AddOutput(n, n.Notif)
+}
@@ -62,6 +62,7 @@ func (n *InfluxNotifier) parseFromEvent(event *models.AlertEvent) *reporting.Dat
 		Tags:        tags,
 		Fields:      fields,
 		TimeStamp:   time.Now(),
+		Kind:        reporting.Delta,
 	}
 }
 
@@ -83,8 +84,11 @@ func (n *InfluxNotifier) Start(ctx context.Context, opts *plugins.Options) {
 	for {
 		select {
 		case req := <-n.Notif:
+			span := req.StartSpan(n.Name())
 			d := n.parseFromEvent(req.Event)
 			reporting.DataChan <- d
+			req.Sent(n.Name())
+			span.End()
 		case <-ctx.Done():
 			return
 		}
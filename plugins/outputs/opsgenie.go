@@ -0,0 +1,260 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	ogDefaultApiUrl = "https://api.opsgenie.com"
+	ogMaxMessageLen = 130
+	ogMaxAliasLen   = 512
+	ogDefaultSource = "Alert Manager"
+	ogDefaultUser   = "alert_manager"
+)
+
+var ogPriorityMap = map[string]string{
+	"CRITICAL": "P1",
+	"MAJOR":    "P2",
+	"WARN":     "P3",
+	"INFO":     "P5",
+}
+
+type OgResponder struct {
+	// Type is one of team, user, escalation or schedule
+	Type string
+	Name string
+}
+
+type OgRecipient struct {
+	// ApiKey overrides the output level api key if set
+	ApiKey     string `mapstructure:"api_key"`
+	Responders []OgResponder
+	Tags       []string
+	// Priorities maps alert severity to opsgenie priority (P1-P5)
+	Priorities  map[string]string
+	AutoResolve bool `mapstructure:"auto_resolve"`
+	SendAck     bool `mapstructure:"send_ack"`
+}
+
+type ogCreateMsg struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description"`
+	Responders  []map[string]string `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Entity      string              `json:"entity,omitempty"`
+	Source      string              `json:"source"`
+	Priority    string              `json:"priority"`
+}
+
+type ogActionMsg struct {
+	User   string `json:"user,omitempty"`
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+type ogPriorityMsg struct {
+	Priority string `json:"priority"`
+}
+
+type OpsgenieNotifier struct {
+	ApiUrl     string `mapstructure:"api_url"`
+	ApiKey     string `mapstructure:"api_key"`
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*OgRecipient
+}
+
+func (n *OpsgenieNotifier) Name() string {
+	return "opsgenie"
+}
+
+// alias uniquely identifies an alert in opsgenie so that subsequent updates
+// apply to the same opsgenie alert.
+func (n *OpsgenieNotifier) alias(alert *models.Alert) string {
+	return truncate(fingerprint(alert), ogMaxAliasLen)
+}
+
+func (n *OpsgenieNotifier) priority(recp *OgRecipient, sev models.AlertSeverity) string {
+	if p, ok := recp.Priorities[sev.String()]; ok {
+		return p
+	}
+	if p, ok := ogPriorityMap[sev.String()]; ok {
+		return p
+	}
+	return "P3"
+}
+
+func (n *OpsgenieNotifier) createMsg(recp *OgRecipient, alert *models.Alert, weburl string) *ogCreateMsg {
+	message := truncate(fmt.Sprintf("[%s] %s", alert.Severity.String(), alert.Name), ogMaxMessageLen)
+	m := &ogCreateMsg{
+		Message:     message,
+		Alias:       n.alias(alert),
+		Description: fmt.Sprintf("%s\nAM Url: %s/%d", alert.Description, weburl, alert.Id),
+		Entity:      alert.Entity,
+		Source:      ogDefaultSource,
+		Priority:    n.priority(recp, alert.Severity),
+		Details: map[string]string{
+			"alert_id": fmt.Sprintf("%d", alert.Id),
+			"team":     alert.Team,
+			"source":   alert.Source,
+		},
+	}
+	if alert.Device.Valid {
+		m.Details["device"] = alert.Device.String
+	}
+	for k, v := range alert.Labels {
+		if _, ok := m.Details[k]; !ok {
+			m.Details[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	m.Tags = append(m.Tags, alert.Tags...)
+	m.Tags = append(m.Tags, recp.Tags...)
+	for _, r := range recp.Responders {
+		m.Responders = append(m.Responders, map[string]string{"type": r.Type, "name": r.Name})
+	}
+	return m
+}
+
+// ogRequest is a single request to the opsgenie alert API
+type ogRequest struct {
+	method, path string
+	body         interface{}
+}
+
+func (n *OpsgenieNotifier) requests(recp *OgRecipient, event *models.AlertEvent, weburl string) ([]ogRequest, error) {
+	alert := event.Alert
+	aliasPath := fmt.Sprintf("/v2/alerts/%s", url.PathEscape(n.alias(alert)))
+	switch event.Type {
+	case models.EventType_ACTIVE:
+		return []ogRequest{{"POST", "/v2/alerts", n.createMsg(recp, alert, weburl)}}, nil
+	case models.EventType_ESCALATED:
+		return []ogRequest{
+			{"PUT", aliasPath + "/priority", &ogPriorityMsg{Priority: n.priority(recp, alert.Severity)}},
+			{"POST", aliasPath + "/notes", &ogActionMsg{
+				Source: ogDefaultSource,
+				Note:   fmt.Sprintf("Alert severity escalated to %s", alert.Severity.String()),
+			}},
+		}, nil
+	case models.EventType_CLEARED, models.EventType_EXPIRED:
+		return []ogRequest{{"POST", aliasPath + "/close", &ogActionMsg{
+			Source: ogDefaultSource,
+			User:   ogDefaultUser,
+			Note:   fmt.Sprintf("Alert %s in Alert Manager", alert.Status.String()),
+		}}}, nil
+	case models.EventType_ACKD:
+		return []ogRequest{{"POST", aliasPath + "/acknowledge", &ogActionMsg{
+			Source: ogDefaultSource,
+			User:   alert.Owner.String,
+			Note:   fmt.Sprintf("Alert acknowledged in Alert Manager by %s", alert.Owner.String),
+		}}}, nil
+	}
+	return nil, fmt.Errorf("Unsupported event type %s", event.Type.String())
+}
+
+func (n *OpsgenieNotifier) do(r ogRequest, apiKey string, timeout time.Duration) error {
+	data, err := json.Marshal(r.body)
+	if err != nil {
+		return err
+	}
+	apiUrl := n.ApiUrl
+	if apiUrl == "" {
+		apiUrl = ogDefaultApiUrl
+	}
+	u := apiUrl + r.path
+	if r.path != "/v2/alerts" {
+		u += "?identifierType=alias"
+	}
+	req, err := http.NewRequest(r.method, u, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+apiKey)
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (n *OpsgenieNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	event := req.Event
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	switch event.Type {
+	case models.EventType_SUPPRESSED:
+		return
+	case models.EventType_CLEARED, models.EventType_EXPIRED:
+		if !recp.AutoResolve {
+			return
+		}
+	case models.EventType_ACKD:
+		if !recp.SendAck {
+			return
+		}
+	}
+	apiKey := n.ApiKey
+	if recp.ApiKey != "" {
+		apiKey = recp.ApiKey
+	}
+	requests, err := n.requests(recp, event, opts.WebUrl)
+	if err != nil {
+		glog.Errorf("Output: Opsgenie: Cant get request for alert %s: %v", event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	for _, r := range requests {
+		if err := n.do(r, apiKey, opts.ClientTimeout); err != nil {
+			glog.Errorf("Output: Unable to post to opsgenie: %v", err)
+			span.SetError(err)
+			return
+		}
+	}
+	req.Sent(n.Name())
+}
+
+func (n *OpsgenieNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req, opts)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func init() {
+	n := &OpsgenieNotifier{Notif: make(chan *plugins.SendRequest)}
+	plugins.AddOutput(n, n.Notif)
+}
@@ -1,17 +1,37 @@
 package output
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gosnmp/gosnmp"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
+	tpl "github.com/mayuresh82/alert_manager/template"
 	tu "github.com/mayuresh82/alert_manager/testutil"
+	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,17 +87,114 @@ func TestOutputSlack(t *testing.T) {
 	assert.Equal(t, res["channel"].(string), "#test")
 }
 
+type slackCall struct {
+	method, auth string
+	body         map[string]interface{}
+}
+
+func TestOutputSlackToken(t *testing.T) {
+	calls := make(chan slackCall, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := slackCall{method: r.URL.Path, auth: r.Header.Get("Authorization")}
+		json.NewDecoder(r.Body).Decode(&c.body)
+		calls <- c
+		fmt.Fprintln(w, `{"ok": true, "channel": "C123", "ts": "1600000000.000100"}`)
+	}))
+	defer ts.Close()
+	s := &SlackNotifier{
+		ApiUrl: ts.URL,
+		Recipients: map[string]*SlackRecipient{
+			"default": &SlackRecipient{Channel: "#test", Token: "xoxb-1", Action: "ack, clear", Mention: "@here"},
+		},
+	}
+	db := &mockDb{}
+	opts := &plugins.Options{WebUrl: "http://am", ClientTimeout: 2 * time.Second, Db: db}
+	alert := tu.MockAlert(5, "Neteng BGP Down", "This alert has fired", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{}, nil)
+	alert.Status = models.Status_ACTIVE
+	send := func(eventType models.EventType) {
+		req := &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: eventType, Alert: alert}}
+		if err := s.sendApi(s.Recipients["default"], req, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks := func(body map[string]interface{}) []interface{} {
+		return body["attachments"].([]interface{})[0].(map[string]interface{})["blocks"].([]interface{})
+	}
+
+	// acks are not posted before the alert has a message
+	send(models.EventType_ACKD)
+	assert.Equal(t, 0, len(calls))
+
+	// the first event posts the root message with buttons
+	send(models.EventType_ACTIVE)
+	c := <-calls
+	assert.Equal(t, "/chat.postMessage", c.method)
+	assert.Equal(t, "Bearer xoxb-1", c.auth)
+	assert.Equal(t, "#test", c.body["channel"])
+	assert.Equal(t, "[WARN][ACTIVE] Neteng BGP Down", c.body["text"])
+	b := blocks(c.body)
+	assert.Equal(t, "*<http://am/5|[WARN][ACTIVE] Neteng BGP Down>*\n@here This alert has fired", b[0].(map[string]interface{})["text"].(map[string]interface{})["text"])
+	actions := b[len(b)-1].(map[string]interface{})
+	assert.Equal(t, "am_actions", actions["block_id"])
+	elements := actions["elements"].([]interface{})
+	assert.Equal(t, 2, len(elements))
+	assert.Equal(t, "am_ack", elements[0].(map[string]interface{})["action_id"])
+	assert.Equal(t, "5", elements[0].(map[string]interface{})["value"])
+	assert.Equal(t, "am_clear", elements[1].(map[string]interface{})["action_id"])
+	assert.Equal(t, &models.OutputMessage{AlertId: 5, Output: "slack.default", Channel: "C123", MessageId: "1600000000.000100"}, db.messages["slack.default"])
+
+	// escalation updates the root message and is broadcast from the thread
+	alert.Severity = models.Sev_CRITICAL
+	send(models.EventType_ESCALATED)
+	c = <-calls
+	assert.Equal(t, "/chat.update", c.method)
+	assert.Equal(t, "C123", c.body["channel"])
+	assert.Equal(t, "1600000000.000100", c.body["ts"])
+	assert.Equal(t, "[CRITICAL][ACTIVE] Neteng BGP Down", c.body["text"])
+	assert.Equal(t, "danger", c.body["attachments"].([]interface{})[0].(map[string]interface{})["color"])
+	c = <-calls
+	assert.Equal(t, "/chat.postMessage", c.method)
+	assert.Equal(t, "1600000000.000100", c.body["thread_ts"])
+	assert.Equal(t, "@here Escalated to CRITICAL", c.body["text"])
+	assert.Equal(t, true, c.body["reply_broadcast"])
+
+	// reminders are threaded
+	send(models.EventType_ACTIVE)
+	<-calls
+	c = <-calls
+	assert.Equal(t, "@here Reminder: alert is still active", c.body["text"])
+	assert.Nil(t, c.body["reply_broadcast"])
+
+	// ack removes the ack button from the root message
+	alert.Owner = sql.NullString{String: "foo", Valid: true}
+	send(models.EventType_ACKD)
+	c = <-calls
+	b = blocks(c.body)
+	elements = b[len(b)-1].(map[string]interface{})["elements"].([]interface{})
+	assert.Equal(t, 1, len(elements))
+	assert.Equal(t, "am_clear", elements[0].(map[string]interface{})["action_id"])
+	c = <-calls
+	assert.Equal(t, "Acknowledged by foo", c.body["text"])
+
+	// clear turns the root message green without buttons
+	alert.Status = models.Status_CLEARED
+	send(models.EventType_CLEARED)
+	c = <-calls
+	assert.Equal(t, "[CRITICAL][CLEARED] Neteng BGP Down", c.body["text"])
+	assert.Equal(t, "good", c.body["attachments"].([]interface{})[0].(map[string]interface{})["color"])
+	data, _ := json.Marshal(c.body)
+	assert.NotContains(t, string(data), "am_actions")
+	c = <-calls
+	assert.Equal(t, "Cleared", c.body["text"])
+	assert.Equal(t, 0, len(calls))
+}
+
 type mockEmailer struct {
-	subject, body string
-	from          string
-	to            []string
+	msgs []*EmailMessage
 }
 
-func (m *mockEmailer) send(addr, username, pwd, from, subject, body string, to []string) error {
-	m.subject = subject
-	m.body = body
-	m.from = from
-	m.to = to
+func (m *mockEmailer) send(smtp *SmtpConfig, msg *EmailMessage) error {
+	m.msgs = append(m.msgs, msg)
 	return nil
 }
 
@@ -118,9 +235,1008 @@ func TestOutputEmail(t *testing.T) {
 			StartTime:   models.MyTime{time.Unix(1136239445, 0)},
 		},
 	}
-	n.start(&plugins.SendRequest{Name: "default", Event: event}, "htt://localhost")
-	assert.Equal(t, emailer.subject, "Alert Manager: [ACTIVE] Test Alert: [testent]")
-	assert.Equal(t, emailer.body, renderedTpl)
-	assert.Equal(t, emailer.from, "a@foo.com")
-	assert.Equal(t, emailer.to, []string{"b@bar.com"})
+	opts := &plugins.Options{WebUrl: "htt://localhost", Db: &mockDb{}}
+	n.start(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	msg := emailer.msgs[0]
+	assert.Equal(t, msg.Subject, "Alert Manager: [ACTIVE] Test Alert: [testent]")
+	assert.Equal(t, msg.Html, renderedTpl)
+	assert.Equal(t, msg.From, "a@foo.com")
+	assert.Equal(t, msg.To, []string{"b@bar.com"})
+	assert.Equal(t, msg.MessageId, "<alert-1.1136239445@foo.com>")
+	assert.Equal(t, msg.InReplyTo, "")
+
+	// later events reply to the first message and use the per event subject
+	n.Recipients["default"].Subject = "{{.Alert.Team}}: {{.Alert.Name}}"
+	n.Recipients["default"].Subjects = map[string]string{"cleared": "Cleared: {{.Alert.Name}}"}
+	n.start(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ESCALATED, Alert: event.Alert}}, opts)
+	msg = emailer.msgs[1]
+	assert.Equal(t, msg.Subject, "t1: Test Alert")
+	assert.True(t, strings.HasPrefix(msg.MessageId, "<alert-1.escalated."))
+	assert.Equal(t, msg.InReplyTo, "<alert-1.1136239445@foo.com>")
+
+	event.Alert.Clear()
+	n.start(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_CLEARED, Alert: event.Alert}}, opts)
+	msg = emailer.msgs[2]
+	assert.Equal(t, msg.Subject, "Cleared: Test Alert")
+	assert.Equal(t, msg.InReplyTo, "<alert-1.1136239445@foo.com>")
+}
+
+// smtpStub is a minimal smtp server that records the data of each message
+type smtpStub struct {
+	net.Listener
+	msgs chan string
+	// fail is the number of messages to reject before accepting
+	fail int32
+}
+
+func newSmtpStub(t *testing.T, tlsConfig *tls.Config) *smtpStub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	s := &smtpStub{Listener: l, msgs: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 localhost ESMTP stub")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			if atomic.AddInt32(&s.fail, -1) >= 0 {
+				c.PrintfLine("554 Transaction failed")
+				continue
+			}
+			s.msgs <- string(data)
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestOutputEmailSmtp(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	plain := newSmtpStub(t, nil)
+	defer plain.Close()
+	implicit := newSmtpStub(t, &tls.Config{Certificates: ts.TLS.Certificates})
+	defer implicit.Close()
+
+	alert := tu.MockAlert(1, "Test Alert", "Test Desc", "dev1", "ent1", "src", "scp", "t1", "1", "CRITICAL", []string{}, nil)
+	sender := &EmailSender{}
+	for _, tt := range []struct {
+		stub *smtpStub
+		tls  string
+	}{{plain, "none"}, {implicit, "implicit"}} {
+		msg := &EmailMessage{
+			From:      "a@foo.com",
+			To:        []string{"b@bar.com"},
+			Subject:   "Test Alert",
+			Html:      "<b>Test Desc</b>",
+			Text:      "Test Desc",
+			MessageId: "<alert-1.2@foo.com>",
+			InReplyTo: "<alert-1.1@foo.com>",
+		}
+		smtp := &SmtpConfig{Addr: tt.stub.Addr().String(), Tls: tt.tls, InsecureSkipVerify: true}
+		if err := sender.send(smtp, msg); err != nil {
+			t.Fatalf("%s: %v", tt.tls, err)
+		}
+		m, err := mail.ReadMessage(strings.NewReader(<-tt.stub.msgs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, m.Header.Get("Subject"), "Test Alert")
+		assert.Equal(t, m.Header.Get("Message-ID"), "<alert-1.2@foo.com>")
+		assert.Equal(t, m.Header.Get("In-Reply-To"), "<alert-1.1@foo.com>")
+		assert.Equal(t, m.Header.Get("References"), "<alert-1.1@foo.com>")
+		mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, mediaType, "multipart/alternative")
+		r := multipart.NewReader(m.Body, params["boundary"])
+		var types []string
+		for {
+			part, err := r.NextPart()
+			if err != nil {
+				break
+			}
+			types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+		}
+		assert.Equal(t, types, []string{"text/plain", "text/html"})
+	}
+
+	// the first active event starts the thread
+	emailer := &mockEmailer{}
+	n := &EmailNotifier{
+		Emailer:    emailer,
+		rawTpl:     tpl.EmailTemplate,
+		rawTextTpl: tpl.EmailTextTemplate,
+		Recipients: map[string]*EmailRecipient{
+			"default": &EmailRecipient{From: "Alerts <a@foo.com>", To: []string{"b@bar.com"}},
+		},
+	}
+	n.start(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}}, &plugins.Options{})
+	assert.Equal(t, emailer.msgs[0].MessageId, fmt.Sprintf("<alert-1.%d@foo.com>", alert.StartTime.Unix()))
+	assert.True(t, strings.Contains(emailer.msgs[0].Text, "Description: Test Desc"))
+
+	// the thread is only saved once the first email is delivered
+	db := &mockDb{}
+	plain.fail = 1
+	n.Emailer = sender
+	n.SmtpAddr = plain.Addr().String()
+	n.SmtpTls = "none"
+	n.Recipients["default"].From = "a@foo.com"
+	req := &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}}
+	n.start(req, &plugins.Options{Db: db})
+	assert.Equal(t, 0, len(db.messages))
+	n.start(req, &plugins.Options{Db: db})
+	m, err := mail.ReadMessage(strings.NewReader(<-plain.msgs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	threadId := fmt.Sprintf("<alert-1.%d@foo.com>", alert.StartTime.Unix())
+	assert.Equal(t, m.Header.Get("Message-ID"), threadId)
+	assert.Equal(t, m.Header.Get("In-Reply-To"), "")
+	assert.Equal(t, threadId, db.messages["email.default"].MessageId)
+}
+
+func TestOutputTracing(t *testing.T) {
+	exp := &tracing.InMemoryExporter{}
+	tracing.SetExporter(exp)
+	defer tracing.SetExporter(nil)
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	n := &WebhookNotifier{Recipients: map[string]*WebhookRecipient{"default": &WebhookRecipient{Url: ts.URL}}}
+	opts := &plugins.Options{ClientTimeout: 2 * time.Second}
+	parent := tracing.StartSpan(tracing.SpanContext{}, "processor.notifier")
+	alert := tu.MockAlert(1, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{}, nil)
+	req := &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}, Trace: parent.Context}
+
+	// the span covers the delivery and is a child of the span the event was sent from
+	n.send(context.Background(), req, opts)
+	spans := exp.Find("output.webhook")
+	assert.Equal(t, len(spans), 1)
+	assert.Equal(t, spans[0].Context.TraceId, parent.Context.TraceId)
+	assert.Equal(t, spans[0].ParentId, parent.Context.SpanId)
+	assert.Equal(t, spans[0].Attributes["recipient"], "default")
+	assert.Equal(t, spans[0].Error, "")
+
+	// failed sends are marked on the span
+	exp.Reset()
+	status = http.StatusInternalServerError
+	n.send(context.Background(), req, opts)
+	spans = exp.Find("output.webhook")
+	assert.Equal(t, len(spans), 1)
+	assert.Contains(t, spans[0].Error, "Got HTTP 500")
+}
+
+func TestOutputWebhook(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+		posts   int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = r.Header
+		posts++
+	}))
+	defer ts.Close()
+	n := &WebhookNotifier{
+		Recipients: map[string]*WebhookRecipient{
+			"default": &WebhookRecipient{
+				Url:        ts.URL,
+				Headers:    map[string]string{"X-Custom": "foo"},
+				EventTypes: []string{"active", "cleared"},
+				Secret:     "s3cr3t",
+			},
+			"tpl": &WebhookRecipient{
+				Url:      ts.URL,
+				Template: `{"name": {{json .Alert.Name}}, "type": "{{.EventType}}", "key": "{{.IdempotencyKey}}"}`,
+			},
+		},
+	}
+	opts := &plugins.Options{WebUrl: "http://localhost", ClientTimeout: 2 * time.Second}
+	event := &models.AlertEvent{
+		Type:  models.EventType_ACTIVE,
+		Alert: tu.MockAlert(1, "Neteng BGP Down", "This alert has fired", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{}, nil),
+	}
+
+	n.send(context.Background(), &plugins.SendRequest{Name: "default", Event: event}, opts)
+	assert.Equal(t, posts, 1)
+	assert.Equal(t, headers.Get("X-Custom"), "foo")
+	assert.Equal(t, headers.Get(defaultSignatureHeader), "sha256="+sign("s3cr3t", body))
+	assert.Equal(t, headers.Get(defaultIdempotencyHeader), idempotencyKey(event))
+	res := make(map[string]interface{})
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, res["event_type"].(string), "ACTIVE")
+	assert.Equal(t, res["alert_url"].(string), "http://localhost/1")
+	assert.Equal(t, res["alert"].(map[string]interface{})["name"].(string), "Neteng BGP Down")
+
+	// unsubscribed event types are not sent
+	n.send(context.Background(), &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACKD, Alert: event.Alert}}, opts)
+	assert.Equal(t, posts, 1)
+
+	n.send(context.Background(), &plugins.SendRequest{Name: "tpl", Event: event}, opts)
+	assert.Equal(t, posts, 2)
+	assert.Equal(t, headers.Get(defaultSignatureHeader), "")
+	assert.Equal(t, string(body), fmt.Sprintf(`{"name": "Neteng BGP Down", "type": "ACTIVE", "key": "%s"}`, idempotencyKey(event)))
+}
+
+func TestOutputWebhookRetry(t *testing.T) {
+	var posts []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts = append(posts, time.Now())
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	n := &WebhookNotifier{Recipients: map[string]*WebhookRecipient{
+		"default": &WebhookRecipient{Url: ts.URL, Retries: 2, RetryDelay: 20 * time.Millisecond},
+	}}
+	opts := &plugins.Options{ClientTimeout: 2 * time.Second}
+	alert := tu.MockAlert(1, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{}, nil)
+	req := &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}}
+
+	// the delay between attempts doubles after each retry
+	n.send(context.Background(), req, opts)
+	if assert.Equal(t, len(posts), 3) {
+		assert.True(t, posts[1].Sub(posts[0]) >= 20*time.Millisecond)
+		assert.True(t, posts[2].Sub(posts[1]) >= 40*time.Millisecond)
+	}
+
+	// retries stop once ctx is done
+	posts = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n.send(ctx, req, opts)
+	assert.Equal(t, len(posts), 1)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, truncate("abc", 5), "abc")
+	assert.Equal(t, truncate("abcdef", 3), "abc")
+	// multi-byte characters are not split
+	assert.Equal(t, truncate("aé€", 2), "a")
+	assert.Equal(t, truncate("aé€", 4), "aé")
+	assert.Equal(t, truncate("aé€", 6), "aé€")
+	assert.Equal(t, truncate("€", 2), "")
+}
+
+func TestOutputPagerDuty(t *testing.T) {
+	recvd := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/v2/enqueue")
+		res := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		recvd <- res
+	}))
+	defer ts.Close()
+	n := &PagerDutyNotifier{
+		ApiUrl: ts.URL,
+		Notif:  make(chan *plugins.SendRequest),
+		Recipients: map[string]*PdRecipient{
+			"default": &PdRecipient{RoutingKey: "rkey", AutoResolve: true},
+			"fp":      &PdRecipient{RoutingKey: "rkey2", DedupBy: "fingerprint", SendAck: true},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Start(ctx, &plugins.Options{WebUrl: "http://localhost", ClientTimeout: 2 * time.Second})
+
+	alert := tu.MockAlert(10, "Neteng BGP Down", "This alert has fired", "dev1", "PeerX", "src", "scp", "t1", "1", "CRITICAL", []string{}, models.Labels{"site": "sjc1"})
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}}
+	res := <-recvd
+	assert.Equal(t, res["routing_key"].(string), "rkey")
+	assert.Equal(t, res["event_action"].(string), "trigger")
+	assert.Equal(t, res["dedup_key"].(string), "alert_manager:10")
+	payload := res["payload"].(map[string]interface{})
+	assert.Equal(t, payload["severity"].(string), "critical")
+	assert.Equal(t, payload["source"].(string), "dev1")
+	assert.Equal(t, payload["component"].(string), "PeerX")
+	assert.Equal(t, payload["custom_details"].(map[string]interface{})["site"].(string), "sjc1")
+
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_EXPIRED, Alert: alert}}
+	res = <-recvd
+	assert.Equal(t, res["event_action"].(string), "resolve")
+	assert.Nil(t, res["payload"])
+
+	// acks are not sent unless enabled for the recipient
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACKD, Alert: alert}}
+	n.Notif <- &plugins.SendRequest{Name: "fp", Event: &models.AlertEvent{Type: models.EventType_ACKD, Alert: alert}}
+	res = <-recvd
+	assert.Equal(t, res["routing_key"].(string), "rkey2")
+	assert.Equal(t, res["event_action"].(string), "acknowledge")
+	assert.Equal(t, res["dedup_key"].(string), "Neteng BGP Down:dev1:PeerX")
+}
+
+func TestOutputOpsgenie(t *testing.T) {
+	type ogReq struct {
+		method, uri, auth string
+		body              map[string]interface{}
+	}
+	var reqs []ogReq
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, ogReq{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), body})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	n := &OpsgenieNotifier{
+		ApiUrl: ts.URL,
+		ApiKey: "key1",
+		Recipients: map[string]*OgRecipient{
+			"default": &OgRecipient{
+				Responders:  []OgResponder{{Type: "team", Name: "neteng"}},
+				Tags:        []string{"network"},
+				Priorities:  map[string]string{"WARN": "P4"},
+				AutoResolve: true,
+				SendAck:     true,
+			},
+		},
+	}
+	opts := &plugins.Options{WebUrl: "http://localhost", ClientTimeout: 2 * time.Second}
+	alert := tu.MockAlert(5, "Neteng BGP Down", "This alert has fired", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{"bgp"}, nil)
+	alias := "/v2/alerts/Neteng%20BGP%20Down:dev1:PeerX"
+
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}}, opts)
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].method, "POST")
+	assert.Equal(t, reqs[0].uri, "/v2/alerts")
+	assert.Equal(t, reqs[0].auth, "GenieKey key1")
+	assert.Equal(t, reqs[0].body["alias"].(string), "Neteng BGP Down:dev1:PeerX")
+	assert.Equal(t, reqs[0].body["priority"].(string), "P4")
+	assert.Equal(t, reqs[0].body["tags"].([]interface{}), []interface{}{"bgp", "network"})
+	assert.Equal(t, reqs[0].body["responders"].([]interface{})[0].(map[string]interface{})["name"].(string), "neteng")
+
+	alert.SetSeverity(models.Sev_CRITICAL)
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ESCALATED, Alert: alert}}, opts)
+	assert.Equal(t, len(reqs), 3)
+	assert.Equal(t, reqs[1].method, "PUT")
+	assert.Equal(t, reqs[1].uri, alias+"/priority?identifierType=alias")
+	assert.Equal(t, reqs[1].body["priority"].(string), "P1")
+	assert.Equal(t, reqs[2].uri, alias+"/notes?identifierType=alias")
+
+	alert.SetOwner("foo", "")
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACKD, Alert: alert}}, opts)
+	assert.Equal(t, reqs[3].uri, alias+"/acknowledge?identifierType=alias")
+	assert.Equal(t, reqs[3].body["user"].(string), "foo")
+
+	alert.Clear()
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_CLEARED, Alert: alert}}, opts)
+	assert.Equal(t, reqs[4].uri, alias+"/close?identifierType=alias")
+
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_SUPPRESSED, Alert: alert}}, opts)
+	assert.Equal(t, len(reqs), 5)
+}
+
+type mockDb struct {
+	components models.Alerts
+	messages   map[string]*models.OutputMessage
+}
+
+func (d *mockDb) NewTx() models.Txn {
+	return &mockTx{db: d}
+}
+
+func (d *mockDb) Close() error {
+	return nil
+}
+
+type mockTx struct {
+	*models.Tx
+	db *mockDb
+}
+
+func (tx *mockTx) SelectAlerts(query string, args ...interface{}) (models.Alerts, error) {
+	if query == models.QuerySelectByAggId {
+		return tx.db.components, nil
+	}
+	return models.Alerts{}, nil
+}
+
+func (tx *mockTx) InSelect(query string, to interface{}, args ...interface{}) error {
+	switch query {
+	case models.QuerySelectOutputMessage:
+		if msg, ok := tx.db.messages[args[1].(string)]; ok && msg.AlertId == args[0].(int64) {
+			*(to.(*[]*models.OutputMessage)) = []*models.OutputMessage{msg}
+		}
+	case models.QuerySelectOutputMessageById:
+		if msg, ok := tx.db.messages[args[0].(string)]; ok && msg.MessageId == args[1].(string) {
+			*(to.(*[]*models.OutputMessage)) = []*models.OutputMessage{msg}
+		}
+	}
+	return nil
+}
+
+func (tx *mockTx) Exec(query string, args ...interface{}) error {
+	if query == models.QueryUpsertOutputMessage {
+		if tx.db.messages == nil {
+			tx.db.messages = make(map[string]*models.OutputMessage)
+		}
+		tx.db.messages[args[1].(string)] = &models.OutputMessage{
+			AlertId: args[0].(int64), Output: args[1].(string), Channel: args[2].(string), MessageId: args[3].(string),
+		}
+	}
+	return nil
+}
+
+func (tx *mockTx) Commit() error {
+	return nil
+}
+
+func (tx *mockTx) Rollback() error {
+	return nil
+}
+
+func TestOutputTeams(t *testing.T) {
+	recvd := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		recvd <- res
+	}))
+	defer ts.Close()
+	n := &TeamsNotifier{
+		Notif: make(chan *plugins.SendRequest),
+		Recipients: map[string]*TeamsRecipient{
+			"default": &TeamsRecipient{Url: ts.URL, Mention: "<at>neteng</at>"},
+		},
+	}
+	db := &mockDb{components: models.Alerts{
+		tu.MockAlert(2, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1", "1", "WARN", []string{}, nil),
+		tu.MockAlert(3, "Neteng BGP Down", "Peer down", "dev2", "PeerY", "src", "scp", "t1", "1", "WARN", []string{}, nil),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Start(ctx, &plugins.Options{WebUrl: "http://localhost", ClientTimeout: 2 * time.Second, Db: db})
+
+	getCard := func(res map[string]interface{}) ([]interface{}, []interface{}) {
+		a := res["attachments"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, a["contentType"].(string), adaptiveCardContentType)
+		card := a["content"].(map[string]interface{})
+		assert.Equal(t, card["type"].(string), "AdaptiveCard")
+		return card["body"].([]interface{}), card["actions"].([]interface{})
+	}
+	agg := tu.MockAlert(1, "Neteng BGP Agg", "Multiple peers down", "", "Various", "src", "scp", "t1", "1", "CRITICAL", []string{}, nil)
+	agg.IsAggregate = true
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: agg}}
+	body, actions := getCard(<-recvd)
+	header := body[0].(map[string]interface{})
+	assert.Equal(t, header["style"].(string), "attention")
+	assert.Equal(t, header["items"].([]interface{})[0].(map[string]interface{})["text"].(string), "[CRITICAL][ACTIVE] Neteng BGP Agg")
+	assert.Equal(t, body[1].(map[string]interface{})["text"].(string), "<at>neteng</at> Multiple peers down")
+	components := body[4].(map[string]interface{})["facts"].([]interface{})
+	assert.Equal(t, len(components), 2)
+	assert.Equal(t, components[1].(map[string]interface{})["value"].(string), "[ACTIVE] Neteng BGP Down: dev2 PeerY")
+	assert.Equal(t, actions[0].(map[string]interface{})["url"].(string), "http://localhost/1")
+
+	agg.Clear()
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_CLEARED, Alert: agg}}
+	body, _ = getCard(<-recvd)
+	header = body[0].(map[string]interface{})
+	assert.Equal(t, header["style"].(string), "good")
+	assert.Equal(t, header["items"].([]interface{})[0].(map[string]interface{})["text"].(string), "[CLEARED] Alert 1: Neteng BGP Agg")
+}
+
+func TestOutputSyslog(t *testing.T) {
+	n := &SyslogNotifier{hostname: "am1"}
+	opts := &plugins.Options{ClientTimeout: 2 * time.Second}
+	alert := tu.MockAlert(7, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1", "1", "CRITICAL", []string{}, models.Labels{"site": "sjc1", "quote": `a"b]`})
+	event := &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}
+
+	// udp
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	n.Recipients = map[string]*SyslogRecipient{
+		"default": &SyslogRecipient{Addr: pc.LocalAddr().String(), Facility: "local3", EnterpriseId: 64000, Labels: []string{"site", "quote", "missing"}},
+	}
+	assert.Nil(t, n.Init())
+	// enterprise_id is required and the documentation number is rejected
+	n.Recipients["bad"] = &SyslogRecipient{Addr: "x"}
+	assert.NotNil(t, n.Init())
+	n.Recipients["bad"].EnterpriseId = 32473
+	assert.NotNil(t, n.Init())
+	delete(n.Recipients, "bad")
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	l, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:l])
+	// local3 (19) * 8 + crit (2)
+	assert.True(t, strings.HasPrefix(msg, "<154>1 "))
+	assert.Contains(t, msg, fmt.Sprintf(" am1 alert_manager %d ACTIVE ", os.Getpid()))
+	assert.Contains(t, msg, `[alert@64000 id="7" name="Neteng BGP Down" device="dev1" entity="PeerX" severity="CRITICAL" status="ACTIVE" team="t1" event="ACTIVE"]`)
+	assert.Contains(t, msg, `[labels@64000 quote="a\"b\]" site="sjc1"] Peer down`)
+
+	// tcp with octet counting, reconnecting after the connection is closed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	recvd := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			var length int
+			if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+				return
+			}
+			data := make([]byte, length)
+			io.ReadFull(r, data)
+			recvd <- string(data)
+			conn.Close()
+		}
+	}()
+	recp := &SyslogRecipient{Addr: ln.Addr().String(), Transport: "tcp", AppName: "am", EnterpriseId: 64000}
+	n.Recipients = map[string]*SyslogRecipient{"default": recp}
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	msg = <-recvd
+	assert.True(t, strings.HasPrefix(msg, "<130>1 "))
+	assert.True(t, strings.HasSuffix(msg, "] Peer down"))
+	recp.close()
+	event.Type = models.EventType_CLEARED
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	msg = <-recvd
+	assert.Contains(t, msg, " am1 am ")
+	assert.Contains(t, msg, " CLEARED [alert@64000 ")
+}
+
+func TestOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "am_file_output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	recp := &FileRecipient{
+		Path:     filepath.Join(dir, "{{.Team}}", "{{.Date}}.jsonl"),
+		MaxSize:  600,
+		Compress: true,
+		MaxAge:   time.Hour,
+	}
+	n := &FileNotifier{Recipients: map[string]*FileRecipient{"default": recp}}
+	alert := tu.MockAlert(3, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1/x", "1", "WARN", []string{}, nil)
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}})
+
+	path := filepath.Join(dir, "t1_x", time.Now().UTC().Format("2006-01-02")+".jsonl")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := make(map[string]interface{})
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, rec["event_type"].(string), "ACTIVE")
+	assert.Equal(t, rec["name"].(string), "Neteng BGP Down")
+	assert.Equal(t, rec["device"].(string), "dev1")
+	assert.Equal(t, rec["severity"].(string), "WARN")
+	assert.NotNil(t, rec["timestamp"])
+
+	// exceeding max size rotates and compresses the file, closing waits for the compression
+	n.send(&plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_CLEARED, Alert: alert}})
+	recp.closeAll()
+	rotated, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, len(rotated), 1)
+	assert.True(t, strings.HasSuffix(rotated[0], ".gz"))
+	f, err := os.Open(rotated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, old, data)
+	data, _ = ioutil.ReadFile(path)
+	assert.Contains(t, string(data), `"event_type":"CLEARED"`)
+
+	// old files are removed, unless they are being compressed
+	oldTime := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(rotated[0], oldTime, oldTime)
+	recp.compressing = map[string]bool{strings.TrimSuffix(rotated[0], ".gz"): true}
+	recp.housekeeping()
+	_, err = os.Stat(rotated[0])
+	assert.Nil(t, err)
+	recp.compressing = nil
+	recp.housekeeping()
+	_, err = os.Stat(rotated[0])
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func startTrapListener(t *testing.T, params *gosnmp.GoSNMP) (*gosnmp.TrapListener, string, chan *gosnmp.SnmpPacket) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	traps := make(chan *gosnmp.SnmpPacket, 1)
+	tl := gosnmp.NewTrapListener()
+	tl.Params = params
+	tl.OnNewTrap = func(p *gosnmp.SnmpPacket, _ *net.UDPAddr) { traps <- p }
+	errCh := make(chan error, 1)
+	go func() { errCh <- tl.Listen(addr) }()
+	select {
+	case <-tl.Listening():
+	case err := <-errCh:
+		t.Fatal(err)
+	}
+	return tl, addr, traps
+}
+
+func TestOutputSnmpTrap(t *testing.T) {
+	n := &SnmpTrapNotifier{EnterpriseOid: "1.3.6.1.4.1.64000", started: time.Now().Add(-10 * time.Second)}
+	opts := &plugins.Options{ClientTimeout: 2 * time.Second}
+	alert := tu.MockAlert(9, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "t1", "1", "CRITICAL", []string{}, models.Labels{})
+	event := &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert}
+	recvTrap := func(traps chan *gosnmp.SnmpPacket) map[string]gosnmp.SnmpPDU {
+		select {
+		case p := <-traps:
+			vars := make(map[string]gosnmp.SnmpPDU)
+			for _, v := range p.Variables {
+				vars[v.Name] = v
+			}
+			return vars
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for trap")
+		}
+		return nil
+	}
+
+	// v2c
+	tl, addr, traps := startTrapListener(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "am", Timeout: 2 * time.Second})
+	defer tl.Close()
+	n.Recipients = map[string]*SnmpTrapRecipient{
+		"default": &SnmpTrapRecipient{Target: addr, Community: "am", EventTypes: []string{"active", "ackd", "cleared"}},
+	}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	vars := recvTrap(traps)
+	assert.Equal(t, gosnmp.TimeTicks, vars[".1.3.6.1.2.1.1.3.0"].Type)
+	assert.True(t, vars[".1.3.6.1.2.1.1.3.0"].Value.(uint32) >= 1000)
+	assert.Equal(t, ".1.3.6.1.4.1.64000.0.1", vars[".1.3.6.1.6.3.1.1.4.1.0"].Value)
+	assert.Equal(t, uint(9), vars[".1.3.6.1.4.1.64000.1.1.0"].Value)
+	assert.Equal(t, []byte("Neteng BGP Down"), vars[".1.3.6.1.4.1.64000.1.2.0"].Value)
+	assert.Equal(t, []byte("dev1"), vars[".1.3.6.1.4.1.64000.1.3.0"].Value)
+	assert.Equal(t, 1, vars[".1.3.6.1.4.1.64000.1.5.0"].Value)
+	assert.Equal(t, 1, vars[".1.3.6.1.4.1.64000.1.6.0"].Value)
+	assert.Equal(t, []byte("Peer down"), vars[".1.3.6.1.4.1.64000.1.7.0"].Value)
+	_, ok := vars[".1.3.6.1.4.1.64000.1.8.0"]
+	assert.False(t, ok)
+
+	// filtered event types are not sent
+	event.Type = models.EventType_ESCALATED
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	event.Type = models.EventType_ACKD
+	alert.Owner = sql.NullString{String: "foo", Valid: true}
+	n.send(&plugins.SendRequest{Name: "default", Event: event}, opts)
+	vars = recvTrap(traps)
+	assert.Equal(t, ".1.3.6.1.4.1.64000.0.3", vars[".1.3.6.1.6.3.1.1.4.1.0"].Value)
+	assert.Equal(t, []byte("foo"), vars[".1.3.6.1.4.1.64000.1.8.0"].Value)
+
+	// v3 authPriv with a custom enterprise oid
+	engineId := "800000000102030405"
+	id, _ := hex.DecodeString(engineId)
+	tl3, addr3, traps3 := startTrapListener(t, &gosnmp.GoSNMP{
+		Version:       gosnmp.Version3,
+		Timeout:       2 * time.Second,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.AuthPriv,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 "am",
+			AuthenticationProtocol:   gosnmp.SHA,
+			AuthenticationPassphrase: "authpass123",
+			PrivacyProtocol:          gosnmp.AES,
+			PrivacyPassphrase:        "privpass123",
+			AuthoritativeEngineID:    string(id),
+		},
+	})
+	defer tl3.Close()
+	n.EnterpriseOid = "1.3.6.1.4.1.99999"
+	n.Recipients = map[string]*SnmpTrapRecipient{
+		"v3": &SnmpTrapRecipient{
+			Target:         addr3,
+			Version:        "3",
+			Username:       "am",
+			AuthProtocol:   "sha",
+			AuthPassphrase: "authpass123",
+			PrivProtocol:   "aes",
+			PrivPassphrase: "privpass123",
+			EngineId:       engineId,
+		},
+	}
+	if err := n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	event.Type = models.EventType_CLEARED
+	n.send(&plugins.SendRequest{Name: "v3", Event: event}, opts)
+	vars = recvTrap(traps3)
+	assert.Equal(t, ".1.3.6.1.4.1.99999.0.2", vars[".1.3.6.1.6.3.1.1.4.1.0"].Value)
+	assert.Equal(t, []byte("Neteng BGP Down"), vars[".1.3.6.1.4.1.99999.1.2.0"].Value)
+
+	// the default engine id is derived from the enterprise number
+	assert.Equal(t, "\x80\x01\x86\x9f\x04alert_manager", n.Recipients["v3"].defaultEngineId)
+
+	// the enterprise oid must be under a private enterprise number other than the
+	// documentation one
+	for _, oid := range []string{"", "1.3.6.1.2.1", "1.3.6.1.4.1.x", "1.3.6.1.4.1.32473", ".1.3.6.1.4.1.32473.1"} {
+		assert.NotNil(t, (&SnmpTrapNotifier{EnterpriseOid: oid}).Init(), oid)
+	}
+
+	// priv without auth is rejected
+	_, _, err := (&SnmpTrapRecipient{Username: "am", PrivProtocol: "aes"}).usmParams()
+	assert.NotNil(t, err)
+}
+
+type fakeAmqpMsg struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+type fakeAmqpSession struct {
+	published chan fakeAmqpMsg
+	closed    chan *amqp.Error
+	fail      bool
+}
+
+func (s *fakeAmqpSession) Publish(exchange, key string, msg amqp.Publishing) error {
+	if s.fail {
+		return fmt.Errorf("nacked")
+	}
+	s.published <- fakeAmqpMsg{exchange: exchange, key: key, msg: msg}
+	return nil
+}
+
+func (s *fakeAmqpSession) NotifyClose() chan *amqp.Error {
+	return s.closed
+}
+
+func (s *fakeAmqpSession) Close() error {
+	return nil
+}
+
+func TestOutputAmqp(t *testing.T) {
+	published := make(chan fakeAmqpMsg, 10)
+	dials := make(chan *fakeAmqpSession)
+	p := &Publisher{
+		AmqpRoutingKey: "{{.Team}}.{{.Severity}}.{{.Type}}",
+		Exchange:       "am",
+		ConnectRetry:   10 * time.Millisecond,
+		BufferSize:     2,
+		Notif:          make(chan *plugins.SendRequest),
+	}
+	p.dial = func() (amqpSession, error) {
+		select {
+		case s := <-dials:
+			return s, nil
+		default:
+			return nil, fmt.Errorf("connection refused")
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Start(ctx, &plugins.Options{})
+	alert := tu.MockAlert(1, "Neteng BGP Down", "Peer down", "dev1", "PeerX", "src", "scp", "neteng", "1", "CRITICAL", []string{}, nil)
+	send := func(eventType models.EventType) {
+		p.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: eventType, Alert: alert}}
+	}
+	recv := func() fakeAmqpMsg {
+		select {
+		case m := <-published:
+			return m
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for publish")
+		}
+		return fakeAmqpMsg{}
+	}
+
+	// events are buffered while disconnected, dropping the oldest when full
+	send(models.EventType_ACTIVE)
+	send(models.EventType_ACKD)
+	send(models.EventType_ESCALATED)
+	session := &fakeAmqpSession{published: published, closed: make(chan *amqp.Error, 1)}
+	dials <- session
+	m := recv()
+	assert.Equal(t, "am", m.exchange)
+	assert.Equal(t, "neteng.CRITICAL.ACKD", m.key)
+	assert.Equal(t, amqp.Persistent, m.msg.DeliveryMode)
+	assert.Equal(t, "ACKD", m.msg.Type)
+	assert.NotEmpty(t, m.msg.MessageId)
+	incident := &Incident{}
+	if err := json.Unmarshal(m.msg.Body, incident); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ACKD", incident.Type)
+	assert.Equal(t, int64(1), incident.Id)
+	assert.Equal(t, "neteng.CRITICAL.ESCALATED", recv().key)
+
+	// all event types are published once connected
+	send(models.EventType_EXPIRED)
+	assert.Equal(t, "neteng.CRITICAL.EXPIRED", recv().key)
+
+	// reconnect after the connection is closed and publish buffered events
+	session.closed <- amqp.ErrClosed
+	send(models.EventType_CLEARED)
+	dials <- &fakeAmqpSession{published: published, closed: make(chan *amqp.Error, 1)}
+	assert.Equal(t, "neteng.CRITICAL.CLEARED", recv().key)
+}
+
+type mockActioner struct {
+	alerts map[int64]*models.Alert
+	owners map[int64]string
+	clears []int64
+}
+
+func (a *mockActioner) GetExisting(tx models.Txn, alert *models.Alert) (*models.Alert, error) {
+	if existing, ok := a.alerts[alert.Id]; ok {
+		return existing, nil
+	}
+	return nil, fmt.Errorf("Alert %d not found", alert.Id)
+}
+
+func (a *mockActioner) SetOwner(ctx context.Context, tx models.Txn, alert *models.Alert, name, teamName string, notify bool) error {
+	if notify {
+		return fmt.Errorf("Unexpected notify")
+	}
+	alert.SetOwner(name, teamName)
+	a.owners[alert.Id] = name
+	return nil
+}
+
+func (a *mockActioner) Clear(ctx context.Context, tx models.Txn, alert *models.Alert, notify bool) error {
+	if notify {
+		return fmt.Errorf("Unexpected notify")
+	}
+	alert.Clear()
+	a.clears = append(a.clears, alert.Id)
+	return nil
+}
+
+func TestOutputVictorOpsSync(t *testing.T) {
+	var (
+		posted    []*victorOpsMsg
+		incidents []map[string]interface{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api-public/v1/incidents":
+			if r.Header.Get("X-VO-Api-Id") != "id" || r.Header.Get("X-VO-Api-Key") != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"incidents": incidents})
+		case "/rest/routing":
+			m := &victorOpsMsg{}
+			json.NewDecoder(r.Body).Decode(m)
+			posted = append(posted, m)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	n := &VictorOpsNotifier{
+		ApiUrl:       ts.URL,
+		ApiKey:       "rest",
+		Sync:         true,
+		PublicApiUrl: ts.URL,
+		ApiId:        "id",
+		PublicApiKey: "key",
+		Recipients: map[string]*VoRecipient{
+			"default": &VoRecipient{RoutingKey: "routing"},
+		},
+		Notif: make(chan *plugins.SendRequest),
+	}
+	a1 := tu.MockAlert(1, "Neteng BGP Down", "Peer down", "dev1", "2001:db8::1", "src", "scp", "t1", "1", "WARN", []string{}, nil)
+	a2 := tu.MockAlert(2, "Neteng BGP Down", "Peer down", "dev2", "2001:db8::2", "src", "scp", "t1", "1", "WARN", []string{}, nil)
+	actioner := &mockActioner{alerts: map[int64]*models.Alert{1: a1, 2: a2}, owners: make(map[int64]string)}
+	db := &mockDb{}
+	opts := &plugins.Options{ClientTimeout: 2 * time.Second, Db: db, Actioner: actioner}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Start(ctx, opts)
+
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: a1}}
+	// clears are not sent without auto_resolve, this waits for the active event to be handled
+	n.Notif <- &plugins.SendRequest{Name: "default", Event: &models.AlertEvent{Type: models.EventType_CLEARED, Alert: a2}}
+	assert.Equal(t, len(posted), 1)
+	assert.Equal(t, posted[0].EntityID, "Neteng BGP Down:dev1:2001:db8::1")
+	assert.Equal(t, db.messages["victorops"].AlertId, int64(1))
+
+	// acked in victorops
+	incidents = []map[string]interface{}{
+		{
+			"incidentNumber": "100",
+			"currentPhase":   "ACKED",
+			"entityId":       "Neteng BGP Down:dev1:2001:db8::1",
+			"transitions": []map[string]interface{}{
+				{"name": "ACKED", "by": "oncall1"},
+			},
+		},
+		// unknown incidents are ignored
+		{"incidentNumber": "101", "currentPhase": "RESOLVED", "entityId": "Neteng BGP Down:dev2:2001:db8::2"},
+	}
+	n.sync(ctx, opts)
+	assert.Equal(t, actioner.owners[1], "oncall1")
+	assert.Equal(t, a1.Owner.String, "oncall1")
+	assert.Equal(t, len(actioner.clears), 0)
+
+	// already owned alerts are not acked again, resolved incidents clear the alert
+	incidents[0]["transitions"] = []map[string]interface{}{{"name": "ACKED", "by": "oncall2"}}
+	n.sync(ctx, opts)
+	assert.Equal(t, actioner.owners[1], "oncall1")
+	incidents[0]["currentPhase"] = "RESOLVED"
+	n.sync(ctx, opts)
+	assert.Equal(t, actioner.clears, []int64{1})
+	assert.Equal(t, a1.Status, models.Status_CLEARED)
+
+	// cleared alerts are not cleared again
+	n.sync(ctx, opts)
+	assert.Equal(t, actioner.clears, []int64{1})
 }
@@ -0,0 +1,219 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	pdDefaultApiUrl = "https://events.pagerduty.com"
+	pdMaxSummaryLen = 1024
+)
+
+var pdSevMap = map[models.AlertSeverity]string{
+	models.Sev_CRITICAL: "critical",
+	models.Sev_MAJOR:    "error",
+	models.Sev_WARN:     "warning",
+	models.Sev_INFO:     "info",
+}
+
+type PdRecipient struct {
+	RoutingKey  string `mapstructure:"routing_key"`
+	AutoResolve bool   `mapstructure:"auto_resolve"`
+	SendAck     bool   `mapstructure:"send_ack"`
+	// DedupBy is either "id" (default) or "fingerprint"
+	DedupBy string `mapstructure:"dedup_by"`
+}
+
+type pdPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type pdLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerDutyMsg struct {
+	RoutingKey  string     `json:"routing_key"`
+	EventAction string     `json:"event_action"`
+	DedupKey    string     `json:"dedup_key"`
+	Payload     *pdPayload `json:"payload,omitempty"`
+	Client      string     `json:"client,omitempty"`
+	ClientUrl   string     `json:"client_url,omitempty"`
+	Links       []pdLink   `json:"links,omitempty"`
+}
+
+type PagerDutyNotifier struct {
+	ApiUrl     string `mapstructure:"api_url"`
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*PdRecipient
+}
+
+func (n *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// fingerprint uniquely identifies an alert by its Name:Device:Entity
+func fingerprint(alert *models.Alert) string {
+	return fmt.Sprintf("%s:%s:%s", alert.Name, alert.Device.String, alert.Entity)
+}
+
+// truncate cuts s to at most max bytes without splitting a multi-byte character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func (n *PagerDutyNotifier) dedupKey(recp *PdRecipient, alert *models.Alert) string {
+	if recp.DedupBy == "fingerprint" || alert.Id == 0 {
+		return fingerprint(alert)
+	}
+	return fmt.Sprintf("alert_manager:%d", alert.Id)
+}
+
+func (n *PagerDutyNotifier) formatBody(recp *PdRecipient, event *models.AlertEvent, weburl string) ([]byte, error) {
+	alert := event.Alert
+	m := &pagerDutyMsg{
+		RoutingKey: recp.RoutingKey,
+		DedupKey:   n.dedupKey(recp, alert),
+	}
+	switch event.Type {
+	case models.EventType_ACTIVE, models.EventType_ESCALATED:
+		m.EventAction = "trigger"
+	case models.EventType_CLEARED, models.EventType_EXPIRED:
+		m.EventAction = "resolve"
+	case models.EventType_ACKD:
+		m.EventAction = "acknowledge"
+	default:
+		return nil, fmt.Errorf("Unsupported event type %s", event.Type.String())
+	}
+	// only trigger events need a payload
+	if m.EventAction != "trigger" {
+		return json.Marshal(m)
+	}
+	summary := truncate(fmt.Sprintf("[%s] %s: %s", alert.Severity.String(), alert.Name, alert.Description), pdMaxSummaryLen)
+	source := alert.Source
+	if alert.Device.Valid {
+		source = alert.Device.String
+	}
+	sev, ok := pdSevMap[alert.Severity]
+	if !ok {
+		sev = "info"
+	}
+	details := make(map[string]interface{})
+	for k, v := range alert.Labels {
+		details[k] = v
+	}
+	details["alert_id"] = alert.Id
+	url := weburl + fmt.Sprintf("/%d", alert.Id)
+	m.Payload = &pdPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      sev,
+		Timestamp:     alert.StartTime.UTC().Format(time.RFC3339),
+		Component:     alert.Entity,
+		Group:         alert.Team,
+		Class:         alert.Scope,
+		CustomDetails: details,
+	}
+	m.Client = "Alert Manager"
+	m.ClientUrl = url
+	m.Links = []pdLink{{Href: url, Text: "Alert Manager"}}
+	return json.Marshal(m)
+}
+
+func (n *PagerDutyNotifier) post(data []byte, timeout time.Duration) error {
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	apiUrl := n.ApiUrl
+	if apiUrl == "" {
+		apiUrl = pdDefaultApiUrl
+	}
+	resp, err := c.Post(apiUrl+"/v2/enqueue", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (n *PagerDutyNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	event := req.Event
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	if (event.Type == models.EventType_CLEARED || event.Type == models.EventType_EXPIRED) && !recp.AutoResolve {
+		return
+	}
+	if event.Type == models.EventType_ACKD && !recp.SendAck {
+		return
+	}
+	if event.Type == models.EventType_SUPPRESSED {
+		return
+	}
+	body, err := n.formatBody(recp, event, opts.WebUrl)
+	if err != nil {
+		glog.Errorf("Output: Pagerduty: Cant get json body for alert: %v", err)
+		span.SetError(err)
+		return
+	}
+	if err := n.post(body, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to post to pagerduty: %v", err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+}
+
+func (n *PagerDutyNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req, opts)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func init() {
+	n := &PagerDutyNotifier{Notif: make(chan *plugins.SendRequest)}
+	plugins.AddOutput(n, n.Notif)
+}
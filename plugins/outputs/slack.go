@@ -7,23 +7,52 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/slack"
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
+const slackDefaultApiUrl = "https://slack.com/api"
+
 type SlackRecipient struct {
 	Channel string
 	Upload  bool
-	Token   string
+	// Token is a bot token used to post via the web api instead of the webhook url.
+	// Later events of an alert are then posted as replies in the thread of its first message.
+	Token string
+	// Action is a comma separated list of buttons (ack, suppress, clear) added to
+	// messages posted with a token. All buttons are added if empty, none if "none".
 	Action  string
 	Mention string
 }
 
+// actions returns the action ids of the buttons configured for the recipient
+func (r *SlackRecipient) actions() []string {
+	action := strings.TrimSpace(r.Action)
+	if action == "" {
+		action = "ack,suppress,clear"
+	}
+	var actions []string
+	for _, a := range strings.Split(action, ",") {
+		switch strings.TrimSpace(strings.ToLower(a)) {
+		case "ack":
+			actions = append(actions, slack.ActionAck)
+		case "suppress":
+			actions = append(actions, slack.ActionSuppress1h, slack.ActionSuppress4h)
+		case "clear":
+			actions = append(actions, slack.ActionClear)
+		}
+	}
+	return actions
+}
+
 type SlackNotifier struct {
 	Url        string
+	ApiUrl     string `mapstructure:"api_url"`
 	Recipients map[string]*SlackRecipient
 	Notif      chan *plugins.SendRequest
 
@@ -87,40 +116,199 @@ func (n *SlackNotifier) formatBody(req *plugins.SendRequest, weburl string) ([]b
 	return json.Marshal(&body)
 }
 
-func (n *SlackNotifier) post(data []byte, timeout time.Duration) {
+func (n *SlackNotifier) post(data []byte, timeout time.Duration) error {
 	c := &http.Client{
 		Timeout: timeout,
 	}
 	resp, err := c.Post(n.Url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		//n.statsPostError.Add(1)
-		glog.Errorf("Output: Unable to post to slack: %v", err)
-		return
+		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		//n.statsPostError.Add(1)
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			body = []byte{}
 		}
-		glog.Errorf("Output: Unable to post to slack: Got HTTP %d: %v", resp.StatusCode, string(body))
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
 	}
 	//n.statPostsSent.Add(1)
+	return nil
+}
+
+type slackApiResponse struct {
+	Ok      bool
+	Error   string
+	Channel string
+	Ts      string
+}
+
+// callApi calls the slack web api method with the bot token
+func (n *SlackNotifier) callApi(method, token string, body interface{}, timeout time.Duration) (*slackApiResponse, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	apiUrl := n.ApiUrl
+	if apiUrl == "" {
+		apiUrl = slackDefaultApiUrl
+	}
+	req, err := http.NewRequest("POST", apiUrl+"/"+method, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result := &slackApiResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, err)
+	}
+	if !result.Ok {
+		return nil, fmt.Errorf("%s failed: %s", method, result.Error)
+	}
+	return result, nil
+}
+
+// rootMessage returns the message that is posted for the alert and updated on later events
+func (n *SlackNotifier) rootMessage(recipient *SlackRecipient, alert *models.Alert, weburl, text string) map[string]interface{} {
+	return slack.Message(alert, weburl, strings.TrimSpace(text), "", recipient.actions())
+}
+
+// replyText returns the text of the threaded reply posted for later events of an alert
+func (n *SlackNotifier) replyText(recipient *SlackRecipient, event *models.AlertEvent) string {
+	alert := event.Alert
+	switch event.Type {
+	case models.EventType_ACTIVE:
+		return strings.TrimSpace(fmt.Sprintf("%s Reminder: alert is still active", recipient.Mention))
+	case models.EventType_ESCALATED:
+		return strings.TrimSpace(fmt.Sprintf("%s Escalated to %s", recipient.Mention, alert.Severity.String()))
+	case models.EventType_ACKD:
+		return fmt.Sprintf("Acknowledged by %s", alert.Owner.String)
+	case models.EventType_CLEARED:
+		return "Cleared"
+	case models.EventType_EXPIRED:
+		return "Expired"
+	case models.EventType_SUPPRESSED:
+		return "Suppressed"
+	}
+	return event.Type.String()
+}
+
+func (n *SlackNotifier) getMessage(db models.Dbase, alertId int64, output string) (*models.OutputMessage, error) {
+	var msg *models.OutputMessage
+	err := models.WithTx(context.Background(), db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		var er error
+		msg, er = models.GetOutputMessage(tx, alertId, output)
+		return er
+	})
+	return msg, err
+}
+
+func (n *SlackNotifier) saveMessage(db models.Dbase, msg *models.OutputMessage) error {
+	return models.WithTx(context.Background(), db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		return models.SaveOutputMessage(tx, msg)
+	})
+}
+
+// sendApi posts the first event of an alert as a new message using the bot token. Later events
+// update the color and title of that message and are posted as replies in its thread.
+func (n *SlackNotifier) sendApi(recipient *SlackRecipient, req *plugins.SendRequest, opts *plugins.Options) error {
+	event := req.Event
+	alert := event.Alert
+	output := n.Name() + "." + req.Name
+	var root *models.OutputMessage
+	// alerts without an id cannot be threaded
+	if opts.Db != nil && alert.Id > 0 {
+		var err error
+		if root, err = n.getMessage(opts.Db, alert.Id, output); err != nil {
+			glog.V(2).Infof("Output: Slack: Unable to get message for alert %d: %v", alert.Id, err)
+		}
+	}
+	if root == nil {
+		if event.Type == models.EventType_ACKD {
+			return nil
+		}
+		text := recipient.Mention
+		// dont send message on clear
+		if event.Type != models.EventType_CLEARED {
+			text += " " + alert.Description
+		}
+		body := n.rootMessage(recipient, alert, opts.WebUrl, text)
+		body["channel"] = recipient.Channel
+		resp, err := n.callApi("chat.postMessage", recipient.Token, body, opts.ClientTimeout)
+		if err != nil {
+			return err
+		}
+		if opts.Db == nil || alert.Id == 0 {
+			return nil
+		}
+		return n.saveMessage(opts.Db, &models.OutputMessage{
+			AlertId: alert.Id, Output: output, Channel: resp.Channel, MessageId: resp.Ts,
+		})
+	}
+	update := n.rootMessage(recipient, alert, opts.WebUrl, alert.Description)
+	update["channel"] = root.Channel
+	update["ts"] = root.MessageId
+	if _, err := n.callApi("chat.update", recipient.Token, update, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to update slack message for alert %d: %v", alert.Id, err)
+	}
+	reply := map[string]interface{}{
+		"channel":   root.Channel,
+		"thread_ts": root.MessageId,
+		"text":      n.replyText(recipient, event),
+	}
+	// escalations are also shown in the channel
+	if event.Type == models.EventType_ESCALATED {
+		reply["reply_broadcast"] = true
+	}
+	_, err := n.callApi("chat.postMessage", recipient.Token, reply, opts.ClientTimeout)
+	return err
+}
+
+func (n *SlackNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	if recipient, ok := n.Recipients[req.Name]; ok && recipient.Token != "" {
+		if err := n.sendApi(recipient, req, opts); err != nil {
+			glog.Errorf("Output: Unable to post to slack: %v", err)
+			span.SetError(err)
+			return
+		}
+		req.Sent(n.Name())
+		return
+	}
+	if req.Event.Type == models.EventType_ACKD {
+		return
+	}
+	body, err := n.formatBody(req, opts.WebUrl)
+	if err != nil {
+		glog.Errorf("Output: Slack: Cant get json body for alert %s: %v", req.Event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	if err := n.post(body, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to post to slack: %v", err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
 }
 
 func (n *SlackNotifier) Start(ctx context.Context, opts *plugins.Options) {
 	for {
 		select {
 		case req := <-n.Notif:
-			if req.Event.Type == models.EventType_ACKD {
-				break
-			}
-			body, err := n.formatBody(req, opts.WebUrl)
-			if err != nil {
-				glog.Errorf("Output: Slack: Cant get json body for alert %s: %v", req.Event.Alert.Name, err)
-				break
-			}
-			n.post(body, opts.ClientTimeout)
+			n.send(req, opts)
 		case <-ctx.Done():
 			return
 		}
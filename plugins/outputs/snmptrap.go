@@ -0,0 +1,338 @@
+package output
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gosnmp/gosnmp"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	snmpDefaultPort       = 162
+	snmpEnterprisesOid    = "1.3.6.1.4.1"
+	snmpSysUpTimeOid      = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOid           = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpMaxDescriptionLen = 1024
+	// snmpDocEnterpriseNumber is reserved for documentation (RFC 5612)
+	snmpDocEnterpriseNumber = 32473
+)
+
+// notifications under amNotifications
+const (
+	snmpTrapRaise = 1
+	snmpTrapClear = 2
+	snmpTrapAck   = 3
+)
+
+// objects under amObjects
+const (
+	snmpObjId = iota + 1
+	snmpObjName
+	snmpObjDevice
+	snmpObjEntity
+	snmpObjSeverity
+	snmpObjStatus
+	snmpObjDescription
+	snmpObjOwner
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// snmpEngineId returns the engine id of the enterprise as per RFC 3411: the enterprise
+// number with the high bit set, followed by the text format (4) and "alert_manager"
+func snmpEngineId(pen uint32) string {
+	id := make([]byte, 5)
+	binary.BigEndian.PutUint32(id, pen|0x80000000)
+	id[4] = 4
+	return string(append(id, "alert_manager"...))
+}
+
+type SnmpTrapRecipient struct {
+	// Target is the host:port of the trap receiver, port defaults to 162
+	Target string
+	// Version is either 2c (default) or 3
+	Version    string
+	Community  string
+	EventTypes []string `mapstructure:"event_types"`
+	// v3 USM params. The security level is derived from the configured protocols.
+	Username       string
+	AuthProtocol   string `mapstructure:"auth_protocol"`
+	AuthPassphrase string `mapstructure:"auth_passphrase"`
+	PrivProtocol   string `mapstructure:"priv_protocol"`
+	PrivPassphrase string `mapstructure:"priv_passphrase"`
+	// EngineId is the hex encoded authoritative engine id used for v3 traps, defaults to
+	// an id derived from the enterprise number of the enterprise oid
+	EngineId string `mapstructure:"engine_id"`
+
+	defaultEngineId string
+	client          *gosnmp.GoSNMP
+	sync.Mutex
+}
+
+func (r *SnmpTrapRecipient) usmParams() (*gosnmp.UsmSecurityParameters, gosnmp.SnmpV3MsgFlags, error) {
+	if r.Username == "" {
+		return nil, 0, fmt.Errorf("Username is required for SNMPv3")
+	}
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:                 r.Username,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		PrivacyProtocol:          gosnmp.NoPriv,
+		AuthoritativeEngineID:    r.defaultEngineId,
+		AuthoritativeEngineBoots: 1,
+	}
+	if r.EngineId != "" {
+		id, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(r.EngineId), "0x"))
+		if err != nil {
+			return nil, 0, fmt.Errorf("Invalid engine id %s: %v", r.EngineId, err)
+		}
+		sp.AuthoritativeEngineID = string(id)
+	}
+	flags := gosnmp.NoAuthNoPriv
+	if r.AuthProtocol != "" {
+		auth, ok := snmpAuthProtocols[strings.ToUpper(r.AuthProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("Unsupported auth protocol: %s", r.AuthProtocol)
+		}
+		sp.AuthenticationProtocol = auth
+		sp.AuthenticationPassphrase = r.AuthPassphrase
+		flags = gosnmp.AuthNoPriv
+	}
+	if r.PrivProtocol != "" {
+		if flags != gosnmp.AuthNoPriv {
+			return nil, 0, fmt.Errorf("Privacy requires an auth protocol")
+		}
+		priv, ok := snmpPrivProtocols[strings.ToUpper(r.PrivProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("Unsupported priv protocol: %s", r.PrivProtocol)
+		}
+		sp.PrivacyProtocol = priv
+		sp.PrivacyPassphrase = r.PrivPassphrase
+		flags = gosnmp.AuthPriv
+	}
+	if sp.AuthoritativeEngineID == "" {
+		return nil, 0, fmt.Errorf("Engine id is required for SNMPv3")
+	}
+	return sp, flags, nil
+}
+
+func (r *SnmpTrapRecipient) connect(timeout time.Duration) error {
+	host, portStr, err := net.SplitHostPort(r.Target)
+	port := snmpDefaultPort
+	if err != nil {
+		host = r.Target
+	} else if port, err = strconv.Atoi(portStr); err != nil {
+		return fmt.Errorf("Invalid port in target %s", r.Target)
+	}
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(port),
+		Community: r.Community,
+		Timeout:   timeout,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	switch r.Version {
+	case "", "2c":
+		client.Version = gosnmp.Version2c
+		if client.Community == "" {
+			client.Community = "public"
+		}
+	case "3":
+		sp, flags, err := r.usmParams()
+		if err != nil {
+			return err
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.SecurityParameters = sp
+		client.MsgFlags = flags
+	default:
+		return fmt.Errorf("Unsupported snmp version: %s", r.Version)
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	r.client = client
+	return nil
+}
+
+func (r *SnmpTrapRecipient) close() {
+	if r.client != nil && r.client.Conn != nil {
+		r.client.Conn.Close()
+	}
+	r.client = nil
+}
+
+// send sends the trap, reconnecting once if the existing connection has failed
+func (r *SnmpTrapRecipient) send(trap gosnmp.SnmpTrap, uptime time.Duration, timeout time.Duration) error {
+	r.Lock()
+	defer r.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if r.client == nil {
+			if err = r.connect(timeout); err != nil {
+				continue
+			}
+		}
+		if sp, ok := r.client.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+			sp.AuthoritativeEngineTime = uint32(uptime.Seconds())
+		}
+		if _, err = r.client.SendTrap(trap); err == nil {
+			return nil
+		}
+		glog.V(2).Infof("Output: SnmpTrap: Send to %s failed, reconnecting: %v", r.Target, err)
+		r.close()
+	}
+	return err
+}
+
+type SnmpTrapNotifier struct {
+	// EnterpriseOid is the root of the notifications and objects, required. It is the root
+	// of the ALERT-MANAGER-MIB re-rooted under the private enterprise number of the operator.
+	EnterpriseOid string `mapstructure:"enterprise_oid"`
+	Notif         chan *plugins.SendRequest
+	Recipients    map[string]*SnmpTrapRecipient
+	started       time.Time
+}
+
+// Init checks that the enterprise oid is under a private enterprise number and derives the
+// default v3 engine id of the recipients from it
+func (n *SnmpTrapNotifier) Init() error {
+	root := strings.TrimPrefix(n.EnterpriseOid, ".")
+	if root == "" {
+		return fmt.Errorf("Snmptrap: enterprise_oid is required")
+	}
+	if !strings.HasPrefix(root, snmpEnterprisesOid+".") {
+		return fmt.Errorf("Snmptrap: enterprise_oid %s is not under enterprises (%s)", n.EnterpriseOid, snmpEnterprisesOid)
+	}
+	number := strings.SplitN(strings.TrimPrefix(root, snmpEnterprisesOid+"."), ".", 2)[0]
+	pen, err := strconv.ParseUint(number, 10, 31)
+	if err != nil || pen == 0 {
+		return fmt.Errorf("Snmptrap: invalid enterprise number %s in enterprise_oid", number)
+	}
+	if pen == snmpDocEnterpriseNumber {
+		return fmt.Errorf("Snmptrap: enterprise number %d is reserved for documentation, use your own", pen)
+	}
+	for _, r := range n.Recipients {
+		r.defaultEngineId = snmpEngineId(uint32(pen))
+	}
+	return nil
+}
+
+func (n *SnmpTrapNotifier) Name() string {
+	return "snmptrap"
+}
+
+func (n *SnmpTrapNotifier) oid(parts ...int) string {
+	oid := strings.TrimPrefix(n.EnterpriseOid, ".")
+	for _, p := range parts {
+		oid += fmt.Sprintf(".%d", p)
+	}
+	return oid
+}
+
+func (n *SnmpTrapNotifier) trap(event *models.AlertEvent, uptime time.Duration) (gosnmp.SnmpTrap, error) {
+	alert := event.Alert
+	var notification int
+	switch event.Type {
+	case models.EventType_ACTIVE, models.EventType_ESCALATED:
+		notification = snmpTrapRaise
+	case models.EventType_CLEARED, models.EventType_EXPIRED:
+		notification = snmpTrapClear
+	case models.EventType_ACKD:
+		notification = snmpTrapAck
+	default:
+		return gosnmp.SnmpTrap{}, fmt.Errorf("Unsupported event type %s", event.Type.String())
+	}
+	desc := truncate(alert.Description, snmpMaxDescriptionLen)
+	vars := []gosnmp.SnmpPDU{
+		{Name: snmpSysUpTimeOid, Type: gosnmp.TimeTicks, Value: uint32(uptime / (10 * time.Millisecond))},
+		{Name: snmpTrapOid, Type: gosnmp.ObjectIdentifier, Value: n.oid(0, notification)},
+		{Name: n.oid(1, snmpObjId, 0), Type: gosnmp.Gauge32, Value: uint32(alert.Id)},
+		{Name: n.oid(1, snmpObjName, 0), Type: gosnmp.OctetString, Value: alert.Name},
+		{Name: n.oid(1, snmpObjDevice, 0), Type: gosnmp.OctetString, Value: alert.Device.String},
+		{Name: n.oid(1, snmpObjEntity, 0), Type: gosnmp.OctetString, Value: alert.Entity},
+		{Name: n.oid(1, snmpObjSeverity, 0), Type: gosnmp.Integer, Value: int(alert.Severity)},
+		{Name: n.oid(1, snmpObjStatus, 0), Type: gosnmp.Integer, Value: int(alert.Status)},
+		{Name: n.oid(1, snmpObjDescription, 0), Type: gosnmp.OctetString, Value: desc},
+	}
+	if notification == snmpTrapAck {
+		vars = append(vars, gosnmp.SnmpPDU{Name: n.oid(1, snmpObjOwner, 0), Type: gosnmp.OctetString, Value: alert.Owner.String})
+	}
+	return gosnmp.SnmpTrap{Variables: vars}, nil
+}
+
+func (n *SnmpTrapNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	if !wantsEvent(recp.EventTypes, req.Event.Type) || req.Event.Type == models.EventType_SUPPRESSED {
+		return
+	}
+	uptime := time.Since(n.started)
+	trap, err := n.trap(req.Event, uptime)
+	if err != nil {
+		glog.Errorf("Output: SnmpTrap: Cant get trap for alert %s: %v", req.Event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	if err := recp.send(trap, uptime, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to send trap to %s: %v", recp.Target, err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+}
+
+func (n *SnmpTrapNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	n.started = time.Now()
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req, opts)
+		case <-ctx.Done():
+			for _, r := range n.Recipients {
+				r.Lock()
+				r.close()
+				r.Unlock()
+			}
+			return
+		}
+	}
+}
+
+func init() {
+	n := &SnmpTrapNotifier{Notif: make(chan *plugins.SendRequest), started: time.Now()}
+	plugins.AddOutput(n, n.Notif)
+}
@@ -0,0 +1,309 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	syslogDefaultAppName  = "alert_manager"
+	syslogDefaultFacility = "local0"
+	syslogMaxUdpLen       = 2048
+	// syslogDocEnterpriseId is the enterprise number reserved for documentation (RFC 5612)
+	syslogDocEnterpriseId = 32473
+)
+
+var syslogFacilityMap = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSevMap maps alert severity to syslog severity
+var syslogSevMap = map[models.AlertSeverity]int{
+	models.Sev_CRITICAL: 2, // crit
+	models.Sev_MAJOR:    3, // err
+	models.Sev_WARN:     4, // warning
+	models.Sev_INFO:     6, // info
+}
+
+type SyslogRecipient struct {
+	// Addr is the host:port of the syslog server
+	Addr string
+	// Transport is one of udp (default), tcp or tls
+	Transport string
+	Facility  string
+	AppName   string `mapstructure:"app_name"`
+	// EnterpriseId is the IANA private enterprise number used in the structured data ids, required
+	EnterpriseId int `mapstructure:"enterprise_id"`
+	// Labels are the alert labels that are added as structured data
+	Labels             []string
+	CaFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+
+	conn net.Conn
+	sync.Mutex
+}
+
+func (r *SyslogRecipient) tlsConfig() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: r.InsecureSkipVerify}
+	if r.CaFile != "" {
+		ca, err := ioutil.ReadFile(r.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Unable to load CA certs from %s", r.CaFile)
+		}
+		c.RootCAs = pool
+	}
+	if r.CertFile != "" && r.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+func (r *SyslogRecipient) dial(timeout time.Duration) error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch r.Transport {
+	case "", "udp":
+		conn, err = net.DialTimeout("udp", r.Addr, timeout)
+	case "tcp":
+		conn, err = net.DialTimeout("tcp", r.Addr, timeout)
+	case "tls":
+		var config *tls.Config
+		if config, err = r.tlsConfig(); err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", r.Addr, config)
+	default:
+		return fmt.Errorf("Unsupported syslog transport: %s", r.Transport)
+	}
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	return nil
+}
+
+func (r *SyslogRecipient) close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+// frame applies octet counting framing (RFC 6587) for stream transports
+func (r *SyslogRecipient) frame(msg string) []byte {
+	if r.Transport == "tcp" || r.Transport == "tls" {
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+	return []byte(truncate(msg, syslogMaxUdpLen))
+}
+
+// write sends the message, reconnecting once if the existing connection has failed
+func (r *SyslogRecipient) write(msg string, timeout time.Duration) error {
+	r.Lock()
+	defer r.Unlock()
+	data := r.frame(msg)
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if r.conn == nil {
+			if err = r.dial(timeout); err != nil {
+				continue
+			}
+		}
+		r.conn.SetWriteDeadline(time.Now().Add(timeout))
+		if _, err = r.conn.Write(data); err == nil {
+			return nil
+		}
+		glog.V(2).Infof("Output: Syslog: Write to %s failed, reconnecting: %v", r.Addr, err)
+		r.close()
+	}
+	return err
+}
+
+type SyslogNotifier struct {
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*SyslogRecipient
+	hostname   string
+}
+
+// Init checks that each recipient has an enterprise number of its own
+func (n *SyslogNotifier) Init() error {
+	for name, recp := range n.Recipients {
+		switch {
+		case recp.EnterpriseId <= 0:
+			return fmt.Errorf("Syslog recipient %s: enterprise_id is required", name)
+		case recp.EnterpriseId == syslogDocEnterpriseId:
+			return fmt.Errorf("Syslog recipient %s: enterprise_id %d is reserved for documentation, use your own", name, recp.EnterpriseId)
+		}
+	}
+	return nil
+}
+
+func (n *SyslogNotifier) Name() string {
+	return "syslog"
+}
+
+// sdEscape escapes structured data param values as per RFC 5424 section 6.3.3
+func sdEscape(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	return r.Replace(value)
+}
+
+// sdName sanitizes a structured data param name as per RFC 5424 section 6.3.3
+func sdName(name string) string {
+	n := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	return truncate(n, 32)
+}
+
+func sdElement(id string, params [][2]string) string {
+	var b strings.Builder
+	b.WriteString("[" + id)
+	for _, p := range params {
+		fmt.Fprintf(&b, ` %s="%s"`, sdName(p[0]), sdEscape(p[1]))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// headerField returns the value or the nil value "-" if empty, truncated to max length
+func headerField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return '_'
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return truncate(value, max)
+}
+
+func (n *SyslogNotifier) format(recp *SyslogRecipient, event *models.AlertEvent, ts time.Time) (string, error) {
+	alert := event.Alert
+	facilityName := recp.Facility
+	if facilityName == "" {
+		facilityName = syslogDefaultFacility
+	}
+	facility, ok := syslogFacilityMap[strings.ToLower(facilityName)]
+	if !ok {
+		return "", fmt.Errorf("Invalid syslog facility: %s", facilityName)
+	}
+	sev, ok := syslogSevMap[alert.Severity]
+	if !ok {
+		sev = 5 // notice
+	}
+	appName := recp.AppName
+	if appName == "" {
+		appName = syslogDefaultAppName
+	}
+	pen := recp.EnterpriseId
+	sd := sdElement(fmt.Sprintf("alert@%d", pen), [][2]string{
+		{"id", fmt.Sprintf("%d", alert.Id)},
+		{"name", alert.Name},
+		{"device", alert.Device.String},
+		{"entity", alert.Entity},
+		{"severity", alert.Severity.String()},
+		{"status", alert.Status.String()},
+		{"team", alert.Team},
+		{"event", event.Type.String()},
+	})
+	var labels [][2]string
+	for _, l := range recp.Labels {
+		if v, ok := alert.Labels[l]; ok {
+			labels = append(labels, [2]string{l, fmt.Sprintf("%v", v)})
+		}
+	}
+	if len(labels) > 0 {
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+		sd += sdElement(fmt.Sprintf("labels@%d", pen), labels)
+	}
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		facility*8+sev,
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(n.hostname, 255),
+		headerField(appName, 48),
+		os.Getpid(),
+		headerField(event.Type.String(), 32),
+		sd,
+		alert.Description,
+	), nil
+}
+
+func (n *SyslogNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	msg, err := n.format(recp, req.Event, time.Now())
+	if err != nil {
+		glog.Errorf("Output: Syslog: Cant format message for alert %s: %v", req.Event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	if err := recp.write(msg, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to send to syslog %s: %v", recp.Addr, err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+}
+
+func (n *SyslogNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req, opts)
+		case <-ctx.Done():
+			for _, r := range n.Recipients {
+				r.Lock()
+				r.close()
+				r.Unlock()
+			}
+			return
+		}
+	}
+}
+
+func init() {
+	hostname, _ := os.Hostname()
+	n := &SyslogNotifier{Notif: make(chan *plugins.SendRequest), hostname: hostname}
+	plugins.AddOutput(n, n.Notif)
+}
@@ -0,0 +1,265 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	// max number of component alerts listed in an aggregate card
+	teamsMaxComponents = 25
+)
+
+// teamsStyleMap maps alert severity to an adaptive card container style
+var teamsStyleMap = map[models.AlertSeverity]string{
+	models.Sev_CRITICAL: "attention",
+	models.Sev_MAJOR:    "attention",
+	models.Sev_WARN:     "warning",
+	models.Sev_INFO:     "accent",
+}
+
+type TeamsRecipient struct {
+	Url     string
+	Mention string
+}
+
+type TeamsNotifier struct {
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*TeamsRecipient
+}
+
+func (n *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+type cardElement map[string]interface{}
+
+func textBlock(text string, extra cardElement) cardElement {
+	e := cardElement{"type": "TextBlock", "text": text, "wrap": true}
+	for k, v := range extra {
+		e[k] = v
+	}
+	return e
+}
+
+func factSet(facts [][2]string) cardElement {
+	var f []cardElement
+	for _, fact := range facts {
+		f = append(f, cardElement{"title": fact[0], "value": fact[1]})
+	}
+	return cardElement{"type": "FactSet", "facts": f}
+}
+
+func (n *TeamsNotifier) style(event *models.AlertEvent) string {
+	switch event.Type {
+	case models.EventType_CLEARED, models.EventType_EXPIRED:
+		return "good"
+	case models.EventType_ACKD, models.EventType_SUPPRESSED:
+		return "emphasis"
+	}
+	if s, ok := teamsStyleMap[event.Alert.Severity]; ok {
+		return s
+	}
+	return "default"
+}
+
+// components returns the component alerts of an aggregate alert
+func (n *TeamsNotifier) components(db models.Dbase, alert *models.Alert) (models.Alerts, error) {
+	if db == nil {
+		return nil, fmt.Errorf("No db available")
+	}
+	tx := db.NewTx()
+	var alerts models.Alerts
+	err := models.WithTx(context.Background(), tx, func(ctx context.Context, tx models.Txn) error {
+		var er error
+		alerts, er = tx.SelectAlerts(models.QuerySelectByAggId, alert.Id)
+		return er
+	})
+	return alerts, err
+}
+
+// cardBody returns the body of the card posted when an alert becomes active
+func (n *TeamsNotifier) cardBody(recipient *TeamsRecipient, event *models.AlertEvent, opts *plugins.Options) []cardElement {
+	alert := event.Alert
+	device := "None"
+	if alert.Device.Valid {
+		device = alert.Device.String
+	}
+	title := fmt.Sprintf("[%s][%s] %s", alert.Severity.String(), alert.Status.String(), alert.Name)
+	body := []cardElement{
+		{
+			"type":  "Container",
+			"style": n.style(event),
+			"bleed": true,
+			"items": []cardElement{
+				textBlock(title, cardElement{"size": "Large", "weight": "Bolder"}),
+			},
+		},
+	}
+	message := alert.Description
+	if recipient.Mention != "" {
+		message = recipient.Mention + " " + message
+	}
+	body = append(body, textBlock(message, nil))
+	body = append(body, factSet([][2]string{
+		{"AlertID", fmt.Sprintf("%d", alert.Id)},
+		{"Severity", alert.Severity.String()},
+		{"Status", alert.Status.String()},
+		{"Device", device},
+		{"Entity", alert.Entity},
+	}))
+	if alert.IsAggregate {
+		components, err := n.components(opts.Db, alert)
+		if err != nil {
+			glog.V(2).Infof("Output: Teams: Unable to get component alerts for %d: %v", alert.Id, err)
+		}
+		if len(components) > 0 {
+			body = append(body, textBlock("Component Alerts", cardElement{"weight": "Bolder"}))
+			var facts [][2]string
+			for i, c := range components {
+				if i == teamsMaxComponents {
+					facts = append(facts, [2]string{"...", fmt.Sprintf("%d more", len(components)-i)})
+					break
+				}
+				facts = append(facts, [2]string{
+					fmt.Sprintf("%d", c.Id),
+					fmt.Sprintf("[%s] %s: %s %s", c.Status.String(), c.Name, c.Device.String, c.Entity),
+				})
+			}
+			body = append(body, factSet(facts))
+		}
+	}
+	body = append(body, textBlock(fmt.Sprintf("%s via Alert Manager", alert.Source), cardElement{"isSubtle": true, "size": "Small"}))
+	return body
+}
+
+// updateBody returns the body of the follow-up card posted on alert lifecycle updates
+func (n *TeamsNotifier) updateBody(event *models.AlertEvent) []cardElement {
+	alert := event.Alert
+	var text string
+	switch event.Type {
+	case models.EventType_ACKD:
+		text = fmt.Sprintf("Acknowledged by %s", alert.Owner.String)
+	case models.EventType_ESCALATED:
+		text = fmt.Sprintf("Escalated to %s", alert.Severity.String())
+	case models.EventType_CLEARED:
+		text = "Cleared"
+	case models.EventType_EXPIRED:
+		text = "Expired"
+	case models.EventType_SUPPRESSED:
+		text = "Suppressed"
+	}
+	return []cardElement{
+		{
+			"type":  "Container",
+			"style": n.style(event),
+			"bleed": true,
+			"items": []cardElement{
+				textBlock(fmt.Sprintf("[%s] Alert %d: %s", event.Type.String(), alert.Id, alert.Name), cardElement{"weight": "Bolder"}),
+			},
+		},
+		textBlock(text, nil),
+	}
+}
+
+func (n *TeamsNotifier) formatBody(req *plugins.SendRequest, opts *plugins.Options) ([]byte, error) {
+	recipient, ok := n.Recipients[req.Name]
+	if !ok {
+		return []byte{}, fmt.Errorf("Failed to get recipient for output %s", req.Name)
+	}
+	event := req.Event
+	var body []cardElement
+	if event.Type == models.EventType_ACTIVE {
+		body = n.cardBody(recipient, event, opts)
+	} else {
+		body = n.updateBody(event)
+	}
+	card := map[string]interface{}{
+		"$schema": adaptiveCardSchema,
+		"type":    "AdaptiveCard",
+		"version": adaptiveCardVersion,
+		"msteams": map[string]interface{}{"width": "Full"},
+		"body":    body,
+		"actions": []cardElement{
+			{
+				"type":  "Action.OpenUrl",
+				"title": "View in Alert Manager",
+				"url":   opts.WebUrl + fmt.Sprintf("/%d", event.Alert.Id),
+			},
+		},
+	}
+	msg := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": adaptiveCardContentType,
+				"content":     card,
+			},
+		},
+	}
+	return json.Marshal(&msg)
+}
+
+func (n *TeamsNotifier) post(url string, data []byte, timeout time.Duration) error {
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := c.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (n *TeamsNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	body, err := n.formatBody(req, opts)
+	if err != nil {
+		glog.Errorf("Output: Teams: Cant get json body for alert %s: %v", req.Event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	if err := n.post(n.Recipients[req.Name].Url, body, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to post to teams: %v", err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+}
+
+func (n *TeamsNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(req, opts)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func init() {
+	n := &TeamsNotifier{Notif: make(chan *plugins.SendRequest)}
+	plugins.AddOutput(n, n.Notif)
+}
@@ -14,6 +14,11 @@ import (
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
+const (
+	voDefaultPublicApiUrl = "https://api.victorops.com"
+	voDefaultPollInterval = time.Minute
+)
+
 type VoRecipient struct {
 	RoutingKey  string `mapstructure:"routing_key"`
 	AutoResolve bool   `mapstructure:"auto_resolve"`
@@ -28,17 +33,56 @@ type victorOpsMsg struct {
 	StartTime         string `json:"state_start_time"`
 }
 
+// voIncident is the part of a victorops incident used to sync its state back to alerts
+type voIncident struct {
+	IncidentNumber string `json:"incidentNumber"`
+	CurrentPhase   string `json:"currentPhase"`
+	EntityId       string `json:"entityId"`
+	Transitions    []struct {
+		Name string `json:"name"`
+		By   string `json:"by"`
+	} `json:"transitions"`
+}
+
+// ackedBy returns the user that last acknowledged the incident
+func (i *voIncident) ackedBy() string {
+	var by string
+	for _, t := range i.Transitions {
+		if t.Name == "ACKED" {
+			by = t.By
+		}
+	}
+	return by
+}
+
 type VictorOpsNotifier struct {
 	ApiUrl     string `mapstructure:"api_url"`
 	ApiKey     string `mapstructure:"api_key"`
 	Notif      chan *plugins.SendRequest
 	Recipients map[string]*VoRecipient
+
+	// Sync polls the victorops public api for incidents acked or resolved in victorops and
+	// applies them to the matching alerts
+	Sync         bool          `mapstructure:"sync"`
+	PublicApiUrl string        `mapstructure:"public_api_url"`
+	ApiId        string        `mapstructure:"api_id"`
+	PublicApiKey string        `mapstructure:"public_api_key"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
 }
 
 func (n *VictorOpsNotifier) Name() string {
 	return "victorops"
 }
 
+// entityId returns the id of the victorops incident for the alert
+func (n *VictorOpsNotifier) entityId(alert *models.Alert) string {
+	var device string
+	if alert.Device.Valid {
+		device = alert.Device.String
+	}
+	return fmt.Sprintf("%s:%s:%s", alert.Name, device, alert.Entity)
+}
+
 func (n *VictorOpsNotifier) formatBody(event *models.AlertEvent, weburl string) ([]byte, error) {
 	m := &victorOpsMsg{}
 	switch event.Type {
@@ -55,7 +99,7 @@ func (n *VictorOpsNotifier) formatBody(event *models.AlertEvent, weburl string)
 		device = event.Alert.Device.String
 	}
 	stateMsg := fmt.Sprintf("AM Url: %s/%d", weburl, event.Alert.Id) + "\n" + event.Alert.Description
-	m.EntityID = fmt.Sprintf("%s:%s:%s", event.Alert.Name, device, event.Alert.Entity)
+	m.EntityID = n.entityId(event.Alert)
 	m.EntityDisplayName = fmt.Sprintf("[%s][%s] %s , Device: %s, Entity: %s",
 		event.Alert.Severity.String(), event.Alert.Status.String(), event.Alert.Name, device, event.Alert.Entity)
 	m.StateMessage = stateMsg
@@ -64,47 +108,173 @@ func (n *VictorOpsNotifier) formatBody(event *models.AlertEvent, weburl string)
 	return json.Marshal(m)
 }
 
-func (n *VictorOpsNotifier) post(data []byte, url string, timeout time.Duration) {
+func (n *VictorOpsNotifier) post(data []byte, url string, timeout time.Duration) error {
 	c := &http.Client{
 		Timeout: timeout,
 	}
 	resp, err := c.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		glog.Errorf("Output: Unable to post to victorops: %v", err)
-		return
+		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			body = []byte{}
 		}
-		glog.Errorf("Output: Unable to post to victorops: Got HTTP %d: %v", resp.StatusCode, string(body))
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// saveEntity stores the entity id of the incident created for the alert so that
+// changes made in victorops can be matched to it
+func (n *VictorOpsNotifier) saveEntity(db models.Dbase, alert *models.Alert, routingKey string) error {
+	return models.WithTx(context.Background(), db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		return models.SaveOutputMessage(tx, &models.OutputMessage{
+			AlertId: alert.Id, Output: n.Name(), Channel: routingKey, MessageId: n.entityId(alert),
+		})
+	})
+}
+
+// incidents gets the current incidents from the victorops public api
+func (n *VictorOpsNotifier) incidents(timeout time.Duration) ([]*voIncident, error) {
+	apiUrl := n.PublicApiUrl
+	if apiUrl == "" {
+		apiUrl = voDefaultPublicApiUrl
+	}
+	req, err := http.NewRequest("GET", apiUrl+"/api-public/v1/incidents", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-VO-Api-Id", n.ApiId)
+	req.Header.Set("X-VO-Api-Key", n.PublicApiKey)
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	result := struct {
+		Incidents []*voIncident `json:"incidents"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Incidents, nil
+}
+
+// apply acks or clears the alert matching the incident if it was acked or resolved in victorops.
+// Receivers are not notified so that the change is not sent back to victorops.
+func (n *VictorOpsNotifier) apply(ctx context.Context, incident *voIncident, opts *plugins.Options) error {
+	if incident.CurrentPhase != "ACKED" && incident.CurrentPhase != "RESOLVED" {
+		return nil
+	}
+	return models.WithTx(ctx, opts.Db.NewTx(), func(ctx context.Context, tx models.Txn) error {
+		msg, err := models.FindOutputMessage(tx, n.Name(), incident.EntityId)
+		if err != nil || msg == nil {
+			return err
+		}
+		alert, err := opts.Actioner.GetExisting(tx, &models.Alert{Id: msg.AlertId})
+		if err != nil {
+			return err
+		}
+		if alert.Status == models.Status_CLEARED || alert.Status == models.Status_EXPIRED {
+			return nil
+		}
+		if incident.CurrentPhase == "RESOLVED" {
+			glog.V(2).Infof("Output: Victorops: Clearing alert %d resolved in incident %s", alert.Id, incident.IncidentNumber)
+			return opts.Actioner.Clear(ctx, tx, alert, false)
+		}
+		by := incident.ackedBy()
+		if alert.Owner.Valid || by == "" {
+			return nil
+		}
+		glog.V(2).Infof("Output: Victorops: Setting owner of alert %d to %s", alert.Id, by)
+		return opts.Actioner.SetOwner(ctx, tx, alert, by, "", false)
+	})
+}
+
+// sync applies the state of victorops incidents to the matching alerts
+func (n *VictorOpsNotifier) sync(ctx context.Context, opts *plugins.Options) {
+	incidents, err := n.incidents(opts.ClientTimeout)
+	if err != nil {
+		glog.Errorf("Output: Victorops: Unable to get incidents: %v", err)
+		return
+	}
+	for _, incident := range incidents {
+		if err := n.apply(ctx, incident, opts); err != nil {
+			glog.Errorf("Output: Victorops: Unable to sync incident %s: %v", incident.IncidentNumber, err)
+		}
+	}
+}
+
+func (n *VictorOpsNotifier) send(req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	event := req.Event
+	recp, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	if event.Type == models.EventType_CLEARED && !recp.AutoResolve {
+		return
+	}
+	if event.Type == models.EventType_ACKD && !recp.SendAck {
+		return
+	}
+	body, err := n.formatBody(event, opts.WebUrl)
+	if err != nil {
+		glog.Errorf("Output: Victorops: Cant get json body for alert: %v", err)
+		span.SetError(err)
+		return
+	}
+	url := n.ApiUrl + fmt.Sprintf("/%s/%s", n.ApiKey, recp.RoutingKey)
+	if err := n.post(body, url, opts.ClientTimeout); err != nil {
+		glog.Errorf("Output: Unable to post to victorops: %v", err)
+		span.SetError(err)
+		return
+	}
+	req.Sent(n.Name())
+	if n.Sync && opts.Db != nil && event.Alert.Id > 0 && event.Type == models.EventType_ACTIVE {
+		if err := n.saveEntity(opts.Db, event.Alert, recp.RoutingKey); err != nil {
+			glog.Errorf("Output: Victorops: Unable to save incident for alert %d: %v", event.Alert.Id, err)
+			span.SetError(err)
+		}
 	}
 }
 
 func (n *VictorOpsNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	var poll <-chan time.Time
+	if n.Sync {
+		if opts.Db == nil || opts.Actioner == nil {
+			glog.Errorf("Output: Victorops: Sync needs a db and an alert handler")
+		} else {
+			interval := n.PollInterval
+			if interval == 0 {
+				interval = voDefaultPollInterval
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+	}
 	for {
 		select {
 		case req := <-n.Notif:
-			event := req.Event
-			recp, ok := n.Recipients[req.Name]
-			if !ok {
-				glog.Errorf("Failed to get recipient for output %s", req.Name)
-				break
-			}
-			if event.Type == models.EventType_CLEARED && !recp.AutoResolve {
-				break
-			}
-			if event.Type == models.EventType_ACKD && !recp.SendAck {
-				break
-			}
-			body, err := n.formatBody(event, opts.WebUrl)
-			if err != nil {
-				glog.Errorf("Output: Victorops: Cant get json body for alert: %v", err)
-				break
-			}
-			url := n.ApiUrl + fmt.Sprintf("/%s/%s", n.ApiKey, recp.RoutingKey)
-			n.post(body, url, opts.ClientTimeout)
+			n.send(req, opts)
+		case <-poll:
+			n.sync(ctx, opts)
 		case <-ctx.Done():
 			return
 		}
@@ -0,0 +1,231 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/plugins"
+)
+
+const (
+	defaultSignatureHeader   = "X-Alert-Manager-Signature"
+	defaultIdempotencyHeader = "Idempotency-Key"
+	defaultWebhookRetryDelay = time.Second
+)
+
+type WebhookRecipient struct {
+	Url             string
+	Headers         map[string]string
+	Template        string
+	EventTypes      []string `mapstructure:"event_types"`
+	Secret          string
+	SignatureHeader string `mapstructure:"signature_header"`
+	Retries         int
+	// RetryDelay is the delay before the first retry, doubled after each failed retry.
+	// Defaults to 1s.
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+
+	tmpl *template.Template
+}
+
+// wantsEvent returns true if the event type is in the list of subscribed event types.
+// An empty list of event types subscribes to all events.
+func wantsEvent(eventTypes []string, eventType models.EventType) bool {
+	if len(eventTypes) == 0 {
+		return true
+	}
+	for _, e := range eventTypes {
+		if strings.ToUpper(e) == eventType.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// wants returns true if the recipient is subscribed to the given event type.
+func (r *WebhookRecipient) wants(eventType models.EventType) bool {
+	return wantsEvent(r.EventTypes, eventType)
+}
+
+func (r *WebhookRecipient) template() (*template.Template, error) {
+	if r.tmpl != nil {
+		return r.tmpl, nil
+	}
+	funcMap := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			d, err := json.Marshal(v)
+			return string(d), err
+		},
+	}
+	tmpl, err := template.New("webhook").Funcs(funcMap).Parse(r.Template)
+	if err != nil {
+		return nil, err
+	}
+	r.tmpl = tmpl
+	return tmpl, nil
+}
+
+// webhookMsg is the default json body sent when no template is configured
+type webhookMsg struct {
+	EventType      string        `json:"event_type"`
+	Timestamp      int64         `json:"timestamp"`
+	IdempotencyKey string        `json:"idempotency_key"`
+	AlertUrl       string        `json:"alert_url"`
+	Alert          *models.Alert `json:"alert"`
+}
+
+type WebhookNotifier struct {
+	Notif      chan *plugins.SendRequest
+	Recipients map[string]*WebhookRecipient
+}
+
+func (n *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// idempotencyKey returns a key that is stable for a given alert event so that receivers
+// can discard duplicate deliveries caused by retries or re-notifications.
+func idempotencyKey(event *models.AlertEvent) string {
+	alert := event.Alert
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s:%s:%s:%d:%s",
+		alert.Id, event.Type.String(), alert.Status.String(), alert.Severity.String(), alert.LastActive.Unix(), alert.Owner.String)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body using the shared secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *WebhookNotifier) formatBody(recipient *WebhookRecipient, event *models.AlertEvent, weburl, key string) ([]byte, error) {
+	msg := &webhookMsg{
+		EventType:      event.Type.String(),
+		Timestamp:      time.Now().Unix(),
+		IdempotencyKey: key,
+		AlertUrl:       weburl + fmt.Sprintf("/%d", event.Alert.Id),
+		Alert:          event.Alert,
+	}
+	if recipient.Template == "" {
+		return json.Marshal(msg)
+	}
+	tmpl, err := recipient.template()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, msg); err != nil {
+		return nil, fmt.Errorf("Failed to render template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *WebhookNotifier) post(recipient *WebhookRecipient, data []byte, key string, timeout time.Duration) error {
+	req, err := http.NewRequest("POST", recipient.Url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(defaultIdempotencyHeader, key)
+	for k, v := range recipient.Headers {
+		req.Header.Set(k, v)
+	}
+	if recipient.Secret != "" {
+		header := recipient.SignatureHeader
+		if header == "" {
+			header = defaultSignatureHeader
+		}
+		req.Header.Set(header, "sha256="+sign(recipient.Secret, data))
+	}
+	c := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return fmt.Errorf("Got HTTP %d: %v", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) send(ctx context.Context, req *plugins.SendRequest, opts *plugins.Options) {
+	span := req.StartSpan(n.Name())
+	defer span.End()
+	recipient, ok := n.Recipients[req.Name]
+	if !ok {
+		err := fmt.Errorf("Failed to get recipient for output %s", req.Name)
+		glog.Error(err)
+		span.SetError(err)
+		return
+	}
+	if !recipient.wants(req.Event.Type) {
+		return
+	}
+	key := idempotencyKey(req.Event)
+	body, err := n.formatBody(recipient, req.Event, opts.WebUrl, key)
+	if err != nil {
+		glog.Errorf("Output: Webhook: Cant get body for alert %s: %v", req.Event.Alert.Name, err)
+		span.SetError(err)
+		return
+	}
+	delay := recipient.RetryDelay
+	if delay <= 0 {
+		delay = defaultWebhookRetryDelay
+	}
+	// the same idempotency key is re-used across retries, which stop when ctx is done
+retry:
+	for i := 0; i <= recipient.Retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-ctx.Done():
+				break retry
+			}
+		}
+		if err = n.post(recipient, body, key, opts.ClientTimeout); err == nil {
+			req.Sent(n.Name())
+			return
+		}
+		glog.V(2).Infof("Output: Webhook: Attempt %d to post to %s failed: %v", i+1, req.Name, err)
+	}
+	glog.Errorf("Output: Unable to post to webhook %s: %v", req.Name, err)
+	span.SetError(err)
+}
+
+func (n *WebhookNotifier) Start(ctx context.Context, opts *plugins.Options) {
+	for {
+		select {
+		case req := <-n.Notif:
+			n.send(ctx, req, opts)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func init() {
+	n := &WebhookNotifier{Notif: make(chan *plugins.SendRequest)}
+	plugins.AddOutput(n, n.Notif)
+}
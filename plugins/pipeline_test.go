@@ -1,10 +1,13 @@
 package plugins
 
 import (
+	"bytes"
 	"context"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 type MockDb struct{}
@@ -96,3 +99,33 @@ func TestPipelineStages(t *testing.T) {
 	assert.Equal(t, len(c.recvd), 1)
 	assert.Equal(t, c.recvd[0], event2)
 }
+
+type mockOutput struct{}
+
+func (o *mockOutput) Name() string { return "mock" }
+
+func (o *mockOutput) Start(ctx context.Context, opts *Options) {}
+
+func TestSendLatency(t *testing.T) {
+	notif := make(chan *SendRequest, 1)
+	AddOutput(&mockOutput{}, notif)
+	alert := &models.Alert{ReceivedAt: time.Now().Add(-time.Second)}
+	Send(context.Background(), "mock.r1", &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: alert})
+	req := <-notif
+	assert.Equal(t, req.Name, "r1")
+	// the latency is only observed once the output has sent the event
+	assert.Nil(t, statsNotifyLatency["mock"])
+	req.Sent("mock")
+	buf := new(bytes.Buffer)
+	if err := stats.WritePrometheus(buf); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, buf.String(), `_output_notify_latency_seconds_count{output="mock"} 1`+"\n")
+
+	// reminders have no ingest time
+	req.Event.Alert.ReceivedAt = time.Time{}
+	req.Sent("mock")
+	buf.Reset()
+	stats.WritePrometheus(buf)
+	assert.Contains(t, buf.String(), `_output_notify_latency_seconds_count{output="mock"} 1`+"\n")
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 )
 
 // Listener is any agent that listens to alerts. Alerts are sent down a channel that
@@ -22,6 +24,13 @@ type Listener interface {
 	GetParsersList() []string
 }
 
+// DbListener is a listener that uses the DB, e.g. to look up credentials. The DB is set
+// before the listener is started.
+type DbListener interface {
+	Listener
+	SetDb(db models.Dbase)
+}
+
 // Processor is an alert processor thats part of a processor pipeline
 type Processor interface {
 	Name() string
@@ -43,6 +52,12 @@ type Output interface {
 	Start(ctx context.Context, opts *Options)
 }
 
+// Configurable is implemented by plugins that validate their config once it is loaded. An
+// invalid config fails the config load.
+type Configurable interface {
+	Init() error
+}
+
 type ApiPlugins struct {
 	Parsers    []string `json:"parsers"`
 	Processors []string `json:"processors"`
@@ -55,6 +70,10 @@ var (
 	Processors []Processor
 	Outputs    = make(map[Output]chan *SendRequest)
 	gMu        sync.Mutex
+
+	// statsNotifyLatency are the ingest to notify latencies per output
+	statsNotifyLatency = make(map[string]*stats.Histogram)
+	latencyMu          sync.Mutex
 )
 
 func AddListener(l Listener) {
@@ -85,9 +104,39 @@ func GetOutput(name string) Output {
 type SendRequest struct {
 	Name  string
 	Event *models.AlertEvent
+	// Trace is the span the event was sent from
+	Trace tracing.SpanContext
 }
 
-func Send(outputName string, event *models.AlertEvent) {
+// StartSpan starts the span of the delivery of the event by the output. It is a child of the
+// span the event was sent from.
+func (r *SendRequest) StartSpan(output string) *tracing.Span {
+	span := tracing.StartSpan(r.Trace, "output."+output)
+	span.SetAttribute("recipient", r.Name)
+	span.SetAttribute("event_type", r.Event.Type.String())
+	return span
+}
+
+// Sent is called by the output once it has delivered the event. It observes the time from the
+// alert being received by a listener to being sent by the output.
+func (r *SendRequest) Sent(output string) {
+	// only alerts received by a listener have an ingest time, not reminders or expiries
+	if r.Event.Alert.ReceivedAt.IsZero() {
+		return
+	}
+	latencyMu.Lock()
+	latency, ok := statsNotifyLatency[output]
+	if !ok {
+		latency = stats.NewHistogram("outputs."+output+".notify_latency_seconds", nil)
+		statsNotifyLatency[output] = latency
+	}
+	latencyMu.Unlock()
+	latency.ObserveSince(r.Event.Alert.ReceivedAt)
+}
+
+// Send sends the event to the output named <output>.<recipient>. The delivery by the output
+// is traced as a child of the span in ctx.
+func Send(ctx context.Context, outputName string, event *models.AlertEvent) {
 	parts := strings.Split(outputName, ".")
 	if len(parts) > 2 {
 		return
@@ -100,7 +149,7 @@ func Send(outputName string, event *models.AlertEvent) {
 	}
 	for output, notif := range Outputs {
 		if output.Name() == parts[0] {
-			notif <- &SendRequest{Name: toSend, Event: event}
+			notif <- &SendRequest{Name: toSend, Event: event, Trace: tracing.SpanContextFromContext(ctx)}
 			return
 		}
 	}
@@ -111,12 +160,16 @@ func Init(ctx context.Context, db models.Dbase, options ...PluginOption) error {
 	opts := &Options{
 		WebUrl:        "http://localhost",
 		ClientTimeout: 5 * time.Second,
+		Db:            db,
 	}
 	for _, opt := range options {
 		opt(opts)
 	}
 	// start all the listeners
 	for name, listener := range Listeners {
+		if l, ok := listener.(DbListener); ok {
+			l.SetDb(db)
+		}
 		glog.Infof("Starting Listener: %s on %s", name, listener.Uri())
 		go listener.Listen(ctx)
 	}
@@ -157,9 +210,20 @@ func GetApiPluginsList() ApiPlugins {
 	return choices
 }
 
+// AlertActioner applies changes made to alerts in external systems, e.g. an ack in an on-call tool
+type AlertActioner interface {
+	GetExisting(tx models.Txn, alert *models.Alert) (*models.Alert, error)
+	SetOwner(ctx context.Context, tx models.Txn, alert *models.Alert, name, teamName string, notify bool) error
+	Clear(ctx context.Context, tx models.Txn, alert *models.Alert, notify bool) error
+}
+
 type Options struct {
 	WebUrl        string
 	ClientTimeout time.Duration
+	// Db allows outputs to look up related alerts
+	Db models.Dbase
+	// Actioner allows outputs to sync changes back to alerts
+	Actioner AlertActioner
 }
 
 type PluginOption func(*Options)
@@ -175,3 +239,9 @@ func ClientTimeout(to time.Duration) PluginOption {
 		o.ClientTimeout = to
 	}
 }
+
+func Actioner(a AlertActioner) PluginOption {
+	return func(o *Options) {
+		o.Actioner = a
+	}
+}
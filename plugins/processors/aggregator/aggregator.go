@@ -10,6 +10,7 @@ import (
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
 	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 	"github.com/mayuresh82/alert_manager/plugins/processors/aggregator/groupers"
 )
@@ -139,7 +140,7 @@ func (a *Aggregator) handleGrouped(ctx context.Context, group *alertGroup, out c
 		a.statAggsActive.Add(1)
 		event := &models.AlertEvent{Type: models.EventType_ACTIVE, Alert: agg}
 		out <- event
-		plugins.Send("influx", event)
+		plugins.Send(ctx, "influx", event)
 		return nil
 	})
 }
@@ -229,7 +230,9 @@ func (a *Aggregator) startProcess(in, out chan *models.AlertEvent) {
 	}
 	glog.Info("Starting processor - Aggregator")
 	for event := range in {
+		span := tracing.StartSpan(event.Alert.Trace, "processor.aggregator")
 		if event.Alert.AggregatorId != 0 {
+			span.End()
 			out <- event
 			continue
 		}
@@ -250,6 +253,7 @@ func (a *Aggregator) startProcess(in, out chan *models.AlertEvent) {
 			}
 			processed = true
 			glog.V(4).Infof("Got grouper %v for alert %s, rule: %s", grouper, event.Alert.Name, ruleName)
+			span.SetAttribute("aggregation_rule", ruleName)
 			switch event.Type {
 			case models.EventType_ACTIVE:
 				a.grouper.addAlert(grouper, ruleName, event.Alert)
@@ -257,6 +261,7 @@ func (a *Aggregator) startProcess(in, out chan *models.AlertEvent) {
 				a.grouper.removeAlert(ruleName, event.Alert)
 			}
 		}
+		span.End()
 		if !processed {
 			out <- event
 		}
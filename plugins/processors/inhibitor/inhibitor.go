@@ -7,6 +7,7 @@ import (
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
 	"github.com/mayuresh82/alert_manager/internal/stats"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 	"sync"
 	"time"
@@ -113,7 +114,9 @@ func (i *Inhibitor) Process(ctx context.Context, db models.Dbase, in chan *model
 	go func() {
 		glog.Info("Starting processor - Inhibitor")
 		for event := range in {
+			span := tracing.StartSpan(event.Alert.Trace, "processor.inhibitor")
 			if event.Type != models.EventType_ACTIVE {
+				span.End()
 				out <- event
 				continue
 			}
@@ -130,6 +133,7 @@ func (i *Inhibitor) Process(ctx context.Context, db models.Dbase, in chan *model
 				if !toProcess {
 					continue
 				}
+				span.SetAttribute("inhibit_rule", rule.Name)
 				if rule.Delay == 0 {
 					// sequentially check alert against every rule
 					i.addAlert(rule.Name, event.Alert)
@@ -147,6 +151,7 @@ func (i *Inhibitor) Process(ctx context.Context, db models.Dbase, in chan *model
 				i.addAlert(rule.Name, event.Alert)
 				anyMatched = true
 			}
+			span.End()
 			if !anyMatched {
 				out <- event
 			}
@@ -3,12 +3,14 @@ package notifier
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 )
 
@@ -80,11 +82,16 @@ func (n *Notifier) remind() {
 		notif := n.notifiedAlerts[a]
 		notif.lastNotified = time.Now()
 		glog.V(2).Infof("Sending notification reminder for %d:%s", notif.event.Alert.Id, notif.event.Alert.Name)
-		if alertConfig, ok := ah.Config.GetAlertConfig(notif.event.Alert.Name); ok {
-			n.send(notif.event, alertConfig.Config.Outputs.Get(notif.event.Alert.Labels))
+		// reminders are not part of the trace or the notify latency of the original alert
+		alert := *notif.event.Alert
+		alert.ReceivedAt, alert.Trace = time.Time{}, tracing.SpanContext{}
+		reminder := &models.AlertEvent{Type: notif.event.Type, Alert: &alert}
+		ctx := context.Background()
+		if alertConfig, ok := ah.Config.GetAlertConfig(alert.Name); ok {
+			n.send(ctx, reminder, alertConfig.Config.Outputs.Get(alert.Labels))
 		} else {
 			outputConf := ah.Config.GetOutputConfig()
-			n.send(notif.event, outputConf.Defaults.Get(notif.event.Alert.Labels))
+			n.send(ctx, reminder, outputConf.Defaults.Get(alert.Labels))
 		}
 	}
 }
@@ -102,6 +109,9 @@ func (n *Notifier) remind() {
 // - else send it to the default output
 func (n *Notifier) Notify(event *models.AlertEvent) {
 	alert := event.Alert
+	span := tracing.StartSpan(alert.Trace, "processor.notifier")
+	defer span.End()
+	ctx := tracing.ContextWithSpanContext(context.Background(), span.Context)
 	alertConfig, ok := ah.Config.GetAlertConfig(alert.Name)
 	if ok && alertConfig.Config.DisableNotify {
 		return
@@ -144,12 +154,12 @@ func (n *Notifier) Notify(event *models.AlertEvent) {
 	case models.EventType_SUPPRESSED:
 		return
 	}
-	n.send(event, outputs)
+	span.SetAttribute("outputs", strings.Join(outputs, ","))
+	n.send(ctx, event, outputs)
 	tx := n.db.NewTx()
-	ctx := context.Background()
 	err := models.WithTx(ctx, tx, func(ctx context.Context, tx models.Txn) error {
 		msg := fmt.Sprintf("Alert notification sent to %v", outputs)
-		_, err := tx.NewRecord(event.Alert.Id, msg)
+		_, err := models.AddRecord(ctx, tx, event.Alert.Id, msg)
 		return err
 	})
 	if err != nil {
@@ -157,10 +167,10 @@ func (n *Notifier) Notify(event *models.AlertEvent) {
 	}
 }
 
-func (n *Notifier) send(event *models.AlertEvent, outputs []string) {
+func (n *Notifier) send(ctx context.Context, event *models.AlertEvent, outputs []string) {
 	for _, output := range outputs {
 		glog.V(2).Infof("Sending alert %d:%s to %s", event.Alert.Id, event.Alert.Name, output)
-		plugins.Send(output, event)
+		plugins.Send(ctx, output, event)
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 
 	ah "github.com/mayuresh82/alert_manager/handler"
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"github.com/mayuresh82/alert_manager/internal/tracing"
 	"github.com/mayuresh82/alert_manager/plugins"
 	tu "github.com/mayuresh82/alert_manager/testutil"
 	"github.com/stretchr/testify/assert"
@@ -40,6 +41,10 @@ func (t *MockTx) NewRecord(alertId int64, event string) (int64, error) {
 	return 1, nil
 }
 
+func (t *MockTx) NewInsert(query string, item interface{}) (int64, error) {
+	return 1, nil
+}
+
 type MockOutput struct{}
 
 func (m *MockOutput) Name() string { return "slack" }
@@ -158,6 +163,46 @@ func TestNotifyReminder(t *testing.T) {
 	notif.remind()
 }
 
+func TestNotifyTracing(t *testing.T) {
+	exp := &tracing.InMemoryExporter{}
+	tracing.SetExporter(exp)
+	defer tracing.SetExporter(nil)
+	mockAlert := tu.MockAlert(2, "Test Alert 5", "", "d2", "e2", "src1", "scp1", "t1", "1", "WARN", []string{}, nil)
+	mockAlert.ExtendLabels()
+	mockAlert.LastActive.Time = mockAlert.LastActive.Add(10 * time.Minute)
+	handlerSpan := tracing.StartSpan(tracing.SpanContext{}, "handler.active")
+	mockAlert.Trace = handlerSpan.Context
+	mockAlert.ReceivedAt = time.Now()
+	notif := &Notifier{notifiedAlerts: make(map[int64]*notification), db: &MockDb{}}
+	notifyChan := make(chan *plugins.SendRequest, 2)
+	plugins.AddOutput(&MockOutput{}, notifyChan)
+
+	notif.Notify(&models.AlertEvent{Type: models.EventType_ACTIVE, Alert: mockAlert})
+	// the output traces its delivery of the request
+	req := <-notifyChan
+	req.StartSpan("slack").End()
+	notifSpans := exp.Find("processor.notifier")
+	outputSpans := exp.Find("output.slack")
+	assert.Equal(t, len(notifSpans), 1)
+	assert.Equal(t, len(outputSpans), 1)
+	assert.Equal(t, notifSpans[0].ParentId, handlerSpan.Context.SpanId)
+	assert.Equal(t, outputSpans[0].Context.TraceId, handlerSpan.Context.TraceId)
+	assert.Equal(t, outputSpans[0].ParentId, notifSpans[0].Context.SpanId)
+
+	// reminders are not part of the trace of the alert
+	exp.Reset()
+	notif.notifiedAlerts[mockAlert.Id].lastNotified = time.Now().Add(-20 * time.Minute)
+	notif.remind()
+	req = <-notifyChan
+	req.StartSpan("slack").End()
+	assert.Equal(t, req.Event.Alert.Id, mockAlert.Id)
+	assert.False(t, req.Event.Alert.Trace.IsValid())
+	assert.True(t, req.Event.Alert.ReceivedAt.IsZero())
+	outputSpans = exp.Find("output.slack")
+	assert.Equal(t, len(outputSpans), 1)
+	assert.NotEqual(t, outputSpans[0].Context.TraceId, handlerSpan.Context.TraceId)
+}
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 	ah.Config = ah.NewConfigHandler("../../../testutil/testdata/test_config.yaml")
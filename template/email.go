@@ -368,3 +368,13 @@ SOFTWARE.
 
 </html>
 `
+
+var EmailTextTemplate = `{{ .Header }}
+
+{{ range .AlertParams -}}
+{{ .Name }}: {{ .Value }}
+{{ end }}
+View in Alert Manager: {{ .AlertMgrURL }}
+
+Sent at {{ .SentAt }}
+`
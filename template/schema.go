@@ -40,7 +40,10 @@ CREATE TABLE IF NOT EXISTS alert_history (
   id SERIAL PRIMARY KEY,
   timestamp BIGINT NOT NULL,
   alert_id INT NOT NULL,
-  event TEXT NOT NULL);
+  event TEXT NOT NULL,
+  trace_id VARCHAR(32) NOT NULL DEFAULT '');
+
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32) NOT NULL DEFAULT '';
 
 CREATE TABLE IF NOT EXISTS teams (
   id SERIAL PRIMARY KEY,
@@ -53,6 +56,25 @@ CREATE TABLE IF NOT EXISTS users (
   team_id INT REFERENCES teams(id),
   PRIMARY KEY (id, team_id));
 
+CREATE TABLE IF NOT EXISTS webhook_tokens (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(64) NOT NULL,
+  source VARCHAR(64) NOT NULL DEFAULT '',
+  team VARCHAR(64) NOT NULL DEFAULT '',
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  created_at BIGINT NOT NULL,
+  creator VARCHAR(64) NOT NULL);
+
+CREATE TABLE IF NOT EXISTS output_messages (
+  alert_id INT NOT NULL,
+  output VARCHAR(64) NOT NULL,
+  channel VARCHAR(128) NOT NULL,
+  message_id VARCHAR(512) NOT NULL,
+  PRIMARY KEY (alert_id, output));
+
+ALTER TABLE output_messages ALTER COLUMN message_id TYPE VARCHAR(512);
+
 CREATE INDEX IF NOT EXISTS alerts_id_idx ON alerts (id);
 CREATE INDEX IF NOT EXISTS alert_history_alert_id_idx ON alert_history (alert_id);
+CREATE INDEX IF NOT EXISTS output_messages_message_id_idx ON output_messages (output, message_id);
 `
@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"github.com/mayuresh82/alert_manager/internal/models"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +12,16 @@ func (m *MockStat) Add(value int64) {}
 func (m *MockStat) Set(value int64) {}
 func (m *MockStat) Reset()          {}
 
+// CountStat is a stat that keeps its value so that tests can check it
+type CountStat struct {
+	value int64
+}
+
+func (c *CountStat) Add(value int64) { atomic.AddInt64(&c.value, value) }
+func (c *CountStat) Set(value int64) { atomic.StoreInt64(&c.value, value) }
+func (c *CountStat) Reset()          { c.Set(0) }
+func (c *CountStat) Value() int64    { return atomic.LoadInt64(&c.value) }
+
 func MockAlert(id int64, name, desc, device, entity, source, scope, team, extId, sev string, tags []string, labels models.Labels) *models.Alert {
 	start := models.MyTime{time.Now()}
 	a := &models.Alert{